@@ -29,6 +29,7 @@ import (
 	"github.com/vpnhouse/tunnel/internal/eventlog"
 	"github.com/vpnhouse/tunnel/internal/grpc"
 	"github.com/vpnhouse/tunnel/internal/httpapi"
+	"github.com/vpnhouse/tunnel/internal/ipam6"
 	"github.com/vpnhouse/tunnel/internal/ipdiscover"
 	"github.com/vpnhouse/tunnel/internal/iprose"
 	"github.com/vpnhouse/tunnel/internal/manager"
@@ -54,6 +55,63 @@ func init() {
 	}
 }
 
+// initWireguardInterface creates the wireguard interface along with the address pools of its peers
+func initWireguardInterface(runtime *runtime.TunnelRuntime, wgcfg wireguard.Config, netpol settings.NetworkAccessPolicy, primary bool) (*manager.Interface, error) {
+	// keep the service names of the primary interface as is
+	suffix := ""
+	if !primary {
+		suffix = "-" + wgcfg.Interface
+	}
+
+	if runtime.Flags.Restarting {
+		// the interface is kept by the previous run to not disconnect peers
+		wgcfg.ExistingInterface = wireguard.ExistingInterfaceAdopt
+	}
+	wireguardController, err := wireguard.New(wgcfg)
+	if err != nil {
+		return nil, err
+	}
+	wireguardController.KeepLinkOn(func() bool {
+		return runtime.Flags.Restarting
+	})
+	runtime.Services.RegisterService("wireguard"+suffix, wireguardController)
+
+	// Initialize ip addr manager
+	ipv4am, err := ipam.New(ipam.Config{
+		Subnet:           wgcfg.Subnet.Unwrap(),
+		Interface:        wgcfg.Interface,
+		AccessPolicy:     netpol.Access,
+		RateLimiter:      netpol.RateLimit,
+		PortRestrictions: runtime.Settings.PortRestrictions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	runtime.Services.RegisterService("ipv4am"+suffix, ipv4am)
+
+	// IPv6 addressing is optional
+	var ipv6am *ipam6.IPAM
+	subnet6, err := wgcfg.IPv6Subnet()
+	if err != nil {
+		return nil, err
+	}
+	if subnet6 != nil {
+		ipv6am, err = ipam6.New(subnet6)
+		if err != nil {
+			return nil, err
+		}
+		runtime.Services.RegisterService("ipv6am"+suffix, ipv6am)
+	}
+
+	return &manager.Interface{
+		Name:      wgcfg.Interface,
+		Wireguard: wireguardController,
+		IP4am:     ipv4am,
+		IP6am:     ipv6am,
+		Subnets:   wgcfg.Subnets(),
+	}, nil
+}
+
 func initServices(runtime *runtime.TunnelRuntime) error {
 	zap.L().Info("starting tunnel", zap.String("version", version.GetVersion()), zap.Any("features", runtime.Features))
 
@@ -82,7 +140,11 @@ func initServices(runtime *runtime.TunnelRuntime) error {
 	}
 
 	// Initialize sqlite storage
-	dataStorage, err := storage.New(runtime.Settings.SQLitePath)
+	secretsKey, err := runtime.Settings.GetSecretsKey()
+	if err != nil {
+		return err
+	}
+	dataStorage, err := storage.New(runtime.Settings.SQLitePath, secretsKey)
 	if err != nil {
 		return err
 	}
@@ -124,27 +186,17 @@ func initServices(runtime *runtime.TunnelRuntime) error {
 	}
 	runtime.Services.RegisterService("authorizer", jwtAuthorizer)
 
-	// Initialize wireguard controller
-	wgcfg := runtime.Settings.Wireguard
-	wireguardController, err := wireguard.New(wgcfg)
-	if err != nil {
-		return err
-	}
-	runtime.Services.RegisterService("wireguard", wireguardController)
-
-	// Initialize ip addr manager
+	// Initialize wireguard interfaces, the primary one goes first
 	netpol := runtime.Settings.GetNetworkAccessPolicy()
-	ipv4am, err := ipam.New(ipam.Config{
-		Subnet:           wgcfg.Subnet.Unwrap(),
-		Interface:        wgcfg.Interface,
-		AccessPolicy:     netpol.Access,
-		RateLimiter:      netpol.RateLimit,
-		PortRestrictions: runtime.Settings.PortRestrictions,
-	})
-	if err != nil {
-		return err
+	var wgInterfaces []*manager.Interface
+	for _, wgcfg := range runtime.Settings.WireguardInterfaces() {
+		iface, err := initWireguardInterface(runtime, wgcfg, netpol, len(wgInterfaces) == 0)
+		if err != nil {
+			return err
+		}
+		wgInterfaces = append(wgInterfaces, iface)
 	}
-	runtime.Services.RegisterService("ipv4am", ipv4am)
+	ipv4am := wgInterfaces[0].IP4am
 
 	var geoipService *geoip.Instance
 	if runtime.Features.WithGeoip() {
@@ -174,10 +226,10 @@ func initServices(runtime *runtime.TunnelRuntime) error {
 	sessionManager, err := manager.New(
 		runtime,
 		dataStorage,
-		wireguardController,
-		ipv4am,
+		wgInterfaces,
 		statService,
 		geoipService,
+		eventLog,
 	)
 	if err != nil {
 		return err
@@ -21,21 +21,29 @@ export const INVALID_SYMBOLS: PeerCardPatternsType = {
   public_key: /[^A-Za-z0-9+=/]/,
   ipv4: /[^0-9.]/,
   session_id: /[^0-9a-fA-F-]/,
-  installation_id: /[^0-9a-fA-F-]/
+  installation_id: /[^0-9a-fA-F-]/,
+  routed_subnets: /[^0-9a-fA-F.:/,\s]/
 };
 
-export const SYMBOL_ERRORS: PeerErrorType & { public_key: string, session_id: string, installation_id: string } = {
+export const SYMBOL_ERRORS: PeerErrorType & {
+  public_key: string,
+  session_id: string,
+  installation_id: string,
+  routed_subnets: string
+} = {
   public_key: 'Only letters, digits and symbols +/= are allowed',
   ipv4: 'Only digits and dots are allowed',
   session_id: 'Only hexadecimal digits and symbol - are allowed',
-  installation_id: 'Only hexadecimal digits and symbol - are allowed'
+  installation_id: 'Only hexadecimal digits and symbol - are allowed',
+  routed_subnets: 'Only hexadecimal digits, spaces and symbols .:/, are allowed'
 };
 
 export const PATTERNS: PeerCardPatternsType = {
   public_key: /^[A-Za-z0-9+/]+={0,2}$/,
   ipv4: /^((25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)\.){3}(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)$/,
   session_id: /^[0-9a-fA-F]{8}-([0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12}$/,
-  installation_id: /^[0-9a-fA-F]{8}-([0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12}$/
+  installation_id: /^[0-9a-fA-F]{8}-([0-9a-fA-F]{4}-){3}[0-9a-fA-F]{12}$/,
+  routed_subnets: /^\s*[0-9a-fA-F.:]+\/\d{1,3}(\s*,\s*[0-9a-fA-F.:]+\/\d{1,3})*\s*$/
 };
 
 export const PATTERN_ERRORS: PatternErrorType = {
@@ -43,12 +51,16 @@ export const PATTERN_ERRORS: PatternErrorType = {
   public_key: 'Invalid public key format',
   ipv4: 'Invalid IPV4 format',
   session_id: 'Invalid UUID format',
-  installation_id: 'Invalid UUID format'
+  installation_id: 'Invalid UUID format',
+  routed_subnets: 'Invalid format, use the comma-separated list of CIDRs'
 };
 
 export const PATTERN_VALIDATION: PeerCardsValidationType = {
   public_key: patternRequiredValidation,
-  ipv4: patternValidation
+  ipv4: patternValidation,
+  routed_subnets: patternValidation
 };
 
 export const FAQ_CREATE_PEER_IPV4 = 'The address has been randomly picked up from the configured range, you can use it or change it if it is needed';
+
+export const FAQ_PEER_ROUTED_SUBNETS = 'Comma-separated networks behind the peer, e.g. 192.168.10.0/24, the tunnel routes them to the peer. Leave empty for the regular client';
@@ -25,9 +25,10 @@ import {
   SYMBOL_ERRORS,
   PATTERN_VALIDATION,
   PEER_FIELD_CAN_BE_NULL,
-  FAQ_CREATE_PEER_IPV4
+  FAQ_CREATE_PEER_IPV4,
+  FAQ_PEER_ROUTED_SUBNETS
 } from './PeerCard.constants';
-import { combineDateAndTime } from './PeerCard.utils';
+import { combineDateAndTime, subnetsToList, subnetsToString } from './PeerCard.utils';
 import useStyles from './PeerCard.styles';
 
 const PeerCard: FC<PropsType> = ({
@@ -147,7 +148,9 @@ const PeerCard: FC<PropsType> = ({
     const validationErrors = (Object.entries(peer) as Entries<FlatPeerType>)
       .reduce<PeerErrorType>((errorList, [field, value]) => ({
         ...errorList,
-        [field]: PATTERN_VALIDATION[field] ? (PATTERN_VALIDATION[field]?.(field, value as string) || '') : ''
+        [field]: PATTERN_VALIDATION[field]
+          ? (PATTERN_VALIDATION[field]?.(field, field === 'routed_subnets' ? subnetsToString(value) : value as string) || '')
+          : ''
       }), {} as PeerErrorType);
 
     const isAllFieldsValid = Object.values(validationErrors).every((error) => !error);
@@ -174,7 +177,11 @@ const PeerCard: FC<PropsType> = ({
       (acc, field) => ({
         ...acc,
         [field]: peer[field] || null
-      }), peer
+      }), {
+        ...peer,
+        /** The empty list removes the routed subnets */
+        routed_subnets: subnetsToList(peer.routed_subnets)
+      }
     );
 
     /** If peer is saved, change it, otherwise save it */
@@ -226,6 +233,22 @@ const PeerCard: FC<PropsType> = ({
           }}
         />
 
+        <CardField
+          isEditing={!!isModal}
+          label="Routed subnets"
+          name="routed_subnets"
+          value={subnetsToString(peer?.routed_subnets)}
+          validationError={validationError?.routed_subnets || ''}
+          serverError={serverError?.routed_subnets || ''}
+          options={{
+            type: 'TEXT',
+            textprops: {
+              onChange: changePeerSettings,
+              endAdornment: (<HintAdornment text={FAQ_PEER_ROUTED_SUBNETS} />)
+            }
+          }}
+        />
+
         <CardField
           isEditing={!!isModal}
           label="Expires"
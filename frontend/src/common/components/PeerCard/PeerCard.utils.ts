@@ -14,6 +14,18 @@ export const patternRequiredValidation = (field: string, value: string): string
   return isValid ? '' : (PATTERN_ERRORS[field] || '');
 };
 
+/** Routed subnets come from the server as a list and are edited as a string */
+export const subnetsToString = (subnets?: string[] | string | null): string => (
+  Array.isArray(subnets) ? subnets.join(', ') : (subnets || '')
+);
+
+export const subnetsToList = (subnets?: string[] | string | null): string[] => (
+  subnetsToString(subnets)
+    .split(',')
+    .map((subnet) => subnet.trim())
+    .filter((subnet) => !!subnet)
+);
+
 export const combineDateAndTime = (date: Date, time: Date): Date => {
   const year = date.getFullYear();
   const month = date.getMonth();
@@ -45,7 +45,9 @@ export const createPeerFx = createEffect<void, {ip_address: string}, Response>(
 
 export const savePeerFx = createEffect<FlatPeerType, PeerRecordType & {private_key: string}, Response>(
   async (newPeer) => {
-    const { info_wireguard, ipv4, expires, label, private_key } = newPeer;
+    const {
+      info_wireguard, ipv4, expires, label, private_key, routed_subnets
+    } = newPeer;
 
     const res = await fetchData(
       PEERS,
@@ -56,7 +58,8 @@ export const savePeerFx = createEffect<FlatPeerType, PeerRecordType & {private_k
           info_wireguard,
           ipv4,
           expires,
-          label
+          label,
+          routed_subnets
         })
       }
     );
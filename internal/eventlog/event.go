@@ -30,12 +30,14 @@ const (
 type EventType int32
 
 const (
-	Unspecified      EventType = EventType(proto.EventType_Unspecified)
-	PeerAdd          EventType = EventType(proto.EventType_PeerAdd)
-	PeerRemove       EventType = EventType(proto.EventType_PeerRemove)
-	PeerUpdate       EventType = EventType(proto.EventType_PeerUpdate)
-	PeerTraffic      EventType = EventType(proto.EventType_PeerTraffic)
-	PeerFirstConnect EventType = EventType(proto.EventType_PeerFirstConnect)
+	Unspecified       EventType = EventType(proto.EventType_Unspecified)
+	PeerAdd           EventType = EventType(proto.EventType_PeerAdd)
+	PeerRemove        EventType = EventType(proto.EventType_PeerRemove)
+	PeerUpdate        EventType = EventType(proto.EventType_PeerUpdate)
+	PeerTraffic       EventType = EventType(proto.EventType_PeerTraffic)
+	PeerFirstConnect  EventType = EventType(proto.EventType_PeerFirstConnect)
+	PeerQuotaExceeded EventType = EventType(proto.EventType_PeerQuotaExceeded)
+	PeerRoam          EventType = EventType(proto.EventType_PeerRoam)
 )
 
 type Event struct {
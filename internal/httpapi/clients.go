@@ -8,8 +8,10 @@ import (
 	"crypto/rand"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,13 +22,75 @@ import (
 	"github.com/vpnhouse/common-lib-go/xerror"
 	"github.com/vpnhouse/common-lib-go/xhttp"
 	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/settings"
 	"github.com/vpnhouse/tunnel/internal/types"
+	"github.com/vpnhouse/tunnel/internal/wireguard"
 	"go.uber.org/zap"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 var unsafeUUIDSpace, _ = uuid.FromBytes([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
 
+// peerLimit returns the limit of peers for the user, nil if unlimited.
+// The JWT entitlement overrides the configured limit if set: the zero one allows no peers,
+// so does the invalid one, the user must not get more than entitled.
+func (tun *TunnelAPI) peerLimit(claims *auth.ClientClaims) *types.PeerLimit {
+	config := tun.runtime.Settings.PeerLimit
+	if config == nil {
+		return nil
+	}
+
+	limit := &types.PeerLimit{
+		Max:   config.MaxPerUser,
+		Evict: config.Policy == settings.PeerLimitEvict,
+	}
+	if len(config.Entitlement) > 0 {
+		if v, ok := claims.Entitlements[config.Entitlement]; ok {
+			n, ok := entitlementCount(v)
+			if !ok {
+				zap.L().Warn("invalid peer limit entitlement, no peers allowed", zap.Any("value", v))
+			}
+			limit.Max = n
+			return limit
+		}
+	}
+	if limit.Max == 0 {
+		return nil
+	}
+	return limit
+}
+
+// entitlementCount parses the non-negative integer entitlement,
+// the JSON numbers are decoded as float64 unless the decoder uses json.Number.
+func entitlementCount(v interface{}) (int, bool) {
+	var n int64
+	switch v := v.(type) {
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v > math.MaxInt32 {
+			return 0, false
+		}
+		n = int64(v)
+	case json.Number:
+		i, err := v.Int64()
+		if err != nil {
+			return 0, false
+		}
+		n = i
+	case string:
+		i, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return 0, false
+		}
+		n = i
+	default:
+		return 0, false
+	}
+	if n < 0 || n > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
 // ClientConnect implements endpoint for POST /api/client/connect
 func (tun *TunnelAPI) ClientConnect(w http.ResponseWriter, r *http.Request) {
 	xhttp.JSONResponse(w, func() (interface{}, error) {
@@ -53,7 +117,7 @@ func (tun *TunnelAPI) ClientConnect(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Extract peer identifiers using connect request and JWT claims
-		oIdentifiers, err := constructPeerIdentifiers(oConnectRequest, claims)
+		oIdentifiers, err := constructPeerIdentifiers(&oConnectRequest.ClientConnectJSONBody, claims)
 		if err != nil {
 			return nil, err
 		}
@@ -72,31 +136,63 @@ func (tun *TunnelAPI) ClientConnect(w http.ResponseWriter, r *http.Request) {
 			return nil, err
 		}
 
+		// Pick the wireguard interface to connect to
+		wgSettings, err := tun.wireguardSettings(oConnectRequest.Interface)
+		if err != nil {
+			return nil, err
+		}
+		if oConnectRequest.Interface != nil && len(*oConnectRequest.Interface) > 0 {
+			peer.WireguardInterface = oConnectRequest.Interface
+		}
+		// The existing peer keeps its preshared key, see manager.ConnectPeer
+		if wgSettings.PresharedKeys {
+			psk, err := generatePresharedKey()
+			if err != nil {
+				return nil, err
+			}
+			peer.PresharedKey = &psk
+		}
+
 		// Validate peer
 		if err := peer.Validate("ID", "Ipv4"); err != nil {
 			return nil, err
 		}
 
 		// Set peer
-		if err := tun.manager.ConnectPeer(&peer); err != nil {
+		if err := tun.manager.ConnectPeer(&peer, tun.peerLimit(claims)); err != nil {
 			return nil, err
 		}
 
 		// Prepare connection response
-		wgSettings := tun.runtime.Settings.Wireguard
-		response := tunnelAPI.ClientConfiguration{
-			InfoWireguard: &tunnelAPI.ConnectInfoWireguard{
-				AllowedIps:      []string{"0.0.0.0/0"},
+		dns, err := tun.peerDNS(&peer, wgSettings)
+		if err != nil {
+			return nil, err
+		}
+		hasIPv6 := peer.Ipv6 != nil && peer.Ipv6.IP != nil
+		routes := tun.runtime.Settings.GetClientRoutes(&peer)
+		info := &connectInfoWireguard{
+			ConnectInfoWireguard: tunnelAPI.ConnectInfoWireguard{
+				AllowedIps:      routes.AllowedIPs(hasIPv6),
 				TunnelIpv4:      peer.Ipv4.String(),
-				Dns:             wgSettings.DNS,
+				Dns:             dns,
 				Keepalive:       wgSettings.Keepalive,
 				ServerIpv4:      wgSettings.ServerIPv4,
 				ServerPort:      wgSettings.ListenPort,
-				ServerPublicKey: tun.runtime.Settings.Wireguard.GetPrivateKey().Public().Unwrap().String(),
+				ServerPublicKey: wgSettings.GetPrivateKey().Public().Unwrap().String(),
 				PingInterval:    tun.runtime.Settings.GetPublicAPIConfig().PingInterval,
 			},
 		}
 
+		if hasIPv6 {
+			ip6 := peer.Ipv6.String()
+			info.TunnelIpv6 = &ip6
+		}
+		if peer.PresharedKey != nil && len(*peer.PresharedKey) > 0 {
+			info.PresharedKey = peer.PresharedKey
+		}
+
+		response := clientConfiguration{InfoWireguard: info}
+
 		return response, nil
 	})
 }
@@ -120,6 +216,16 @@ func (tun *TunnelAPI) ClientConnectUnsafe(w http.ResponseWriter, r *http.Request
 		claimsBytes, _ := json.Marshal(claims)
 		claimsString := string(claimsBytes)
 
+		// Pick the wireguard interface to connect to
+		var ifaceName *string
+		if name := r.URL.Query().Get("interface"); len(name) > 0 {
+			ifaceName = &name
+		}
+		settings, err := tun.wireguardSettings(ifaceName)
+		if err != nil {
+			return nil, err
+		}
+
 		privateKey, err := wgtypes.GeneratePrivateKey()
 		if err != nil {
 			return nil, xerror.EInternalError("can't generate private key", err)
@@ -142,6 +248,7 @@ func (tun *TunnelAPI) ClientConnectUnsafe(w http.ResponseWriter, r *http.Request
 			Claims:  &claimsString,
 			WireguardInfo: types.WireguardInfo{
 				WireguardPublicKey: &publicKeyString,
+				WireguardInterface: ifaceName,
 			},
 			PeerIdentifiers: types.PeerIdentifiers{
 				UserId:         &claims.Subject,
@@ -150,44 +257,57 @@ func (tun *TunnelAPI) ClientConnectUnsafe(w http.ResponseWriter, r *http.Request
 			},
 		}
 
+		// The existing peer keeps its preshared key, see manager.ConnectPeer
+		if settings.PresharedKeys {
+			psk, err := generatePresharedKey()
+			if err != nil {
+				return nil, err
+			}
+			peer.PresharedKey = &psk
+		}
+
 		// Validate peer
 		if err := peer.Validate("ID", "Ipv4"); err != nil {
 			return nil, err
 		}
 
 		// Set peer
-		if err := tun.manager.ConnectPeer(&peer); err != nil {
+		if err := tun.manager.ConnectPeer(&peer, tun.peerLimit(claims)); err != nil {
 			return nil, err
 		}
 
 		// Prepare connection response
-		settings := tun.runtime.Settings.Wireguard
-		ipv6Stub := net.ParseIP("0::0")
-		rand.Read(ipv6Stub)
-		ipv6Stub[0] = 0xfc
-		ipv6Stub[1] = 0
-
-		tmpl := `[Interface]
-Address = %s/32, %s/128
-PrivateKey = %s
-
-[Peer]
-PublicKey = %s
-Endpoint = %s:%d
-AllowedIPs = 0.0.0.0/0, ::/0
-PersistentKeepalive = %d
-`
-		response := fmt.Sprintf(tmpl,
-			peer.Ipv4.String(),
-			ipv6Stub.String(),
-			privateKey.String(),
-			tun.runtime.Settings.Wireguard.GetPrivateKey().Public().Unwrap().String(),
-			settings.ServerIPv4,
-			settings.ListenPort,
-			settings.Keepalive,
-		)
-
-		return []byte(response), nil
+		var ipv6 net.IP
+		if peer.Ipv6 != nil && peer.Ipv6.IP != nil {
+			ipv6 = peer.Ipv6.IP
+		} else {
+			// IPv6 addressing is disabled: use a random ULA address
+			// to keep the client's IPv6 traffic within the tunnel.
+			ipv6 = net.ParseIP("0::0")
+			rand.Read(ipv6)
+			ipv6[0] = 0xfc
+			ipv6[1] = 0
+		}
+
+		dns, err := tun.peerDNS(&peer, settings)
+		if err != nil {
+			return nil, err
+		}
+
+		config := &wgQuickConfig{
+			PrivateKey:      privateKey.String(),
+			Addresses:       []string{peer.Ipv4.String() + "/32", ipv6.String() + "/128"},
+			DNS:             dns,
+			ServerPublicKey: settings.GetPrivateKey().Public().Unwrap().String(),
+			Endpoint:        fmt.Sprintf("%s:%d", settings.ServerIPv4, settings.ListenPort),
+			AllowedIPs:      tun.runtime.Settings.GetClientRoutes(&peer).AllowedIPs(true),
+			Keepalive:       settings.Keepalive,
+		}
+		if peer.PresharedKey != nil {
+			config.PresharedKey = *peer.PresharedKey
+		}
+
+		return []byte(config.String()), nil
 	}()
 
 	if err != nil {
@@ -254,8 +374,8 @@ func constructPeerIdentifiers(request interface{}, claims *auth.ClientClaims) (*
 }
 
 // extractConnectInfo parses client information from request
-func (tun *TunnelAPI) extractConnectRequest(r *http.Request) (*tunnelAPI.ClientConnectJSONBody, error) {
-	var request tunnelAPI.ClientConnectJSONBody
+func (tun *TunnelAPI) extractConnectRequest(r *http.Request) (*clientConnectRequest, error) {
+	var request clientConnectRequest
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields()
 
@@ -297,6 +417,20 @@ func (tun *TunnelAPI) extractPeerActionInfo(r *http.Request) (*types.PeerIdentif
 	return identifiers, claims, nil
 }
 
+// wireguardSettings returns configuration of the named wireguard interface,
+// nil or empty name stands for the primary one.
+func (tun *TunnelAPI) wireguardSettings(name *string) (wireguard.Config, error) {
+	if name == nil {
+		return tun.runtime.Settings.Wireguard, nil
+	}
+
+	settings, ok := tun.runtime.Settings.WireguardInterface(*name)
+	if !ok {
+		return wireguard.Config{}, xerror.EInvalidField("unknown wireguard interface "+*name, "interface", nil)
+	}
+	return settings, nil
+}
+
 func (tun *TunnelAPI) getExpiration(suggestedSeconds *int) *time.Time {
 	settings := tun.runtime.Settings.GetPublicAPIConfig()
 	expiresSeconds := settings.PingInterval + settings.PeerTTL
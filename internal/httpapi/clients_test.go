@@ -0,0 +1,94 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/auth"
+	"github.com/vpnhouse/tunnel/internal/runtime"
+	"github.com/vpnhouse/tunnel/internal/settings"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestEntitlementCount(t *testing.T) {
+	cases := []struct {
+		value interface{}
+		n     int
+		ok    bool
+	}{
+		{value: float64(3), n: 3, ok: true},
+		{value: float64(0), n: 0, ok: true},
+		{value: 2.5},
+		{value: float64(-1)},
+		{value: 1e20},
+		{value: json.Number("4"), n: 4, ok: true},
+		{value: json.Number("4.0")},
+		{value: "5", n: 5, ok: true},
+		{value: "five"},
+		{value: true},
+		{value: nil},
+	}
+
+	for _, cc := range cases {
+		n, ok := entitlementCount(cc.value)
+		require.Equal(t, cc.ok, ok, "%#v", cc.value)
+		require.Equal(t, cc.n, n, "%#v", cc.value)
+	}
+}
+
+func TestPeerLimit(t *testing.T) {
+	claims := func(entitlements map[string]interface{}) *auth.ClientClaims {
+		return &auth.ClientClaims{Entitlements: entitlements}
+	}
+
+	cases := []struct {
+		name   string
+		config *settings.PeerLimitConfig
+		claims *auth.ClientClaims
+		limit  *types.PeerLimit
+	}{
+		{
+			name:   "not configured",
+			claims: claims(map[string]interface{}{"max_peers": float64(1)}),
+		},
+		{
+			name:   "unlimited",
+			config: &settings.PeerLimitConfig{Entitlement: "max_peers"},
+			claims: claims(nil),
+		},
+		{
+			name:   "configured",
+			config: &settings.PeerLimitConfig{MaxPerUser: 5, Policy: settings.PeerLimitEvict},
+			claims: claims(map[string]interface{}{"max_peers": float64(1)}),
+			limit:  &types.PeerLimit{Max: 5, Evict: true},
+		},
+		{
+			name:   "entitled",
+			config: &settings.PeerLimitConfig{MaxPerUser: 5, Entitlement: "max_peers"},
+			claims: claims(map[string]interface{}{"max_peers": float64(2)}),
+			limit:  &types.PeerLimit{Max: 2},
+		},
+		{
+			name:   "entitled to none",
+			config: &settings.PeerLimitConfig{Entitlement: "max_peers"},
+			claims: claims(map[string]interface{}{"max_peers": float64(0)}),
+			limit:  &types.PeerLimit{Max: 0},
+		},
+		{
+			name:   "invalid entitlement",
+			config: &settings.PeerLimitConfig{MaxPerUser: 5, Entitlement: "max_peers"},
+			claims: claims(map[string]interface{}{"max_peers": "many"}),
+			limit:  &types.PeerLimit{Max: 0},
+		},
+	}
+
+	for _, cc := range cases {
+		tun := &TunnelAPI{runtime: &runtime.TunnelRuntime{Settings: &settings.Config{PeerLimit: cc.config}}}
+		require.Equal(t, cc.limit, tun.peerLimit(cc.claims), cc.name)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xhttp"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"github.com/vpnhouse/tunnel/internal/wireguard"
+)
+
+func exportPeerGroup(group *types.PeerGroup) peerGroup {
+	return peerGroup{
+		Id:              group.ID,
+		Name:            group.Name,
+		NetAccessPolicy: group.NetworkAccessPolicy,
+		RateLimit:       group.RateLimit,
+		Dns:             group.DNSServers(),
+		QuotaBytes:      group.QuotaBytes,
+		QuotaPeriod:     (*string)(group.QuotaPeriod),
+		ExpireSeconds:   group.ExpireSeconds,
+		Created:         group.Created.TimePtr(),
+		Updated:         group.Updated.TimePtr(),
+	}
+}
+
+func importPeerGroup(oGroup peerGroup, id int64) *types.PeerGroup {
+	group := &types.PeerGroup{
+		ID:                  id,
+		Name:                oGroup.Name,
+		NetworkAccessPolicy: oGroup.NetAccessPolicy,
+		RateLimit:           oGroup.RateLimit,
+		QuotaBytes:          oGroup.QuotaBytes,
+		QuotaPeriod:         (*types.QuotaPeriod)(oGroup.QuotaPeriod),
+		ExpireSeconds:       oGroup.ExpireSeconds,
+	}
+	if len(oGroup.Dns) > 0 {
+		dns := strings.Join(oGroup.Dns, ",")
+		group.DNS = &dns
+	}
+	return group
+}
+
+func getPeerGroupFromRequest(r *http.Request, id int64) (*types.PeerGroup, error) {
+	var oGroup peerGroup
+	if err := json.NewDecoder(r.Body).Decode(&oGroup); err != nil {
+		return nil, xerror.EInvalidArgument("invalid peer group", err)
+	}
+	return importPeerGroup(oGroup, id), nil
+}
+
+func groupIdFromRequest(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		return 0, xerror.EInvalidArgument("invalid peer group id", err)
+	}
+	return id, nil
+}
+
+// peerDNS returns the DNS servers to announce to the peer: the peer's own ones,
+// then the ones of the peer's group, then the interface settings.
+func (tun *TunnelAPI) peerDNS(peer *types.PeerInfo, settings wireguard.Config) ([]string, error) {
+	if servers := peer.DNSServers(); len(servers) > 0 {
+		return servers, nil
+	}
+	if peer.GroupId == nil {
+		return settings.DNS, nil
+	}
+
+	group, err := tun.storage.GetPeerGroup(*peer.GroupId)
+	if err != nil {
+		return nil, err
+	}
+	if servers := group.DNSServers(); len(servers) > 0 {
+		return servers, nil
+	}
+	return settings.DNS, nil
+}
+
+// AdminListPeerGroups implements GET method on /api/tunnel/admin/groups endpoint
+func (tun *TunnelAPI) AdminListPeerGroups(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		groups, err := tun.storage.ListPeerGroups()
+		if err != nil {
+			return nil, err
+		}
+
+		oGroups := make([]peerGroup, len(groups))
+		for i, group := range groups {
+			oGroups[i] = exportPeerGroup(group)
+		}
+		return oGroups, nil
+	})
+}
+
+// AdminGetPeerGroup implements GET method on /api/tunnel/admin/groups/{id} endpoint
+func (tun *TunnelAPI) AdminGetPeerGroup(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		id, err := groupIdFromRequest(r)
+		if err != nil {
+			return nil, err
+		}
+
+		group, err := tun.storage.GetPeerGroup(id)
+		if err != nil {
+			return nil, err
+		}
+		return exportPeerGroup(group), nil
+	})
+}
+
+// AdminCreatePeerGroup implements POST method on /api/tunnel/admin/groups endpoint
+func (tun *TunnelAPI) AdminCreatePeerGroup(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		group, err := getPeerGroupFromRequest(r, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		// no members yet, so nothing to apply
+		if _, err := tun.storage.CreatePeerGroup(group); err != nil {
+			return nil, err
+		}
+		return exportPeerGroup(group), nil
+	})
+}
+
+// AdminUpdatePeerGroup implements PUT method on /api/tunnel/admin/groups/{id} endpoint
+func (tun *TunnelAPI) AdminUpdatePeerGroup(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		id, err := groupIdFromRequest(r)
+		if err != nil {
+			return nil, err
+		}
+
+		group, err := getPeerGroupFromRequest(r, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tun.manager.UpdatePeerGroup(group); err != nil {
+			return nil, err
+		}
+
+		group, err = tun.storage.GetPeerGroup(id)
+		if err != nil {
+			return nil, err
+		}
+		return exportPeerGroup(group), nil
+	})
+}
+
+// AdminDeletePeerGroup implements DELETE method on /api/tunnel/admin/groups/{id} endpoint
+func (tun *TunnelAPI) AdminDeletePeerGroup(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		id, err := groupIdFromRequest(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tun.manager.DeletePeerGroup(id); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+}
@@ -35,6 +35,7 @@ type TunnelAPI struct {
 	keystore   keystore.Keystore
 	ippool     *ipam.IPAM
 	stats      *stats.Service
+	limiter    *requestLimiter // limits the unauthenticated requests
 	running    bool
 }
 
@@ -57,6 +58,7 @@ func NewTunnelHandlers(
 		keystore:   keystore,
 		ippool:     ip4am,
 		stats:      stats,
+		limiter:    newRequestLimiter(publicRequestsLimit, publicRequestsWindow),
 		running:    true,
 	}
 
@@ -75,6 +77,8 @@ func (tun *TunnelAPI) RegisterHandlers(r chi.Router) {
 			tun.versionRestrictionsMiddleware,
 		},
 	})
+	tun.registerAdminExtensions(r)
+	tun.registerPublicExtensions(r)
 
 	if tun.runtime.Features.WithPublicAPI() {
 		tunnelAPI.HandlerWithOptions(tun, tunnelAPI.ChiServerOptions{
@@ -92,6 +96,54 @@ func (tun *TunnelAPI) RegisterHandlers(r chi.Router) {
 	}
 }
 
+// registerAdminExtensions registers the admin API endpoints
+// which are not a part of the OpenAPI schema yet.
+func (tun *TunnelAPI) registerAdminExtensions(r chi.Router) {
+	middlewares := []adminAPI.MiddlewareFunc{
+		tun.adminAuthMiddleware,
+		tun.initialSetupMiddleware,
+		tun.versionRestrictionsMiddleware,
+	}
+	// wrap the handler the same way the generated router does
+	admin := func(handler http.HandlerFunc) http.HandlerFunc {
+		for _, middleware := range middlewares {
+			handler = middleware(handler)
+		}
+		return handler
+	}
+
+	r.Get("/api/tunnel/admin/quotas/users", admin(tun.AdminListUserQuotas))
+	r.Get("/api/tunnel/admin/quotas/users/{user_id}", admin(tun.AdminGetUserQuota))
+	r.Put("/api/tunnel/admin/quotas/users/{user_id}", admin(tun.AdminSetUserQuota))
+	r.Delete("/api/tunnel/admin/quotas/users/{user_id}", admin(tun.AdminDeleteUserQuota))
+
+	r.Get("/api/tunnel/admin/peers/shared", admin(tun.AdminListSharedPeers))
+	r.Delete("/api/tunnel/admin/peers/shared/{id}", admin(tun.AdminRevokeSharedPeer))
+
+	r.Get("/api/tunnel/admin/peers/{id}/traffic", admin(tun.AdminGetPeerTraffic))
+	r.Get("/api/tunnel/admin/peers/{id}/endpoints", admin(tun.AdminListPeerEndpoints))
+
+	r.Get("/api/tunnel/admin/leases", admin(tun.AdminFindIPLeases))
+
+	r.Get("/api/tunnel/admin/groups", admin(tun.AdminListPeerGroups))
+	r.Post("/api/tunnel/admin/groups", admin(tun.AdminCreatePeerGroup))
+	r.Get("/api/tunnel/admin/groups/{id}", admin(tun.AdminGetPeerGroup))
+	r.Put("/api/tunnel/admin/groups/{id}", admin(tun.AdminUpdatePeerGroup))
+	r.Delete("/api/tunnel/admin/groups/{id}", admin(tun.AdminDeletePeerGroup))
+
+	r.Get("/api/tunnel/admin/wireguard/drift", admin(tun.AdminWireguardDrift))
+
+	r.Get("/api/tunnel/admin/invites", admin(tun.AdminListInvites))
+	r.Post("/api/tunnel/admin/invites", admin(tun.AdminCreateInvite))
+	r.Get("/api/tunnel/admin/invites/{id}/peers", admin(tun.AdminListInvitePeers))
+}
+
+// registerPublicExtensions registers the unauthenticated endpoints
+// which are not a part of the OpenAPI schema yet.
+func (tun *TunnelAPI) registerPublicExtensions(r chi.Router) {
+	r.Post("/api/tunnel/public/invites/{code}", tun.limiter.middleware(tun.PublicRedeemInvite))
+}
+
 func (tun *TunnelAPI) addStaticHandler(r chi.Router) {
 	staticRoot := frontend.StaticRoot
 	if tun.runtime.Settings.AdminAPI != nil && len(tun.runtime.Settings.AdminAPI.StaticRoot) > 0 {
@@ -8,6 +8,7 @@ import (
 	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
@@ -22,6 +23,7 @@ import (
 	"github.com/vpnhouse/common-lib-go/xtime"
 	"github.com/vpnhouse/tunnel/internal/types"
 	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
 )
 
 const (
@@ -134,11 +136,11 @@ func (tun *TunnelAPI) federationAuthMiddleware(next http.HandlerFunc) http.Handl
 	}
 }
 
-func (tun *TunnelAPI) exportPeer(peer *types.PeerInfo) (adminAPI.Peer, error) {
+func (tun *TunnelAPI) exportPeer(peer *types.PeerInfo) (adminPeer, error) {
 	// Validate peer
 	err := peer.Validate()
 	if err != nil {
-		return adminAPI.Peer{}, err
+		return adminPeer{}, err
 	}
 
 	// Handle wireguard information
@@ -151,7 +153,7 @@ func (tun *TunnelAPI) exportPeer(peer *types.PeerInfo) (adminAPI.Peer, error) {
 
 	runtimePeerStat := tun.manager.GetRuntimePeerStat(peer)
 
-	oPeer := adminAPI.Peer{
+	oPeer := adminPeer{Peer: adminAPI.Peer{
 		Label:            peer.Label,
 		Ipv4:             &ip,
 		InfoWireguard:    wg,
@@ -167,23 +169,59 @@ func (tun *TunnelAPI) exportPeer(peer *types.PeerInfo) (adminAPI.Peer, error) {
 		TrafficDown:      peer.Downstream,
 		TrafficUpSpeed:   &runtimePeerStat.UpstreamSpeed,
 		TrafficDownSpeed: &runtimePeerStat.DownstreamSpeed,
+	}}
+
+	// Handle optional ipv6 address
+	if peer.Ipv6 != nil && peer.Ipv6.IP != nil {
+		ip6 := peer.Ipv6.String()
+		oPeer.Ipv6 = &ip6
+	}
+
+	// Handle the wireguard interface, nil stands for the primary one
+	oPeer.Interface = peer.WireguardInterface
+	oPeer.GroupId = peer.GroupId
+	oPeer.PresharedKey = peer.PresharedKey
+	oPeer.Routes = (*string)(peer.Routes)
+	if subnets := peer.Subnets(); len(subnets) > 0 {
+		routed := make([]string, 0, len(subnets))
+		for _, subnet := range subnets {
+			routed = append(routed, subnet.String())
+		}
+		oPeer.RoutedSubnets = &routed
+	}
+	if servers := peer.DNSServers(); len(servers) > 0 {
+		oPeer.Dns = &servers
+	}
+
+	// Handle liveness
+	oPeer.Handshake = peer.Handshake.TimePtr()
+	oPeer.Endpoint = peer.Endpoint
+	oPeer.Online = peer.Online(time.Now())
+
+	// Handle traffic quota
+	if peer.HasQuota() {
+		oPeer.QuotaBytes = peer.QuotaBytes
+		oPeer.QuotaPeriod = (*string)(peer.QuotaPeriod)
+		oPeer.QuotaUsed = peer.QuotaUsed
+		oPeer.QuotaRemaining = peer.QuotaRemaining()
+		oPeer.QuotaReset = peer.QuotaReset.TimePtr()
 	}
 
 	return oPeer, nil
 }
 
-func (tun *TunnelAPI) getPeerForSerialization(id int64) (adminAPI.PeerRecord, error) {
+func (tun *TunnelAPI) getPeerForSerialization(id int64) (adminPeerRecord, error) {
 	insertedPeer, err := tun.storage.GetPeer(id)
 	if err != nil {
-		return adminAPI.PeerRecord{}, err
+		return adminPeerRecord{}, err
 	}
 
 	oPeer, err := tun.exportPeer(insertedPeer)
 	if err != nil {
-		return adminAPI.PeerRecord{}, err
+		return adminPeerRecord{}, err
 	}
 
-	record := adminAPI.PeerRecord{
+	record := adminPeerRecord{
 		Id:   id,
 		Peer: oPeer,
 	}
@@ -262,6 +300,85 @@ func importPeer(oPeer adminAPI.Peer, id int64) (types.PeerInfo, error) {
 	return peer, nil
 }
 
+// importAdminPeer generates internal representation of a peer from the extended openapi representation
+func importAdminPeer(oPeer adminPeer, id int64) (types.PeerInfo, error) {
+	peer, err := importPeer(oPeer.Peer, id)
+	if err != nil {
+		return types.PeerInfo{}, err
+	}
+
+	// Handle optional peer ipv6 address
+	if oPeer.Ipv6 != nil && len(*oPeer.Ipv6) > 0 {
+		ip6 := xnet.ParseIP(*oPeer.Ipv6)
+		if ip6.IP == nil || ip6.Isv4() {
+			return types.PeerInfo{}, xerror.EInvalidArgument("invalid ipv6 format", nil, zap.Any("oPeer", oPeer))
+		}
+		peer.Ipv6 = &ip6
+	}
+
+	if oPeer.Interface != nil && len(*oPeer.Interface) > 0 {
+		peer.WireguardInterface = oPeer.Interface
+	}
+	peer.GroupId = oPeer.GroupId
+
+	// Handle optional preshared key
+	if oPeer.GeneratePresharedKey {
+		psk, err := generatePresharedKey()
+		if err != nil {
+			return types.PeerInfo{}, err
+		}
+		peer.PresharedKey = &psk
+	} else if oPeer.PresharedKey != nil {
+		if len(*oPeer.PresharedKey) > 0 {
+			if _, err := wgtypes.ParseKey(*oPeer.PresharedKey); err != nil {
+				return types.PeerInfo{}, xerror.EInvalidField("invalid preshared key", "preshared_key", err)
+			}
+		}
+		peer.PresharedKey = oPeer.PresharedKey
+	}
+
+	peer.Routes = (*types.ClientRoutes)(oPeer.Routes)
+
+	// Handle routed subnets, the empty list removes them
+	if oPeer.RoutedSubnets != nil {
+		subnets, err := types.ParseSubnets(strings.Join(*oPeer.RoutedSubnets, ","))
+		if err != nil {
+			return types.PeerInfo{}, err
+		}
+		routed := make([]string, 0, len(subnets))
+		for _, subnet := range subnets {
+			routed = append(routed, subnet.String())
+		}
+		joined := strings.Join(routed, ",")
+		peer.RoutedSubnets = &joined
+	}
+
+	// Handle DNS servers, the empty list removes them
+	if oPeer.Dns != nil {
+		dns := strings.Join(*oPeer.Dns, ",")
+		peer.DNS = &dns
+	}
+
+	peer.QuotaBytes = oPeer.QuotaBytes
+	if oPeer.QuotaPeriod != nil {
+		period := types.QuotaPeriod(*oPeer.QuotaPeriod)
+		if err := period.Validate(); err != nil {
+			return types.PeerInfo{}, err
+		}
+		peer.QuotaPeriod = &period
+	}
+
+	return peer, nil
+}
+
+func generatePresharedKey() (string, error) {
+	key, err := wgtypes.GenerateKey()
+	if err != nil {
+		return "", xerror.EInternalError("can't generate preshared key", err)
+	}
+	return key.String(), nil
+}
+
 func validateClientIdentifiers(identifiers *commonAPI.ConnectionIdentifiers) error {
 	if identifiers == nil {
 		return xerror.EInvalidArgument("identifiers are not set", nil)
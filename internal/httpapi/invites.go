@@ -0,0 +1,187 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	tunnelAPI "github.com/vpnhouse/api/go/server/tunnel"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xhttp"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// inviteCodeAlphabet skips the look-alike symbols, the codes are typed by hand
+const (
+	inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	inviteCodeLength   = 10
+)
+
+func exportInvite(inv *types.Invite) invite {
+	return invite{
+		Id:                inv.ID,
+		Code:              inv.Code,
+		Label:             inv.Label,
+		MaxRedemptions:    inv.MaxRedemptions,
+		Expires:           inv.Expires.TimePtr(),
+		NetAccessPolicy:   inv.NetworkAccessPolicy,
+		RateLimit:         inv.RateLimit,
+		QuotaBytes:        inv.QuotaBytes,
+		QuotaPeriod:       (*string)(inv.QuotaPeriod),
+		PeerExpireSeconds: inv.PeerExpireSeconds,
+		Redemptions:       inv.Redemptions,
+		Created:           inv.Created.TimePtr(),
+	}
+}
+
+func importInvite(oInvite invite) *types.Invite {
+	return &types.Invite{
+		Code:                oInvite.Code,
+		Label:               oInvite.Label,
+		MaxRedemptions:      oInvite.MaxRedemptions,
+		Expires:             xtime.FromTimePtr(oInvite.Expires),
+		NetworkAccessPolicy: oInvite.NetAccessPolicy,
+		RateLimit:           oInvite.RateLimit,
+		QuotaBytes:          oInvite.QuotaBytes,
+		QuotaPeriod:         (*types.QuotaPeriod)(oInvite.QuotaPeriod),
+		PeerExpireSeconds:   oInvite.PeerExpireSeconds,
+	}
+}
+
+func generateInviteCode() (string, error) {
+	b := make([]byte, inviteCodeLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", xerror.EInternalError("can't generate invite code", err)
+	}
+	for i := range b {
+		b[i] = inviteCodeAlphabet[int(b[i])%len(inviteCodeAlphabet)]
+	}
+	return string(b), nil
+}
+
+// AdminListInvites implements GET method on /api/tunnel/admin/invites endpoint
+func (tun *TunnelAPI) AdminListInvites(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		invites, err := tun.storage.ListInvites()
+		if err != nil {
+			return nil, err
+		}
+
+		oInvites := make([]invite, len(invites))
+		for i, inv := range invites {
+			oInvites[i] = exportInvite(inv)
+		}
+		return oInvites, nil
+	})
+}
+
+// AdminCreateInvite implements POST method on /api/tunnel/admin/invites endpoint
+func (tun *TunnelAPI) AdminCreateInvite(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		var oInvite invite
+		if err := json.NewDecoder(r.Body).Decode(&oInvite); err != nil {
+			return nil, xerror.EInvalidArgument("invalid invite", err)
+		}
+
+		inv := importInvite(oInvite)
+		if len(inv.Code) == 0 {
+			code, err := generateInviteCode()
+			if err != nil {
+				return nil, err
+			}
+			inv.Code = code
+		}
+
+		if _, err := tun.storage.CreateInvite(inv); err != nil {
+			return nil, err
+		}
+		return exportInvite(inv), nil
+	})
+}
+
+// AdminListInvitePeers implements GET method on /api/tunnel/admin/invites/{id}/peers endpoint,
+// it lists every redemption of the invite along with the peer if it still exists.
+func (tun *TunnelAPI) AdminListInvitePeers(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			return nil, xerror.EInvalidArgument("invalid invite id", err)
+		}
+
+		// make sure the invite exists
+		if _, err := tun.storage.GetInvite(id); err != nil {
+			return nil, err
+		}
+
+		redemptions, err := tun.storage.ListInviteRedemptions(id)
+		if err != nil {
+			return nil, err
+		}
+
+		peers, err := tun.manager.InvitePeers(id)
+		if err != nil {
+			return nil, err
+		}
+		byId := make(map[int64]*types.PeerInfo, len(peers))
+		for _, peer := range peers {
+			byId[peer.ID] = peer
+		}
+
+		records := make([]inviteRedemption, 0, len(redemptions))
+		for _, redemption := range redemptions {
+			record := inviteRedemption{
+				Id:           redemption.ID,
+				PeerId:       redemption.PeerId,
+				WireguardKey: redemption.WireguardPublicKey,
+				Created:      redemption.Created.TimePtr(),
+			}
+			if redemption.Ipv4 != nil {
+				record.Ipv4 = redemption.Ipv4.String()
+			}
+			if peer, ok := byId[redemption.PeerId]; ok {
+				oPeer, err := tun.exportPeer(peer)
+				if err != nil {
+					return nil, err
+				}
+				record.Peer = &oPeer
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	})
+}
+
+// PublicRedeemInvite implements POST method on /api/tunnel/public/invites/{code} endpoint,
+// the device gets its own peer the same way as on the shared peer activation.
+func (tun *TunnelAPI) PublicRedeemInvite(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		var wgPeer tunnelAPI.PeerWireguard
+		if err := json.NewDecoder(r.Body).Decode(&wgPeer); err != nil {
+			return nil, xerror.EInvalidArgument("failed to decode given JSON body", err)
+		}
+
+		if wgPeer.PublicKey == nil || len(*wgPeer.PublicKey) == 0 {
+			return nil, xerror.EInvalidField("wireguard_key: required field", "wireguard_key", nil)
+		}
+
+		pubkey := *wgPeer.PublicKey
+		if _, err := wgtypes.ParseKey(pubkey); err != nil {
+			return nil, xerror.EInvalidField("wireguard_key: invalid key given", "wireguard_key", nil)
+		}
+
+		peer, err := tun.manager.RedeemInvite(chi.URLParam(r, "code"), pubkey)
+		if err != nil {
+			return nil, err
+		}
+
+		return tun.peerActivation(peer)
+	})
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xhttp"
+)
+
+const (
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// AdminFindIPLeases implements GET method on /api/tunnel/admin/leases endpoint.
+// Looks up who held the IP address, at the given moment if any.
+func (tun *TunnelAPI) AdminFindIPLeases(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		values := r.URL.Query()
+
+		ip := net.ParseIP(values.Get("ip"))
+		if ip == nil {
+			return nil, xerror.EInvalidField("invalid ip address", "ip", nil)
+		}
+
+		var at *time.Time
+		if v := values.Get("at"); len(v) > 0 {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, xerror.EInvalidField("invalid time, want RFC3339", "at", err)
+			}
+			at = &t
+		}
+
+		limit, err := historyLimitFromRequest(r)
+		if err != nil {
+			return nil, err
+		}
+
+		leases, err := tun.storage.FindIPLeases(ip.String(), at, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		oLeases := make([]ipLease, len(leases))
+		for i, lease := range leases {
+			oLeases[i] = ipLease{
+				Ip:             lease.IP,
+				PeerId:         lease.PeerId,
+				UserId:         lease.UserId,
+				InstallationId: lease.InstallationId,
+				WireguardKey:   lease.WireguardKey,
+				Started:        lease.Started.TimePtr(),
+				Ended:          lease.Ended.TimePtr(),
+			}
+		}
+		return oLeases, nil
+	})
+}
+
+// AdminListPeerEndpoints implements GET method on /api/tunnel/admin/peers/{id}/endpoints endpoint.
+// Returns the endpoints the peer has connected from, the latest go first.
+func (tun *TunnelAPI) AdminListPeerEndpoints(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			return nil, xerror.EInvalidArgument("invalid peer id", err)
+		}
+
+		limit, err := historyLimitFromRequest(r)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoints, err := tun.storage.ListPeerEndpoints(id, limit)
+		if err != nil {
+			return nil, err
+		}
+
+		oEndpoints := make([]peerEndpoint, len(endpoints))
+		for i, endpoint := range endpoints {
+			oEndpoints[i] = peerEndpoint{
+				Endpoint: endpoint.Endpoint,
+				Country:  endpoint.Country,
+				Seen:     endpoint.Seen.TimePtr(),
+			}
+		}
+		return oEndpoints, nil
+	})
+}
+
+func historyLimitFromRequest(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if len(v) == 0 {
+		return defaultHistoryLimit, nil
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil || limit <= 0 || limit > maxHistoryLimit {
+		return 0, xerror.EInvalidField("page size is out of range", "limit", err)
+	}
+	return limit, nil
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	// publicRequestsLimit is the number of requests to the unauthenticated endpoints
+	// allowed from the single address within publicRequestsWindow
+	publicRequestsLimit  = 10
+	publicRequestsWindow = time.Minute
+)
+
+// requestLimiter limits the number of requests per client address within the fixed window,
+// it keeps the unauthenticated endpoints from guessing the codes, e.g the invite ones.
+type requestLimiter struct {
+	lock    sync.Mutex
+	limit   int
+	window  time.Duration
+	started time.Time
+	counts  map[string]int
+}
+
+func newRequestLimiter(limit int, window time.Duration) *requestLimiter {
+	return &requestLimiter{
+		limit:  limit,
+		window: window,
+		counts: make(map[string]int),
+	}
+}
+
+// allow counts the request from the address, false if the address has exceeded the limit
+func (limiter *requestLimiter) allow(addr string, now time.Time) bool {
+	limiter.lock.Lock()
+	defer limiter.lock.Unlock()
+
+	if now.Sub(limiter.started) >= limiter.window {
+		limiter.started = now
+		limiter.counts = make(map[string]int)
+	}
+
+	limiter.counts[addr]++
+	return limiter.counts[addr] <= limiter.limit
+}
+
+func (limiter *requestLimiter) middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addr, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			addr = r.RemoteAddr
+		}
+
+		if !limiter.allow(addr, time.Now()) {
+			zap.L().Debug("too many requests", zap.String("addr", addr), zap.String("path", r.URL.Path))
+			xhttp.WriteJsonError(w, xerror.ENLimitExceeded("too many requests, try again later"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newRequestLimiter(2, time.Minute)
+
+	cases := []struct {
+		addr  string
+		at    time.Duration
+		allow bool
+	}{
+		{addr: "192.0.2.1", allow: true},
+		{addr: "192.0.2.1", at: time.Second, allow: true},
+		{addr: "192.0.2.1", at: 2 * time.Second, allow: false},
+		{addr: "192.0.2.2", at: 3 * time.Second, allow: true},
+		{addr: "192.0.2.1", at: time.Minute, allow: true},
+	}
+
+	for i, cc := range cases {
+		require.Equal(t, cc.allow, limiter.allow(cc.addr, now.Add(cc.at)), "request %d", i)
+	}
+}
+
+func TestRequestLimiterMiddleware(t *testing.T) {
+	limiter := newRequestLimiter(1, time.Minute)
+	handler := limiter.middleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	request := func(remoteAddr string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/tunnel/public/invites/CODE", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, request("192.0.2.1:1000"))
+	require.NotEqual(t, http.StatusOK, request("192.0.2.1:2000"), "the port must not matter")
+	require.Equal(t, http.StatusOK, request("192.0.2.2:1000"))
+}
@@ -6,7 +6,9 @@ package httpapi
 
 import (
 	"encoding/json"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,26 +21,140 @@ import (
 )
 
 // getPeerFromRequest parses peer information from request body.
+// Returns the private key if the keypair generation is requested.
 // WARNING! This function does not do any verification of imported data! Caller must do it itself!
-func getPeerFromRequest(r *http.Request, id int64) (types.PeerInfo, error) {
-	var peer adminAPI.Peer
+func getPeerFromRequest(r *http.Request, id int64) (types.PeerInfo, *wgtypes.Key, error) {
+	var peer adminPeer
 	if err := json.NewDecoder(r.Body).Decode(&peer); err != nil {
-		return types.PeerInfo{}, xerror.EInvalidArgument("invalid peer info", err)
+		return types.PeerInfo{}, nil, xerror.EInvalidArgument("invalid peer info", err)
 	}
 
-	return importPeer(peer, id)
+	var privateKey *wgtypes.Key
+	if peer.GenerateKeypair {
+		if peer.InfoWireguard != nil && peer.InfoWireguard.PublicKey != nil {
+			return types.PeerInfo{}, nil, xerror.EInvalidField("public key must not be set to generate the keypair", "generate_keypair", nil)
+		}
+
+		key, err := wgtypes.GeneratePrivateKey()
+		if err != nil {
+			return types.PeerInfo{}, nil, xerror.EInternalError("can't generate private key", err)
+		}
+		publicKey := key.PublicKey().String()
+		peer.InfoWireguard = &tunnelAPI.PeerWireguard{PublicKey: &publicKey}
+		privateKey = &key
+	}
+
+	info, err := importAdminPeer(peer, id)
+	if err != nil {
+		return types.PeerInfo{}, nil, err
+	}
+	return info, privateKey, nil
+}
+
+const (
+	totalCountHeader = "X-Total-Count"
+	nextCursorHeader = "X-Next-Cursor"
+)
+
+// getPeerQueryFromRequest parses the peers list query parameters
+func getPeerQueryFromRequest(r *http.Request) (*types.PeerQuery, error) {
+	values := r.URL.Query()
+	query := &types.PeerQuery{
+		Search: values.Get("search"),
+		State:  types.PeerState(values.Get("state")),
+		Sort:   values.Get("sort"),
+		Cursor: values.Get("cursor"),
+	}
+
+	if ip := values.Get("ip"); len(ip) > 0 {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return nil, xerror.EInvalidField("invalid ip address", "ip", nil)
+		}
+		query.IP = parsed.String()
+	}
+
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return nil, xerror.EInvalidField("unknown sort order, want asc or desc", "order", nil)
+	}
+
+	for param, dst := range map[string]**time.Time{
+		"activity_from": &query.ActivityFrom,
+		"activity_to":   &query.ActivityTo,
+	} {
+		if v := values.Get(param); len(v) > 0 {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, xerror.EInvalidField("invalid time, want RFC3339", param, err)
+			}
+			*dst = &t
+		}
+	}
+
+	if v := values.Get("limit"); len(v) > 0 {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, xerror.EInvalidField("invalid page size", "limit", err)
+		}
+		query.Limit = limit
+	}
+
+	return query, query.Validate()
 }
 
-// AdminListPeers implements GET method on /api/admin/peers endpoint
+// withClientConfig adds the client configuration to the peer record if the keypair has been generated.
+// The private key is never stored, so the configuration is available only once.
+func (tun *TunnelAPI) withClientConfig(record adminPeerRecord, peer *types.PeerInfo, privateKey *wgtypes.Key) (interface{}, error) {
+	if privateKey == nil {
+		return record, nil
+	}
+
+	settings, err := tun.wireguardSettings(peer.WireguardInterface)
+	if err != nil {
+		return nil, err
+	}
+
+	config := newWgQuickConfig(settings, peer, *privateKey)
+	config.AllowedIPs = tun.runtime.Settings.GetClientRoutes(peer).AllowedIPs(peer.Ipv6 != nil && peer.Ipv6.IP != nil)
+	config.DNS, err = tun.peerDNS(peer, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	qr, err := config.QRCode()
+	if err != nil {
+		return nil, err
+	}
+
+	return adminPeerConfig{
+		adminPeerRecord: record,
+		Config:          config.String(),
+		ConfigQR:        qr,
+	}, nil
+}
+
+// AdminListPeers implements GET method on /api/admin/peers endpoint.
+// The optional query parameters filter, sort and paginate the list,
+// the total count and the next page cursor are returned in the headers.
 func (tun *TunnelAPI) AdminListPeers(w http.ResponseWriter, r *http.Request) {
 	xhttp.JSONResponse(w, func() (interface{}, error) {
-		peers, err := tun.manager.ListPeers()
+		query, err := getPeerQueryFromRequest(r)
 		if err != nil {
 			return nil, err
 		}
 
-		foundPeers := make([]adminAPI.PeerRecord, len(peers))
-		for i, peer := range peers {
+		// served right from the storage, so the manager is not locked
+		page, err := tun.storage.ListPeers(query)
+		if err != nil {
+			return nil, err
+		}
+
+		foundPeers := make([]adminPeerRecord, len(page.Peers))
+		for i, peer := range page.Peers {
 			oPeer, err := tun.exportPeer(peer)
 			if err != nil {
 				return nil, err
@@ -47,6 +163,10 @@ func (tun *TunnelAPI) AdminListPeers(w http.ResponseWriter, r *http.Request) {
 			foundPeers[i].Peer = oPeer
 		}
 
+		w.Header().Set(totalCountHeader, strconv.FormatInt(page.Total, 10))
+		if len(page.NextCursor) > 0 {
+			w.Header().Set(nextCursorHeader, page.NextCursor)
+		}
 		return foundPeers, nil
 	})
 }
@@ -74,7 +194,7 @@ func (tun *TunnelAPI) AdminGetPeer(w http.ResponseWriter, r *http.Request, id in
 			return nil, err
 		}
 
-		info := adminAPI.PeerRecord{
+		info := adminPeerRecord{
 			Id:   id,
 			Peer: exported,
 		}
@@ -86,7 +206,7 @@ func (tun *TunnelAPI) AdminGetPeer(w http.ResponseWriter, r *http.Request, id in
 // AdminCreatePeer implements POST method on /api/admin/peers endpoint
 func (tun *TunnelAPI) AdminCreatePeer(w http.ResponseWriter, r *http.Request) {
 	xhttp.JSONResponse(w, func() (interface{}, error) {
-		peer, err := getPeerFromRequest(r, 0)
+		peer, privateKey, err := getPeerFromRequest(r, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -100,38 +220,57 @@ func (tun *TunnelAPI) AdminCreatePeer(w http.ResponseWriter, r *http.Request) {
 			return nil, err
 		}
 
-		return tun.getPeerForSerialization(peer.ID)
+		record, err := tun.getPeerForSerialization(peer.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		return tun.withClientConfig(record, &peer, privateKey)
 	})
 }
 
 // AdminCreateSharedPeer implements POST method on /api/admin/peers/shared endpoint
 func (tun *TunnelAPI) AdminCreateSharedPeer(w http.ResponseWriter, r *http.Request) {
 	xhttp.JSONResponse(w, func() (interface{}, error) {
-		peer, err := getPeerFromRequest(r, 0)
-		if err != nil {
-			return nil, err
+		var oPeer adminSharedPeer
+		if err := json.NewDecoder(r.Body).Decode(&oPeer); err != nil {
+			return nil, xerror.EInvalidArgument("invalid peer info", err)
+		}
+		if oPeer.GenerateKeypair {
+			return nil, xerror.EInvalidField("shared peer gets the public key on the activation", "generate_keypair", nil)
 		}
 
-		ipa, err := tun.ippool.Alloc(peer.GetNetworkPolicy())
+		ttl := types.DefaultSharingTTL
+		if oPeer.TtlSeconds != nil {
+			if *oPeer.TtlSeconds <= 0 {
+				return nil, xerror.EInvalidField("link lifetime must be positive", "ttl_seconds", nil)
+			}
+			ttl = time.Duration(*oPeer.TtlSeconds) * time.Second
+		}
+		maxActivations := 1
+		if oPeer.MaxActivations != nil {
+			if *oPeer.MaxActivations < 0 {
+				return nil, xerror.EInvalidField("max activations must not be negative", "max_activations", nil)
+			}
+			maxActivations = *oPeer.MaxActivations
+		}
+
+		peer, err := importAdminPeer(oPeer.adminPeer, 0)
 		if err != nil {
 			return nil, err
 		}
-		peer.Ipv4 = &ipa
-
-		sk := uuid.New().String()
-		tx := time.Now().Add(24 * time.Hour).Unix()
+		peer.Share(uuid.New().String(), ttl, maxActivations)
 
-		peer.SharingKey = &sk
-		peer.SharingKeyExpiration = &tx
-		if _, err := tun.storage.CreatePeer(peer); err != nil {
+		if err := peer.Validate("ID", "Ipv4"); err != nil {
 			return nil, err
 		}
 
-		url := tun.runtime.Settings.PublicURL()
-		link := adminAPI.PeerLink{
-			Link: url + "/public/shared/" + sk,
+		// the addresses are reserved until the link expires
+		if err := tun.manager.SetPeer(&peer); err != nil {
+			return nil, err
 		}
-		return link, nil
+
+		return tun.exportSharedLink(&peer), nil
 	})
 }
 
@@ -151,23 +290,39 @@ func (tun *TunnelAPI) PublicPeerActivate(w http.ResponseWriter, r *http.Request,
 			return nil, xerror.EInvalidField("wireguard_key: invalid key given", "wireguard_key", nil)
 		}
 
-		peerID, err := tun.storage.ActivateSharedPeer(slug, pubkey)
-		if err != nil {
-			return nil, err
-		}
-
-		fullPeer, err := tun.getPeerForSerialization(peerID)
+		peer, err := tun.manager.ActivateSharedPeer(slug, pubkey)
 		if err != nil {
 			return nil, err
 		}
 
-		return adminAPI.PeerActivationResponse{
-			Peer:             fullPeer,
-			WireguardOptions: wireguardConnectionInfo(tun.runtime.Settings.Wireguard),
-		}, nil
+		return tun.peerActivation(peer)
 	})
 }
 
+// peerActivation prepares the connection options of the peer activated by the device
+func (tun *TunnelAPI) peerActivation(peer *types.PeerInfo) (peerActivationResponse, error) {
+	fullPeer, err := tun.getPeerForSerialization(peer.ID)
+	if err != nil {
+		return peerActivationResponse{}, err
+	}
+
+	settings, err := tun.wireguardSettings(peer.WireguardInterface)
+	if err != nil {
+		return peerActivationResponse{}, err
+	}
+
+	options := wireguardConnectionInfo(settings, tun.runtime.Settings.GetClientRoutes(peer))
+	options.Dns, err = tun.peerDNS(peer, settings)
+	if err != nil {
+		return peerActivationResponse{}, err
+	}
+
+	return peerActivationResponse{
+		Peer:             fullPeer,
+		WireguardOptions: options,
+	}, nil
+}
+
 func (tun *TunnelAPI) PublicPeerStatus(w http.ResponseWriter, r *http.Request, slug string) {
 	xhttp.JSONResponse(w, func() (interface{}, error) {
 		peer, err := tun.storage.GetPeerBySharingKey(slug)
@@ -175,27 +330,21 @@ func (tun *TunnelAPI) PublicPeerStatus(w http.ResponseWriter, r *http.Request, s
 			return nil, err
 		}
 
-		status := adminAPI.PeerActivationStatusNotActivated
-		if peer.SharingKeyExpiration != nil {
-			t := *peer.SharingKeyExpiration
-			now := time.Now().Unix()
-			if t > 0 && t < now {
-				return nil, xerror.EEntryNotFound("peer has already been expired", nil)
-			}
-
-			if t < 0 {
-				status = adminAPI.PeerActivationStatusActivated
-			}
+		if peer.SharingActivated() {
+			return adminAPI.PeerActivation{Status: adminAPI.PeerActivationStatusActivated}, nil
+		}
+		if peer.SharingExpired(time.Now()) {
+			return nil, xerror.EEntryNotFound("peer has already been expired", nil)
 		}
 
-		return adminAPI.PeerActivation{Status: status}, nil
+		return adminAPI.PeerActivation{Status: adminAPI.PeerActivationStatusNotActivated}, nil
 	})
 }
 
 // AdminUpdatePeer implements PUT method on /api/admin/peers/{id} endpoint
 func (tun *TunnelAPI) AdminUpdatePeer(w http.ResponseWriter, r *http.Request, id int64) {
 	xhttp.JSONResponse(w, func() (interface{}, error) {
-		peer, err := getPeerFromRequest(r, id)
+		peer, privateKey, err := getPeerFromRequest(r, id)
 		if err != nil {
 			return nil, err
 		}
@@ -219,11 +368,11 @@ func (tun *TunnelAPI) AdminUpdatePeer(w http.ResponseWriter, r *http.Request, id
 			return nil, err
 		}
 
-		info := adminAPI.PeerRecord{
+		info := adminPeerRecord{
 			Id:   id,
 			Peer: exported,
 		}
 
-		return info, nil
+		return tun.withClientConfig(info, insertedPeer, privateKey)
 	})
 }
@@ -0,0 +1,52 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/tunnel/internal/manager"
+	"github.com/vpnhouse/tunnel/internal/runtime"
+	"github.com/vpnhouse/tunnel/internal/settings"
+	"github.com/vpnhouse/tunnel/internal/stats"
+	"github.com/vpnhouse/tunnel/internal/storage"
+)
+
+// newTestTunnelAPI runs the manager without wireguard interfaces,
+// so it has no peers to restore and sync.
+func newTestTunnelAPI(t *testing.T) *TunnelAPI {
+	db, err := storage.New(filepath.Join(t.TempDir(), "db.sqlite3"), bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Shutdown() })
+
+	statsService := stats.NewService(nil, nil, db)
+	t.Cleanup(func() { _ = statsService.Shutdown() })
+
+	rt := &runtime.TunnelRuntime{Settings: &settings.Config{}}
+	peers, err := manager.New(rt, db, nil, statsService, nil, nil)
+	require.NoError(t, err)
+
+	return &TunnelAPI{runtime: rt, manager: peers, storage: db}
+}
+
+func TestAdminGetPeer(t *testing.T) {
+	tun := newTestTunnelAPI(t)
+
+	// unknown peer
+	w := httptest.NewRecorder()
+	tun.AdminGetPeer(w, httptest.NewRequest(http.MethodGet, "/api/tunnel/admin/peers/42", nil), 42)
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	// the manager is shutting down
+	require.NoError(t, tun.manager.Shutdown())
+	w = httptest.NewRecorder()
+	tun.AdminGetPeer(w, httptest.NewRequest(http.MethodGet, "/api/tunnel/admin/peers/42", nil), 42)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code, w.Body.String())
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xhttp"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+func exportUserQuota(quota *types.UserQuota) userQuota {
+	return userQuota{
+		UserId:         quota.UserId,
+		QuotaBytes:     quota.QuotaBytes,
+		QuotaPeriod:    string(quota.QuotaPeriod),
+		QuotaUsed:      quota.QuotaUsed,
+		QuotaRemaining: quota.Remaining(),
+		QuotaReset:     quota.QuotaReset.TimePtr(),
+	}
+}
+
+// AdminListUserQuotas implements GET method on /api/tunnel/admin/quotas/users endpoint
+func (tun *TunnelAPI) AdminListUserQuotas(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		quotas, err := tun.storage.ListUserQuotas()
+		if err != nil {
+			return nil, err
+		}
+
+		oQuotas := make([]userQuota, len(quotas))
+		for i, quota := range quotas {
+			oQuotas[i] = exportUserQuota(quota)
+		}
+		return oQuotas, nil
+	})
+}
+
+// AdminGetUserQuota implements GET method on /api/tunnel/admin/quotas/users/{user_id} endpoint
+func (tun *TunnelAPI) AdminGetUserQuota(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		userId := chi.URLParam(r, "user_id")
+		quota, err := tun.storage.FindUserQuota(userId)
+		if err != nil {
+			return nil, err
+		}
+		if quota == nil {
+			return nil, xerror.EEntryNotFound("no quota set for the user", nil, zap.String("user_id", userId))
+		}
+
+		return exportUserQuota(quota), nil
+	})
+}
+
+// AdminSetUserQuota implements PUT method on /api/tunnel/admin/quotas/users/{user_id} endpoint
+func (tun *TunnelAPI) AdminSetUserQuota(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		var oQuota userQuota
+		if err := json.NewDecoder(r.Body).Decode(&oQuota); err != nil {
+			return nil, xerror.EInvalidArgument("invalid user quota", err)
+		}
+
+		userId := chi.URLParam(r, "user_id")
+		quota := &types.UserQuota{
+			UserId:      userId,
+			QuotaBytes:  oQuota.QuotaBytes,
+			QuotaPeriod: types.QuotaPeriod(oQuota.QuotaPeriod),
+		}
+		if err := tun.storage.SetUserQuota(quota); err != nil {
+			return nil, err
+		}
+
+		quota, err := tun.storage.FindUserQuota(userId)
+		if err != nil {
+			return nil, err
+		}
+		return exportUserQuota(quota), nil
+	})
+}
+
+// AdminDeleteUserQuota implements DELETE method on /api/tunnel/admin/quotas/users/{user_id} endpoint
+func (tun *TunnelAPI) AdminDeleteUserQuota(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		if err := tun.storage.DeleteUserQuota(chi.URLParam(r, "user_id")); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+}
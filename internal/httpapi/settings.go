@@ -95,6 +95,7 @@ func (tun *TunnelAPI) AdminUpdateSettings(w http.ResponseWriter, r *http.Request
 			return nil, err
 		}
 
+		before := restartFingerprint(tun.runtime.Settings)
 		if err := tun.mergeStaticSettings(tun.runtime, newSettings); err != nil {
 			return nil, err
 		}
@@ -103,7 +104,11 @@ func (tun *TunnelAPI) AdminUpdateSettings(w http.ResponseWriter, r *http.Request
 			return nil, err
 		}
 
-		tun.runtime.Events.EmitEvent(control.EventRestart)
+		// Most of the options are read on demand, so restart services
+		// only if the change can't be applied on the fly.
+		if restartFingerprint(tun.runtime.Settings) != before {
+			tun.runtime.Events.EmitEvent(control.EventRestart)
+		}
 		updated := settingsToOpenAPI(tun.runtime.Settings)
 		return updated, nil
 	})
@@ -161,6 +166,16 @@ func (tun *TunnelAPI) mergeStaticSettings(rt *runtime.TunnelRuntime, s adminAPI.
 	if s.WireguardKeepalive != nil {
 		rt.Settings.Wireguard.Keepalive = *s.WireguardKeepalive
 	}
+	if s.PingInterval != nil || s.ConnectionTimeout != nil {
+		publicAPI := *rt.Settings.GetPublicAPIConfig()
+		if s.PingInterval != nil {
+			publicAPI.PingInterval = *s.PingInterval
+		}
+		if s.ConnectionTimeout != nil {
+			publicAPI.PeerTTL = *s.ConnectionTimeout
+		}
+		rt.Settings.PublicAPI = &publicAPI
+	}
 	if s.WireguardSubnet != nil {
 		subnet, err := validateSubnet(*s.WireguardSubnet)
 		if err != nil {
@@ -208,6 +223,24 @@ func (tun *TunnelAPI) mergeStaticSettings(rt *runtime.TunnelRuntime, s adminAPI.
 	return nil
 }
 
+// restartFingerprint serializes the options which are applied
+// on the services start only, so changing them requires the restart.
+// Other options (DNS, keepalive, ping interval, etc) are read on demand.
+func restartFingerprint(c *settings.Config) string {
+	fp := struct {
+		Subnet string
+		Domain *xhttp.DomainConfig
+		SSL    *xhttp.SSLConfig
+	}{
+		Subnet: string(c.Wireguard.Subnet),
+		Domain: c.Domain,
+		SSL:    c.SSL,
+	}
+
+	b, _ := json.Marshal(fp)
+	return string(b)
+}
+
 // setDomainConfig updates current settings with new domain config,
 // return true if the new certificate must be issued.
 func setDomainConfig(c *settings.Config, dc *xhttp.DomainConfig) bool {
@@ -122,3 +122,23 @@ func TestValidateSubnet(t *testing.T) {
 		assert.Equal(t, cc.out, sub)
 	}
 }
+
+func TestRestartFingerprint(t *testing.T) {
+	c := &C{}
+	c.Wireguard.Subnet = "10.235.0.0/24"
+	c.Wireguard.DNS = []string{"8.8.8.8"}
+	before := restartFingerprint(c)
+
+	// options applied on the fly
+	c.Wireguard.DNS = []string{"1.1.1.1"}
+	c.Wireguard.Keepalive = 25
+	c.PublicAPI = &settings.PublicAPIConfig{PingInterval: 60}
+	assert.Equal(t, before, restartFingerprint(c))
+
+	c.Wireguard.Subnet = "10.236.0.0/24"
+	assert.NotEqual(t, before, restartFingerprint(c))
+
+	c.Wireguard.Subnet = "10.235.0.0/24"
+	c.Domain = &DC{Mode: _direct, PrimaryName: "foo.com"}
+	assert.NotEqual(t, before, restartFingerprint(c))
+}
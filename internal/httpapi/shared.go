@@ -0,0 +1,86 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	adminAPI "github.com/vpnhouse/api/go/server/tunnel_admin"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xhttp"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+// Shared link states
+const (
+	sharedLinkPending   = "pending"
+	sharedLinkActivated = "activated"
+	sharedLinkExpired   = "expired"
+)
+
+func (tun *TunnelAPI) exportSharedLink(peer *types.PeerInfo) sharedLink {
+	link := sharedLink{
+		PeerLink: adminAPI.PeerLink{
+			Link: tun.runtime.Settings.PublicURL() + "/public/shared/" + *peer.SharingKey,
+		},
+		Id:             peer.ID,
+		Label:          peer.Label,
+		Expires:        peer.SharingExpires(),
+		MaxActivations: peer.SharingMaxActivations,
+	}
+
+	if peer.Ipv4 != nil {
+		link.Ipv4 = peer.Ipv4.String()
+	}
+	if peer.SharingActivations != nil {
+		link.Activations = *peer.SharingActivations
+	}
+
+	switch {
+	case peer.SharingActivated():
+		link.Status = sharedLinkActivated
+	case peer.SharingExpired(time.Now()):
+		// removed on the next sync
+		link.Status = sharedLinkExpired
+	default:
+		link.Status = sharedLinkPending
+	}
+	return link
+}
+
+// AdminListSharedPeers implements GET method on /api/tunnel/admin/peers/shared endpoint
+func (tun *TunnelAPI) AdminListSharedPeers(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		peers, err := tun.manager.ListSharedPeers()
+		if err != nil {
+			return nil, err
+		}
+
+		links := make([]sharedLink, len(peers))
+		for i, peer := range peers {
+			links[i] = tun.exportSharedLink(peer)
+		}
+		return links, nil
+	})
+}
+
+// AdminRevokeSharedPeer implements DELETE method on /api/tunnel/admin/peers/shared/{id} endpoint.
+// The pending peer is removed releasing its addresses, the activated one keeps connected.
+func (tun *TunnelAPI) AdminRevokeSharedPeer(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			return nil, xerror.EInvalidArgument("invalid peer id", err)
+		}
+
+		if err := tun.manager.RevokeSharedPeer(id); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/vpnhouse/tunnel/internal/iprose"
 	"github.com/vpnhouse/tunnel/internal/proxy"
 	"github.com/vpnhouse/tunnel/internal/stats"
+	"github.com/vpnhouse/tunnel/internal/types"
 	"github.com/vpnhouse/tunnel/internal/wireguard"
 )
 
@@ -60,14 +61,23 @@ func (tun *TunnelAPI) AdminConnectionInfoWireguard(w http.ResponseWriter, r *htt
 				"missing server public ipv4 option, please specify it in settings",
 				"wireguard_server_ipv4")
 		}
-		info := wireguardConnectionInfo(tun.runtime.Settings.Wireguard)
+		info := wireguardConnectionInfo(tun.runtime.Settings.Wireguard, tun.runtime.Settings.GetClientRoutes(nil))
 		return info, nil
 	})
 }
 
-func wireguardConnectionInfo(c wireguard.Config) adminAPI.WireguardOptions {
+// AdminWireguardDrift implements GET method on /api/tunnel/admin/wireguard/drift endpoint.
+// It reports differences between the storage and the wireguard interface
+// without fixing them, the manager reconciles them in background.
+func (tun *TunnelAPI) AdminWireguardDrift(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		return tun.manager.Drift()
+	})
+}
+
+func wireguardConnectionInfo(c wireguard.Config, routes types.ClientRoutes) adminAPI.WireguardOptions {
 	return adminAPI.WireguardOptions{
-		AllowedIps:      []string{"0.0.0.0/0"},
+		AllowedIps:      routes.AllowedIPs(len(c.SubnetIPv6) > 0),
 		Subnet:          string(c.Subnet),
 		Dns:             c.DNS,
 		Keepalive:       c.Keepalive,
@@ -0,0 +1,92 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xhttp"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+const (
+	defaultTrafficRange = 7 * 24 * time.Hour
+	defaultTrafficStep  = time.Hour
+	// the finest stored resolution
+	minTrafficStep   = time.Duration(types.TrafficResolution5m)
+	maxTrafficPoints = 10000
+)
+
+// AdminGetPeerTraffic implements GET method on /api/tunnel/admin/peers/{id}/traffic endpoint.
+// Returns the traffic history of the peer within [from, to) aggregated by step.
+func (tun *TunnelAPI) AdminGetPeerTraffic(w http.ResponseWriter, r *http.Request) {
+	xhttp.JSONResponse(w, func() (interface{}, error) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			return nil, xerror.EInvalidArgument("invalid peer id", err)
+		}
+
+		values := r.URL.Query()
+		to := time.Now()
+		if v := values.Get("to"); len(v) > 0 {
+			if to, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, xerror.EInvalidField("invalid time, want RFC3339", "to", err)
+			}
+		}
+		from := to.Add(-defaultTrafficRange)
+		if v := values.Get("from"); len(v) > 0 {
+			if from, err = time.Parse(time.RFC3339, v); err != nil {
+				return nil, xerror.EInvalidField("invalid time, want RFC3339", "from", err)
+			}
+		}
+		if !from.Before(to) {
+			return nil, xerror.EInvalidField("from must be before to", "from", nil)
+		}
+
+		step := defaultTrafficStep
+		if v := values.Get("step"); len(v) > 0 {
+			if step, err = time.ParseDuration(v); err != nil {
+				return nil, xerror.EInvalidField("invalid step, want a duration like 5m, 1h or 24h", "step", err)
+			}
+		}
+		if step < minTrafficStep || step%minTrafficStep != 0 {
+			return nil, xerror.EInvalidField("step must be a multiple of 5m", "step", nil)
+		}
+		// the points are aligned to the step, so is the range
+		stepSeconds := int64(step / time.Second)
+		from = time.Unix(from.Unix()/stepSeconds*stepSeconds, 0).UTC()
+		if to.Sub(from)/step > maxTrafficPoints {
+			return nil, xerror.EInvalidField("too many points, increase the step", "step", nil)
+		}
+
+		resolution, ok := tun.runtime.Settings.GetTrafficHistoryRetention().ResolutionFor(step, time.Since(from))
+		if !ok {
+			return nil, xerror.EInvalidField("the traffic history of the step is not kept since from, increase the step", "step", nil)
+		}
+
+		points, err := tun.storage.GetPeerTraffic(id, resolution, from, to, step)
+		if err != nil {
+			return nil, err
+		}
+
+		result := peerTraffic{
+			PeerId: id,
+			From:   from,
+			To:     to,
+			Step:   step.String(),
+			Points: make([]trafficPoint, len(points)),
+		}
+		for i, p := range points {
+			result.Points[i] = trafficPoint{Time: p.Time, Upstream: p.Upstream, Downstream: p.Downstream}
+			result.Upstream += p.Upstream
+			result.Downstream += p.Downstream
+		}
+		return result, nil
+	})
+}
@@ -0,0 +1,223 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	tunnelAPI "github.com/vpnhouse/api/go/server/tunnel"
+	adminAPI "github.com/vpnhouse/api/go/server/tunnel_admin"
+)
+
+// The types below extend the generated OpenAPI models
+// with the fields which are not a part of the API schema yet.
+// Embedded fields are flattened by encoding/json, so the wire format
+// stays compatible with the existing clients.
+
+// adminPeer extends adminAPI.Peer
+type adminPeer struct {
+	adminAPI.Peer
+
+	Ipv6 *string `json:"ipv6,omitempty"`
+	// Name of the wireguard interface, the primary one if not set
+	Interface *string `json:"interface,omitempty"`
+	// Group the peer inherits the policies from, zero leaves the group
+	GroupId *int64 `json:"group_id,omitempty"`
+	// Preshared key of the peer, the empty one removes the key
+	PresharedKey *string `json:"preshared_key,omitempty"`
+	// Networks the client routes through the tunnel: "full", "private"
+	// or a comma-separated list of CIDRs, the empty value resets to the configured ones
+	Routes *string `json:"routes,omitempty"`
+	// Subnets behind the site-to-site peer routed through the tunnel,
+	// the empty list removes them
+	RoutedSubnets *[]string `json:"routed_subnets,omitempty"`
+	// DNS servers to announce to the client, override the ones of the group
+	// and the interface settings, the empty list removes the override
+	Dns *[]string `json:"dns,omitempty"`
+	// Generate the new preshared key, write-only
+	GeneratePresharedKey bool `json:"generate_preshared_key,omitempty"`
+	// Generate the new keypair instead of the given public key, write-only
+	GenerateKeypair bool `json:"generate_keypair,omitempty"`
+
+	QuotaBytes  *int64  `json:"quota_bytes,omitempty"`
+	QuotaPeriod *string `json:"quota_period,omitempty"`
+	// read-only quota usage details
+	QuotaUsed      *int64     `json:"quota_used,omitempty"`
+	QuotaRemaining *int64     `json:"quota_remaining,omitempty"`
+	QuotaReset     *time.Time `json:"quota_reset,omitempty"`
+
+	// read-only liveness details
+	Handshake *time.Time `json:"handshake,omitempty"`
+	Endpoint  *string    `json:"endpoint,omitempty"`
+	Online    bool       `json:"online"`
+}
+
+// adminPeerRecord mirrors adminAPI.PeerRecord with the extended peer
+type adminPeerRecord struct {
+	Id   int64     `json:"id"`
+	Peer adminPeer `json:"peer"`
+}
+
+// adminPeerConfig extends adminPeerRecord with the client configuration
+// which is returned only once, on the server-side keypair generation.
+type adminPeerConfig struct {
+	adminPeerRecord
+
+	// wg-quick configuration
+	Config string `json:"config"`
+	// data URL of the configuration QR code PNG image
+	ConfigQR string `json:"config_qr"`
+}
+
+// adminSharedPeer extends adminPeer with the shared link options
+type adminSharedPeer struct {
+	adminPeer
+
+	// Lifetime of the link, 24 hours if not set
+	TtlSeconds *int64 `json:"ttl_seconds,omitempty"`
+	// How many times the link may be activated, every activation replaces
+	// the device of the peer. Single-use if not set, zero for unlimited.
+	MaxActivations *int `json:"max_activations,omitempty"`
+}
+
+// sharedLink extends adminAPI.PeerLink with the link state
+type sharedLink struct {
+	adminAPI.PeerLink
+
+	Id     int64   `json:"id"`
+	Label  *string `json:"label,omitempty"`
+	Ipv4   string  `json:"ipv4"`
+	Status string  `json:"status"`
+	// expiration of the link, the activated peer outlives it
+	Expires        *time.Time `json:"expires,omitempty"`
+	Activations    int        `json:"activations"`
+	MaxActivations *int       `json:"max_activations,omitempty"`
+}
+
+// peerActivationResponse mirrors adminAPI.PeerActivationResponse with the extended peer
+type peerActivationResponse struct {
+	Peer             adminPeerRecord           `json:"peer"`
+	WireguardOptions adminAPI.WireguardOptions `json:"wireguard_options"`
+}
+
+// userQuota is the admin API representation of types.UserQuota
+type userQuota struct {
+	UserId      string `json:"user_id"`
+	QuotaBytes  int64  `json:"quota_bytes"`
+	QuotaPeriod string `json:"quota_period,omitempty"`
+	// read-only quota usage details
+	QuotaUsed      int64      `json:"quota_used"`
+	QuotaRemaining int64      `json:"quota_remaining"`
+	QuotaReset     *time.Time `json:"quota_reset,omitempty"`
+}
+
+// peerGroup is the admin API representation of types.PeerGroup
+type peerGroup struct {
+	Id              int64    `json:"id"`
+	Name            string   `json:"name"`
+	NetAccessPolicy *int     `json:"net_access_policy,omitempty"`
+	RateLimit       *int     `json:"rate_limit,omitempty"`
+	Dns             []string `json:"dns,omitempty"`
+	QuotaBytes      *int64   `json:"quota_bytes,omitempty"`
+	QuotaPeriod     *string  `json:"quota_period,omitempty"`
+	// peers expire in the given number of seconds since their creation
+	ExpireSeconds *int64 `json:"expire_seconds,omitempty"`
+	// read-only
+	Created *time.Time `json:"created,omitempty"`
+	Updated *time.Time `json:"updated,omitempty"`
+}
+
+// invite is the admin API representation of types.Invite
+type invite struct {
+	Id int64 `json:"id"`
+	// generated if not set
+	Code  string  `json:"code"`
+	Label *string `json:"label,omitempty"`
+	// unlimited if not set
+	MaxRedemptions *int       `json:"max_redemptions,omitempty"`
+	Expires        *time.Time `json:"expires,omitempty"`
+	// policies of the peers created by the invite
+	NetAccessPolicy *int    `json:"net_access_policy,omitempty"`
+	RateLimit       *int    `json:"rate_limit,omitempty"`
+	QuotaBytes      *int64  `json:"quota_bytes,omitempty"`
+	QuotaPeriod     *string `json:"quota_period,omitempty"`
+	// peers expire in the given number of seconds since the redemption
+	PeerExpireSeconds *int64 `json:"peer_expire_seconds,omitempty"`
+	// read-only
+	Redemptions int        `json:"redemptions"`
+	Created     *time.Time `json:"created,omitempty"`
+}
+
+// inviteRedemption is the admin API representation of types.InviteRedemption
+type inviteRedemption struct {
+	Id           int64      `json:"id"`
+	PeerId       int64      `json:"peer_id"`
+	WireguardKey *string    `json:"wireguard_key,omitempty"`
+	Ipv4         string     `json:"ipv4,omitempty"`
+	Created      *time.Time `json:"created,omitempty"`
+	// the peer is omitted if it has expired or been removed
+	Peer *adminPeer `json:"peer,omitempty"`
+}
+
+// peerTraffic is the traffic history of the peer
+type peerTraffic struct {
+	PeerId int64     `json:"peer_id"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Step   string    `json:"step"`
+	// total traffic within the range
+	Upstream   int64          `json:"upstream"`
+	Downstream int64          `json:"downstream"`
+	Points     []trafficPoint `json:"points"`
+}
+
+type trafficPoint struct {
+	Time       time.Time `json:"time"`
+	Upstream   int64     `json:"upstream"`
+	Downstream int64     `json:"downstream"`
+}
+
+// ipLease is the admin API representation of types.IPLease
+type ipLease struct {
+	Ip             string     `json:"ip"`
+	PeerId         int64      `json:"peer_id"`
+	UserId         *string    `json:"user_id,omitempty"`
+	InstallationId *uuid.UUID `json:"installation_id,omitempty"`
+	WireguardKey   *string    `json:"wireguard_key,omitempty"`
+	Started        *time.Time `json:"started"`
+	// not set while the lease is active
+	Ended *time.Time `json:"ended,omitempty"`
+}
+
+// peerEndpoint is the admin API representation of types.PeerEndpoint
+type peerEndpoint struct {
+	Endpoint string     `json:"endpoint"`
+	Country  string     `json:"country,omitempty"`
+	Seen     *time.Time `json:"seen"`
+}
+
+// clientConnectRequest extends tunnelAPI.ClientConnectJSONBody
+type clientConnectRequest struct {
+	tunnelAPI.ClientConnectJSONBody
+
+	// Name of the wireguard interface to connect to, the primary one if not set
+	Interface *string `json:"interface,omitempty"`
+}
+
+// connectInfoWireguard extends tunnelAPI.ConnectInfoWireguard
+type connectInfoWireguard struct {
+	tunnelAPI.ConnectInfoWireguard
+
+	TunnelIpv6   *string `json:"tunnel_ipv6,omitempty"`
+	PresharedKey *string `json:"preshared_key,omitempty"`
+}
+
+// clientConfiguration mirrors tunnelAPI.ClientConfiguration with the extended connection info
+type clientConfiguration struct {
+	tunnelAPI.ClientConfiguration
+
+	InfoWireguard *connectInfoWireguard `json:"info_wireguard,omitempty"`
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"github.com/vpnhouse/tunnel/internal/wireguard"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+const qrCodeSize = 512
+
+// wgQuickConfig is a client configuration in the wg-quick(8) format
+type wgQuickConfig struct {
+	PrivateKey      string
+	Addresses       []string
+	DNS             []string
+	ServerPublicKey string
+	PresharedKey    string
+	Endpoint        string
+	AllowedIPs      []string
+	Keepalive       int
+}
+
+// newWgQuickConfig prepares the configuration of the given peer,
+// the peer must have its addresses allocated.
+func newWgQuickConfig(settings wireguard.Config, peer *types.PeerInfo, privateKey wgtypes.Key) *wgQuickConfig {
+	c := &wgQuickConfig{
+		PrivateKey:      privateKey.String(),
+		Addresses:       []string{peer.Ipv4.String() + "/32"},
+		DNS:             settings.DNS,
+		ServerPublicKey: settings.GetPrivateKey().Public().Unwrap().String(),
+		Endpoint:        fmt.Sprintf("%s:%d", settings.ServerIPv4, settings.ClientPort()),
+		AllowedIPs:      []string{"0.0.0.0/0"},
+		Keepalive:       settings.Keepalive,
+	}
+
+	if peer.Ipv6 != nil && peer.Ipv6.IP != nil {
+		c.Addresses = append(c.Addresses, peer.Ipv6.String()+"/128")
+		c.AllowedIPs = append(c.AllowedIPs, "::/0")
+	}
+	if peer.PresharedKey != nil {
+		c.PresharedKey = *peer.PresharedKey
+	}
+
+	return c
+}
+
+func (c *wgQuickConfig) String() string {
+	var b strings.Builder
+	b.WriteString("[Interface]\n")
+	fmt.Fprintf(&b, "Address = %s\n", strings.Join(c.Addresses, ", "))
+	fmt.Fprintf(&b, "PrivateKey = %s\n", c.PrivateKey)
+	if len(c.DNS) > 0 {
+		fmt.Fprintf(&b, "DNS = %s\n", strings.Join(c.DNS, ", "))
+	}
+
+	b.WriteString("\n[Peer]\n")
+	fmt.Fprintf(&b, "PublicKey = %s\n", c.ServerPublicKey)
+	if len(c.PresharedKey) > 0 {
+		fmt.Fprintf(&b, "PresharedKey = %s\n", c.PresharedKey)
+	}
+	fmt.Fprintf(&b, "Endpoint = %s\n", c.Endpoint)
+	fmt.Fprintf(&b, "AllowedIPs = %s\n", strings.Join(c.AllowedIPs, ", "))
+	fmt.Fprintf(&b, "PersistentKeepalive = %d\n", c.Keepalive)
+
+	return b.String()
+}
+
+// QRCode renders the configuration as the data URL of a QR code PNG image,
+// it can be scanned by the wireguard mobile apps.
+func (c *wgQuickConfig) QRCode() (string, error) {
+	png, err := qrcode.Encode(c.String(), qrcode.Medium, qrCodeSize)
+	if err != nil {
+		return "", xerror.EInternalError("failed to render the config QR code", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
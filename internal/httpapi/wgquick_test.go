@@ -0,0 +1,60 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package httpapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xnet"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"github.com/vpnhouse/tunnel/internal/wireguard"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestWgQuickConfig(t *testing.T) {
+	settings := wireguard.DefaultConfig()
+	settings.ServerIPv4 = "1.2.3.4"
+	settings.NATedPort = 51820
+
+	privateKey, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	psk, err := wgtypes.GenerateKey()
+	require.NoError(t, err)
+
+	ipv4 := xnet.ParseIP("10.235.0.2")
+	ipv6 := xnet.ParseIP("fd00:235::2")
+	pskString := psk.String()
+	peer := &types.PeerInfo{
+		Ipv4:          &ipv4,
+		Ipv6:          &ipv6,
+		WireguardInfo: types.WireguardInfo{PresharedKey: &pskString},
+	}
+
+	config := newWgQuickConfig(settings, peer, privateKey).String()
+	lines := strings.Split(strings.TrimSpace(config), "\n")
+	assert.Equal(t, []string{
+		"[Interface]",
+		"Address = 10.235.0.2/32, fd00:235::2/128",
+		"PrivateKey = " + privateKey.String(),
+		"DNS = 8.8.8.8, 8.8.4.4",
+		"",
+		"[Peer]",
+		"PublicKey = " + settings.GetPrivateKey().Public().Unwrap().String(),
+		"PresharedKey = " + pskString,
+		"Endpoint = 1.2.3.4:51820",
+		"AllowedIPs = 0.0.0.0/0, ::/0",
+		"PersistentKeepalive = 60",
+	}, lines)
+
+	peer.Ipv6 = nil
+	peer.PresharedKey = nil
+	config = newWgQuickConfig(settings, peer, privateKey).String()
+	assert.Contains(t, config, "Address = 10.235.0.2/32\n")
+	assert.Contains(t, config, "AllowedIPs = 0.0.0.0/0\n")
+	assert.NotContains(t, config, "PresharedKey")
+}
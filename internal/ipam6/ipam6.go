@@ -0,0 +1,191 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package ipam6
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xnet"
+	"go.uber.org/zap"
+)
+
+const (
+	// minPrefixLen keeps the host part within the lower 64 bits of an address
+	minPrefixLen = 64
+	// maxPrefixLen leaves some space for peers besides the server address
+	maxPrefixLen = 126
+
+	// the first address of a subnet is never used,
+	// the second one is assigned to the server interface.
+	serverOffset    = 1
+	firstPeerOffset = 2
+)
+
+// IPAM allocates IPv6 addresses for the wireguard peers.
+// Unlike ipam.IPAM it does not apply any network policies:
+// access and rate limits are enforced for IPv4 addresses only.
+type IPAM struct {
+	lock      sync.Mutex
+	subnet    *net.IPNet
+	base      uint64
+	maxOffset uint64
+	cursor    uint64
+	used      map[uint64]struct{}
+	running   atomic.Bool
+}
+
+// ParseSubnet parses and validates the IPv6 subnet to allocate peer addresses from.
+func ParseSubnet(s string) (*net.IPNet, error) {
+	_, subnet, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, xerror.EInvalidArgument("can't parse ipv6 subnet", err, zap.String("subnet", s))
+	}
+
+	if subnet.IP.To4() != nil {
+		return nil, xerror.EInvalidArgument("non-IPv6 subnet given", nil, zap.String("subnet", s))
+	}
+
+	if ones, _ := subnet.Mask.Size(); ones < minPrefixLen || ones > maxPrefixLen {
+		return nil, xerror.EInvalidArgument("invalid ipv6 subnet size given, want /64 to /126", nil, zap.String("subnet", s))
+	}
+
+	return subnet, nil
+}
+
+// ServerAddr returns IPAddr/mask to use as a wireguard interface IPv6 address.
+func ServerAddr(subnet *net.IPNet) string {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, subnet.IP.To16())
+	binary.BigEndian.PutUint64(ip[8:], binary.BigEndian.Uint64(ip[8:])+serverOffset)
+
+	ones, _ := subnet.Mask.Size()
+	return (&net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 128)}).String()
+}
+
+func New(subnet *net.IPNet) (*IPAM, error) {
+	ones, _ := subnet.Mask.Size()
+	if ones < minPrefixLen || ones > maxPrefixLen {
+		return nil, xerror.EInvalidArgument("invalid ipv6 subnet size given, want /64 to /126", nil, zap.Stringer("subnet", subnet))
+	}
+
+	am := &IPAM{
+		subnet:    subnet,
+		base:      binary.BigEndian.Uint64(subnet.IP.To16()[8:]),
+		maxOffset: ^uint64(0) >> (ones - minPrefixLen),
+		cursor:    firstPeerOffset,
+		used:      make(map[uint64]struct{}),
+	}
+	am.running.Store(true)
+
+	zap.L().Info("ipv6 address manager started", zap.Stringer("subnet", subnet))
+	return am, nil
+}
+
+func (am *IPAM) Running() bool {
+	return am.running.Load()
+}
+
+func (am *IPAM) Shutdown() error {
+	am.running.Store(false)
+	return nil
+}
+
+// Contains reports whether the given address belongs to the managed subnet.
+func (am *IPAM) Contains(ip xnet.IP) bool {
+	_, ok := am.offset(ip)
+	return ok
+}
+
+// Alloc returns the next free address from the subnet.
+func (am *IPAM) Alloc() (xnet.IP, error) {
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	capacity := am.maxOffset - firstPeerOffset + 1
+	if uint64(len(am.used)) >= capacity {
+		return xnet.IP{}, xerror.EUnavailable("no free ipv6 addresses left", nil)
+	}
+
+	// at least one of len(used)+1 sequential offsets is free
+	for i := 0; i <= len(am.used); i++ {
+		offset := am.cursor
+		am.cursor++
+		if am.cursor > am.maxOffset || am.cursor < firstPeerOffset {
+			am.cursor = firstPeerOffset
+		}
+
+		if _, busy := am.used[offset]; !busy {
+			am.used[offset] = struct{}{}
+			return am.address(offset), nil
+		}
+	}
+
+	return xnet.IP{}, xerror.EUnavailable("no free ipv6 addresses left", nil)
+}
+
+// Set marks the given address as used.
+func (am *IPAM) Set(ip xnet.IP) error {
+	offset, ok := am.offset(ip)
+	if !ok || offset < firstPeerOffset {
+		return xerror.EInvalidArgument("ipv6 address is out of the peers range", nil, zap.String("ip", ip.String()))
+	}
+
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	if _, busy := am.used[offset]; busy {
+		return xerror.EInvalidArgument("ipv6 address is already in use", nil, zap.String("ip", ip.String()))
+	}
+
+	am.used[offset] = struct{}{}
+	return nil
+}
+
+// Unset releases the given address.
+func (am *IPAM) Unset(ip xnet.IP) error {
+	offset, ok := am.offset(ip)
+	if !ok {
+		return xerror.EInvalidArgument("ipv6 address is out of the peers range", nil, zap.String("ip", ip.String()))
+	}
+
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	delete(am.used, offset)
+	return nil
+}
+
+// IsAvailable reports whether the given address can be assigned to a peer.
+func (am *IPAM) IsAvailable(ip xnet.IP) bool {
+	offset, ok := am.offset(ip)
+	if !ok || offset < firstPeerOffset {
+		return false
+	}
+
+	am.lock.Lock()
+	defer am.lock.Unlock()
+
+	_, busy := am.used[offset]
+	return !busy
+}
+
+func (am *IPAM) offset(ip xnet.IP) (uint64, bool) {
+	if ip.IP == nil || ip.IP.To4() != nil || !am.subnet.Contains(ip.IP) {
+		return 0, false
+	}
+
+	return binary.BigEndian.Uint64(ip.IP.To16()[8:]) - am.base, true
+}
+
+func (am *IPAM) address(offset uint64) xnet.IP {
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, am.subnet.IP.To16())
+	binary.BigEndian.PutUint64(ip[8:], am.base+offset)
+	return xnet.IP{IP: ip}
+}
@@ -0,0 +1,69 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package ipam6
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xnet"
+)
+
+func TestParseSubnet(t *testing.T) {
+	cases := []struct {
+		in string
+		ok bool
+	}{
+		{"fd00:235::/64", true},
+		{"fd00:235::/112", true},
+		{"fd00:235::/126", true},
+		{"fd00:235::/48", false},
+		{"fd00:235::/127", false},
+		{"10.235.0.0/16", false},
+		{"wat", false},
+	}
+
+	for _, cc := range cases {
+		_, err := ParseSubnet(cc.in)
+		if cc.ok {
+			require.NoError(t, err, "input: %s", cc.in)
+		} else {
+			require.Error(t, err, "input: %s", cc.in)
+		}
+	}
+}
+
+func TestAllocation(t *testing.T) {
+	subnet, err := ParseSubnet("fd00:235::/126")
+	require.NoError(t, err)
+	require.Equal(t, "fd00:235::1/126", ServerAddr(subnet))
+
+	am, err := New(subnet)
+	require.NoError(t, err)
+
+	a, err := am.Alloc()
+	require.NoError(t, err)
+	require.Equal(t, "fd00:235::2", a.String())
+
+	b, err := am.Alloc()
+	require.NoError(t, err)
+	require.Equal(t, "fd00:235::3", b.String())
+
+	_, err = am.Alloc()
+	require.Error(t, err, "subnet must be exhausted")
+
+	require.NoError(t, am.Unset(a))
+	require.True(t, am.IsAvailable(a))
+	require.Error(t, am.Set(b), "address is already in use")
+	require.NoError(t, am.Set(a))
+
+	server := xnet.ParseIP("fd00:235::1")
+	require.False(t, am.IsAvailable(server))
+	require.Error(t, am.Set(server))
+
+	outside := xnet.ParseIP("fd00:236::2")
+	require.False(t, am.Contains(outside))
+	require.Error(t, am.Set(outside))
+}
@@ -0,0 +1,117 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// UpdatePeerGroup stores the group and re-applies its policies to the member peers
+func (manager *Manager) UpdatePeerGroup(group *types.PeerGroup) error {
+	if !manager.running.Load().(bool) {
+		return xerror.EUnavailable("server is shutting down", nil)
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	if err := group.Validate(); err != nil {
+		return err
+	}
+
+	old, err := manager.storage.GetPeerGroup(group.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := manager.storage.UpdatePeerGroup(group); err != nil {
+		return err
+	}
+
+	for _, peer := range manager.groupPeers(group.ID) {
+		group.Inherit(peer, old)
+		if err := manager.updatePeer(peer); err != nil {
+			// keep going, the rest of the peers must follow the group anyway
+			zap.L().Error("failed to apply the group policies to the peer",
+				zap.Int64("id", peer.ID), zap.Int64("group", group.ID), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+// DeletePeerGroup removes the group, the member peers leave the group
+// dropping the inherited policies.
+func (manager *Manager) DeletePeerGroup(id int64) error {
+	if !manager.running.Load().(bool) {
+		return xerror.EUnavailable("server is shutting down", nil)
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	for _, peer := range manager.groupPeers(id) {
+		// zero means leaving the group, see updatePeer
+		var leave int64
+		peer.GroupId = &leave
+		if err := manager.updatePeer(peer); err != nil {
+			return err
+		}
+	}
+
+	if err := manager.storage.DeletePeerGroup(id); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// groupPeers returns the copies of the member peers of the group
+func (manager *Manager) groupPeers(id int64) []*types.PeerInfo {
+	var peers []*types.PeerInfo
+	for _, peer := range manager.peers() {
+		if peer.GroupId != nil && *peer.GroupId == id {
+			p := *peer
+			peers = append(peers, &p)
+		}
+	}
+	return peers
+}
+
+// peerGroup returns the group by its id, nil for the empty id
+func (manager *Manager) peerGroup(id *int64) (*types.PeerGroup, error) {
+	if id == nil {
+		return nil, nil
+	}
+
+	return manager.storage.GetPeerGroup(*id)
+}
+
+// inheritGroup applies the policies of the peer's group to the peer.
+// previousId is the group the peer belonged to before, if any:
+// the policies inherited from it are replaced by the ones of the new group.
+func (manager *Manager) inheritGroup(peer *types.PeerInfo, previousId *int64) error {
+	if peer.GroupId == nil && previousId == nil {
+		return nil
+	}
+
+	group, err := manager.peerGroup(peer.GroupId)
+	if err != nil {
+		return err
+	}
+	if group == nil {
+		// leaving the group
+		group = &types.PeerGroup{}
+	}
+
+	previous, err := manager.peerGroup(previousId)
+	if err != nil {
+		// the previous group may be gone already, nothing to replace then
+		previous = nil
+	}
+
+	group.Inherit(peer, previous)
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"github.com/google/uuid"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+type identifiersKey struct {
+	userId         string
+	installationId uuid.UUID
+}
+
+// peerIndex keeps the stored peers in memory, so the manager
+// does not scan the storage on every operation.
+// It must be accessed under the manager lock, the peers are owned by the index.
+type peerIndex struct {
+	byId          map[int64]*types.PeerInfo
+	byKey         map[string]*types.PeerInfo
+	bySharingKey  map[string]*types.PeerInfo
+	byIdentifiers map[identifiersKey]*types.PeerInfo
+	byUser        map[string]map[int64]*types.PeerInfo
+}
+
+func newPeerIndex() *peerIndex {
+	return &peerIndex{
+		byId:          make(map[int64]*types.PeerInfo),
+		byKey:         make(map[string]*types.PeerInfo),
+		bySharingKey:  make(map[string]*types.PeerInfo),
+		byIdentifiers: make(map[identifiersKey]*types.PeerInfo),
+		byUser:        make(map[string]map[int64]*types.PeerInfo),
+	}
+}
+
+func peerIdentifiersKey(peer *types.PeerInfo) (identifiersKey, bool) {
+	if peer.UserId == nil || peer.InstallationId == nil {
+		return identifiersKey{}, false
+	}
+	return identifiersKey{userId: *peer.UserId, installationId: *peer.InstallationId}, true
+}
+
+// put adds the peer to the index replacing the one with the same id
+func (index *peerIndex) put(peer *types.PeerInfo) {
+	index.remove(peer.ID)
+
+	index.byId[peer.ID] = peer
+	if peer.WireguardPublicKey != nil {
+		index.byKey[*peer.WireguardPublicKey] = peer
+	}
+	if peer.Shared() {
+		index.bySharingKey[*peer.SharingKey] = peer
+	}
+	if key, ok := peerIdentifiersKey(peer); ok {
+		index.byIdentifiers[key] = peer
+	}
+	if peer.UserId != nil {
+		peers, ok := index.byUser[*peer.UserId]
+		if !ok {
+			peers = make(map[int64]*types.PeerInfo)
+			index.byUser[*peer.UserId] = peers
+		}
+		peers[peer.ID] = peer
+	}
+}
+
+func (index *peerIndex) remove(id int64) {
+	peer, ok := index.byId[id]
+	if !ok {
+		return
+	}
+
+	delete(index.byId, id)
+	if peer.WireguardPublicKey != nil && index.byKey[*peer.WireguardPublicKey] == peer {
+		delete(index.byKey, *peer.WireguardPublicKey)
+	}
+	if peer.Shared() && index.bySharingKey[*peer.SharingKey] == peer {
+		delete(index.bySharingKey, *peer.SharingKey)
+	}
+	if key, ok := peerIdentifiersKey(peer); ok && index.byIdentifiers[key] == peer {
+		delete(index.byIdentifiers, key)
+	}
+	if peer.UserId != nil {
+		peers := index.byUser[*peer.UserId]
+		delete(peers, id)
+		if len(peers) == 0 {
+			delete(index.byUser, *peer.UserId)
+		}
+	}
+}
+
+// get returns the copy of the peer, so the caller may change it freely
+func (index *peerIndex) get(id int64) (*types.PeerInfo, bool) {
+	peer, ok := index.byId[id]
+	if !ok {
+		return nil, false
+	}
+	p := *peer
+	return &p, true
+}
+
+// getShared returns the copy of the peer shared with the given key
+func (index *peerIndex) getShared(sharingKey string) (*types.PeerInfo, bool) {
+	peer, ok := index.bySharingKey[sharingKey]
+	if !ok {
+		return nil, false
+	}
+	p := *peer
+	return &p, true
+}
+
+// hasKey reports whether there is a peer with the given public key other than the given one
+func (index *peerIndex) hasKey(key string, except int64) bool {
+	peer, ok := index.byKey[key]
+	return ok && peer.ID != except
+}
+
+// all returns the snapshot of the indexed peers, the peers are owned by the index
+func (index *peerIndex) all() []*types.PeerInfo {
+	peers := make([]*types.PeerInfo, 0, len(index.byId))
+	for _, peer := range index.byId {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
+// search returns the copies of the peers matching the non-empty identifiers
+func (index *peerIndex) search(identifiers *types.PeerIdentifiers) []*types.PeerInfo {
+	var candidates []*types.PeerInfo
+	switch {
+	case identifiers.UserId != nil && identifiers.InstallationId != nil:
+		key := identifiersKey{userId: *identifiers.UserId, installationId: *identifiers.InstallationId}
+		if peer, ok := index.byIdentifiers[key]; ok {
+			candidates = append(candidates, peer)
+		}
+	case identifiers.UserId != nil:
+		for _, peer := range index.byUser[*identifiers.UserId] {
+			candidates = append(candidates, peer)
+		}
+	default:
+		candidates = index.all()
+	}
+
+	var peers []*types.PeerInfo
+	for _, peer := range candidates {
+		if matchIdentifiers(peer, identifiers) {
+			p := *peer
+			peers = append(peers, &p)
+		}
+	}
+	return peers
+}
+
+func matchIdentifiers(peer *types.PeerInfo, identifiers *types.PeerIdentifiers) bool {
+	return (identifiers.UserId == nil || equalPtr(peer.UserId, identifiers.UserId)) &&
+		(identifiers.InstallationId == nil || equalPtr(peer.InstallationId, identifiers.InstallationId)) &&
+		(identifiers.SessionId == nil || equalPtr(peer.SessionId, identifiers.SessionId))
+}
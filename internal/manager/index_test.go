@@ -0,0 +1,91 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestPeerIndex(t *testing.T) {
+	str := func(s string) *string { return &s }
+	alice, bob := str("alice"), str("bob")
+	laptop, phone := uuid.New(), uuid.New()
+	session := uuid.New()
+
+	newPeer := func(id int64, userId *string, installationId *uuid.UUID, key *string) *types.PeerInfo {
+		return &types.PeerInfo{
+			ID:              id,
+			PeerIdentifiers: types.PeerIdentifiers{UserId: userId, InstallationId: installationId},
+			WireguardInfo:   types.WireguardInfo{WireguardPublicKey: key},
+		}
+	}
+
+	index := newPeerIndex()
+	first := newPeer(1, alice, &laptop, str("key1"))
+	first.SessionId = &session
+	index.put(first)
+	index.put(newPeer(2, alice, &phone, str("key2")))
+	index.put(newPeer(3, bob, &laptop, str("key3")))
+	index.put(&types.PeerInfo{ID: 4, SharingKey: str("shared")})
+
+	cases := []struct {
+		name        string
+		identifiers types.PeerIdentifiers
+		ids         []int64
+	}{
+		{name: "all", identifiers: types.PeerIdentifiers{}, ids: []int64{1, 2, 3, 4}},
+		{name: "user", identifiers: types.PeerIdentifiers{UserId: alice}, ids: []int64{1, 2}},
+		{name: "installation", identifiers: types.PeerIdentifiers{InstallationId: &laptop}, ids: []int64{1, 3}},
+		{name: "user and installation", identifiers: types.PeerIdentifiers{UserId: bob, InstallationId: &laptop}, ids: []int64{3}},
+		{name: "session", identifiers: types.PeerIdentifiers{UserId: alice, SessionId: &session}, ids: []int64{1}},
+		{name: "unknown user", identifiers: types.PeerIdentifiers{UserId: str("carol")}, ids: []int64{}},
+	}
+
+	search := func(identifiers types.PeerIdentifiers) []int64 {
+		ids := []int64{}
+		for _, peer := range index.search(&identifiers) {
+			ids = append(ids, peer.ID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+
+	for _, cc := range cases {
+		require.Equal(t, cc.ids, search(cc.identifiers), cc.name)
+	}
+
+	// the peers are copied
+	peer, ok := index.get(1)
+	require.True(t, ok)
+	peer.Label = str("changed")
+	peer, _ = index.get(1)
+	require.Nil(t, peer.Label)
+
+	shared, ok := index.getShared("shared")
+	require.True(t, ok)
+	require.EqualValues(t, 4, shared.ID)
+	require.True(t, index.hasKey("key2", 1))
+	require.False(t, index.hasKey("key2", 2))
+
+	// the peer has changed its identifiers
+	index.put(newPeer(2, bob, &phone, str("key5")))
+	require.Equal(t, []int64{1}, search(types.PeerIdentifiers{UserId: alice}))
+	require.Equal(t, []int64{2, 3}, search(types.PeerIdentifiers{UserId: bob}))
+	require.False(t, index.hasKey("key2", 0))
+	require.True(t, index.hasKey("key5", 0))
+
+	index.remove(4)
+	index.remove(1)
+	_, ok = index.getShared("shared")
+	require.False(t, ok)
+	require.Equal(t, []int64{}, search(types.PeerIdentifiers{UserId: alice}))
+	require.Equal(t, []int64{2, 3}, search(types.PeerIdentifiers{}))
+	require.Empty(t, index.byUser[*alice])
+}
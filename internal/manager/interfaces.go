@@ -0,0 +1,65 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"net"
+
+	"github.com/vpnhouse/common-lib-go/ipam"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/ipam6"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"github.com/vpnhouse/tunnel/internal/wireguard"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// Interface is a wireguard interface along with the address pools of its peers
+type Interface struct {
+	Name      string
+	Wireguard *wireguard.Wireguard
+	IP4am     *ipam.IPAM
+	IP6am     *ipam6.IPAM // nil if IPv6 addressing is disabled
+	// Networks the peer addresses are allocated from
+	Subnets []net.IPNet
+}
+
+// primary returns the interface used for peers without the explicit interface reference
+func (manager *Manager) primary() *Interface {
+	return manager.interfaces[0]
+}
+
+// peerInterface returns the interface the peer belongs to
+func (manager *Manager) peerInterface(peer *types.PeerInfo) (*Interface, error) {
+	if peer.WireguardInterface == nil || len(*peer.WireguardInterface) == 0 {
+		return manager.primary(), nil
+	}
+
+	for _, iface := range manager.interfaces {
+		if iface.Name == *peer.WireguardInterface {
+			return iface, nil
+		}
+	}
+	return nil, xerror.EInvalidField("unknown wireguard interface "+*peer.WireguardInterface, "interface", nil)
+}
+
+// getPeers returns peers configured on all wireguard interfaces.
+// Map's key is a peer's public key string.
+func (manager *Manager) getPeers() (map[string]*wgtypes.Peer, error) {
+	if len(manager.interfaces) == 1 {
+		return manager.primary().Wireguard.GetPeers()
+	}
+
+	peers := make(map[string]*wgtypes.Peer)
+	for _, iface := range manager.interfaces {
+		ifacePeers, err := iface.Wireguard.GetPeers()
+		if err != nil {
+			return nil, err
+		}
+		for key, peer := range ifacePeers {
+			peers[key] = peer
+		}
+	}
+	return peers, nil
+}
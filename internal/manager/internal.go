@@ -5,80 +5,120 @@
 package manager
 
 import (
-	"errors"
 	"time"
 
-	"github.com/vpnhouse/common-lib-go/ippool"
 	"github.com/vpnhouse/common-lib-go/xerror"
 	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/eventlog"
 	"github.com/vpnhouse/tunnel/internal/types"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 )
 
-func (manager *Manager) peers() ([]*types.PeerInfo, error) {
-	return manager.storage.SearchPeers(nil)
+var errDuplicateKey = xerror.EInvalidField("peer with the same public key already exists", "wireguard_key", nil)
+
+// peers returns the indexed peers, they are owned by the index
+func (manager *Manager) peers() []*types.PeerInfo {
+	return manager.index.all()
 }
 
-// restore peers on startup
-func (manager *Manager) restorePeers() {
-	peers, err := manager.peers()
+// indexPeer puts the stored state of the peer to the index.
+// The runtime state is kept from the indexed copy: the stats sync updates it
+// in the index and stores it out of the manager lock, so the storage may lag behind.
+func (manager *Manager) indexPeer(id int64) {
+	peer, err := manager.storage.GetPeer(id)
 	if err != nil {
-		// err has already been logged inside
+		zap.L().Error("failed to index peer", zap.Int64("id", id), zap.Error(err))
+		manager.index.remove(id)
 		return
 	}
 
-	for _, peer := range peers {
-		if peer.Expired() {
-			zap.L().Debug("wiping expired peer", zap.Any("peer", peer))
-			_ = manager.storage.DeletePeer(peer.ID)
-			continue
-		}
-
-		if err := manager.ip4am.Set(*peer.Ipv4, peer.GetNetworkPolicy()); err != nil {
-			if !errors.Is(err, ippool.ErrNotInRange) {
-				continue
-			}
-
-			newIP, err := manager.ip4am.Alloc(peer.GetNetworkPolicy())
-			if err != nil {
-				// TODO(nikonov): remove peer OR mark it as invalid
-				//  to allow further migration by hand.
-				continue
-			}
-			peer.Ipv4 = &newIP
-			if _, err := manager.storage.UpdatePeer(peer); err != nil {
-				continue
-			}
-		}
-
-		_ = manager.wireguard.SetPeer(peer)
+	if indexed, ok := manager.index.get(id); ok {
+		peer.Activity = indexed.Activity
+		peer.Upstream = indexed.Upstream
+		peer.Downstream = indexed.Downstream
+		peer.QuotaUsed = indexed.QuotaUsed
+		peer.QuotaReset = indexed.QuotaReset
+		peer.Handshake = indexed.Handshake
+		peer.Endpoint = indexed.Endpoint
 	}
+	manager.index.put(peer)
 }
 
 func (manager *Manager) unsetPeer(peer *types.PeerInfo) error {
 	err := manager.storage.DeletePeer(peer.ID)
 	errs := multierr.Append(nil, err)
+	if err == nil {
+		manager.index.remove(peer.ID)
+		manager.closeLeases(peer)
+		manager.pushEvent(eventlog.PeerRemove, peer)
+	}
 
-	err = manager.wireguard.UnsetPeer(peer)
+	iface, err := manager.peerInterface(peer)
+	if err != nil {
+		return multierr.Append(errs, err)
+	}
+
+	if !peer.Pending() {
+		err = iface.Wireguard.UnsetPeer(peer)
+		errs = multierr.Append(errs, err)
+	}
+
+	err = iface.Wireguard.UnsetRoutes(peer.Subnets())
 	errs = multierr.Append(errs, err)
 
-	err = manager.ip4am.Unset(*peer.Ipv4)
+	err = iface.IP4am.Unset(*peer.Ipv4)
 	errs = multierr.Append(errs, err)
+
+	if iface.IP6am != nil && peer.Ipv6 != nil {
+		err = iface.IP6am.Unset(*peer.Ipv6)
+		errs = multierr.Append(errs, err)
+	}
 	return errs
 }
 
 // setPeer changes the given PeerInfo,
-// fields: ID, IPv4
+// fields: ID, IPv4, IPv6
 func (manager *Manager) setPeer(peer *types.PeerInfo) error {
-	err := func() error {
+	iface, err := manager.peerInterface(peer)
+	if err != nil {
+		return err
+	}
+
+	if peer.PresharedKey != nil && len(*peer.PresharedKey) == 0 {
+		peer.PresharedKey = nil
+	}
+	if peer.Routes != nil && len(*peer.Routes) == 0 {
+		peer.Routes = nil
+	}
+	if peer.RoutedSubnets != nil && len(*peer.RoutedSubnets) == 0 {
+		peer.RoutedSubnets = nil
+	}
+	if peer.DNS != nil && len(*peer.DNS) == 0 {
+		peer.DNS = nil
+	}
+
+	if peer.WireguardPublicKey != nil && manager.index.hasKey(*peer.WireguardPublicKey, peer.ID) {
+		return errDuplicateKey
+	}
+
+	if err := manager.checkRoutedSubnets(peer); err != nil {
+		return err
+	}
+
+	if err := manager.inheritGroup(peer, nil); err != nil {
+		return err
+	}
+
+	var ipv6Set bool
+	err = func() error {
 		if peer.Expired() {
 			return xerror.EInvalidArgument("peer already expired", nil)
 		}
 
 		if peer.Ipv4 == nil || peer.Ipv4.IP == nil {
 			// Allocate IP, if necessary
-			ipv4, err := manager.ip4am.Alloc(peer.GetNetworkPolicy())
+			ipv4, err := iface.IP4am.Alloc(peer.GetNetworkPolicy())
 			if err != nil {
 				return err
 			}
@@ -86,12 +126,28 @@ func (manager *Manager) setPeer(peer *types.PeerInfo) error {
 			peer.Ipv4 = &ipv4
 		} else {
 			// Check if IP can be used
-			err := manager.ip4am.Set(*peer.Ipv4, peer.GetNetworkPolicy())
+			err := iface.IP4am.Set(*peer.Ipv4, peer.GetNetworkPolicy())
 			if err != nil {
 				return err
 			}
 		}
 
+		if iface.IP6am == nil {
+			peer.Ipv6 = nil
+		} else if peer.Ipv6 == nil || peer.Ipv6.IP == nil {
+			ipv6, err := iface.IP6am.Alloc()
+			if err != nil {
+				return err
+			}
+			peer.Ipv6 = &ipv6
+			ipv6Set = true
+		} else {
+			if err := iface.IP6am.Set(*peer.Ipv6); err != nil {
+				return err
+			}
+			ipv6Set = true
+		}
+
 		// Set counters to zeros to prevent any fails on update stats operation
 		if peer.Upstream == nil {
 			var zeroVal int64
@@ -109,9 +165,11 @@ func (manager *Manager) setPeer(peer *types.PeerInfo) error {
 		}
 		peer.ID = id
 
-		// Set peer in wireguard
-		if err := manager.wireguard.SetPeer(peer); err != nil {
-			return err
+		// Set peer in wireguard, the pending shared peer gets there on the activation
+		if !peer.Pending() {
+			if err := iface.Wireguard.SetPeer(peer); err != nil {
+				return err
+			}
 		}
 
 		return nil
@@ -119,7 +177,11 @@ func (manager *Manager) setPeer(peer *types.PeerInfo) error {
 	// rollback an action on error
 	if err != nil {
 		if peer.Ipv4 != nil {
-			_ = manager.ip4am.Unset(*peer.Ipv4)
+			_ = iface.IP4am.Unset(*peer.Ipv4)
+		}
+
+		if ipv6Set {
+			_ = iface.IP6am.Unset(*peer.Ipv6)
 		}
 
 		if peer.ID > 0 {
@@ -129,28 +191,107 @@ func (manager *Manager) setPeer(peer *types.PeerInfo) error {
 		return err
 	}
 
+	if err := iface.Wireguard.SetRoutes(peer.Subnets()); err != nil {
+		zap.L().Error("failed to route the peer subnets", zap.Int64("id", peer.ID), zap.Error(err))
+	}
+
+	manager.indexPeer(peer.ID)
+	manager.openLeases(peer)
+	manager.pushEvent(eventlog.PeerAdd, peer)
 	return nil
 }
 
 // updatePeer changes given newPeer,
-// fields: ID, IPv4
+// fields: ID, IPv4, IPv6
 func (manager *Manager) updatePeer(newPeer *types.PeerInfo) error {
 	if newPeer.Expired() {
 		return manager.unsetPeer(newPeer)
 	}
 
 	// Find old peer to remove it from wireguard interface
-	oldPeer, err := manager.storage.GetPeer(newPeer.ID)
+	oldPeer, ok := manager.index.get(newPeer.ID)
+	if !ok {
+		return xerror.EEntryNotFound("peer not found", nil, zap.Int64("id", newPeer.ID))
+	}
+
+	if newPeer.WireguardPublicKey != nil && manager.index.hasKey(*newPeer.WireguardPublicKey, newPeer.ID) {
+		return errDuplicateKey
+	}
+
+	// Peers keep their group unless another is given, zero leaves the group
+	if newPeer.GroupId == nil {
+		newPeer.GroupId = oldPeer.GroupId
+	} else if *newPeer.GroupId == 0 {
+		newPeer.GroupId = nil
+	}
+	if err := manager.inheritGroup(newPeer, oldPeer.GroupId); err != nil {
+		return err
+	}
+
+	// Peers keep the interface they were created on
+	if newPeer.WireguardInterface == nil {
+		newPeer.WireguardInterface = oldPeer.WireguardInterface
+	}
+	// Keep the activation time of the shared peer unless it is activated again
+	if newPeer.Activated == nil {
+		newPeer.Activated = oldPeer.Activated
+	}
+	// Keep the preshared key unless another is given, the empty one removes the key
+	if newPeer.PresharedKey == nil {
+		newPeer.PresharedKey = oldPeer.PresharedKey
+	} else if len(*newPeer.PresharedKey) == 0 {
+		newPeer.PresharedKey = nil
+	}
+	// The same for the client routes, the empty ones fall back to the configured routes
+	if newPeer.Routes == nil {
+		newPeer.Routes = oldPeer.Routes
+	} else if len(*newPeer.Routes) == 0 {
+		newPeer.Routes = nil
+	}
+	// and the routed subnets, the empty list removes them
+	if newPeer.RoutedSubnets == nil {
+		newPeer.RoutedSubnets = oldPeer.RoutedSubnets
+	} else if len(*newPeer.RoutedSubnets) == 0 {
+		newPeer.RoutedSubnets = nil
+	}
+	if err := manager.checkRoutedSubnets(newPeer); err != nil {
+		return err
+	}
+	// and the DNS servers, the empty ones fall back to the group and the interface settings
+	if newPeer.DNS == nil {
+		newPeer.DNS = oldPeer.DNS
+	} else if len(*newPeer.DNS) == 0 {
+		newPeer.DNS = nil
+	}
+	// The shared link is kept unless another is given, the empty sharing key revokes it
+	if newPeer.SharingKey == nil {
+		newPeer.SharingKey = oldPeer.SharingKey
+		newPeer.SharingKeyExpiration = oldPeer.SharingKeyExpiration
+		newPeer.SharingActivations = oldPeer.SharingActivations
+		newPeer.SharingMaxActivations = oldPeer.SharingMaxActivations
+	} else if len(*newPeer.SharingKey) == 0 {
+		newPeer.SharingKey = nil
+		newPeer.SharingKeyExpiration = nil
+		newPeer.SharingActivations = nil
+		newPeer.SharingMaxActivations = nil
+	}
+	iface, err := manager.peerInterface(oldPeer)
 	if err != nil {
 		return err
 	}
+	if newIface, err := manager.peerInterface(newPeer); err != nil {
+		return err
+	} else if newIface != iface {
+		return xerror.EInvalidField("can't move peer to another wireguard interface", "interface", nil)
+	}
 
+	var ipv6Set, policySet bool
 	ipOK, dbOK, wgOK, err := func() (bool, bool, bool, error) {
 		var ipOK, dbOK, wgOK bool
 		// Prepare ipv4 address
 		if newPeer.Ipv4 == nil {
 			// IP is not set - allocate new one
-			ipv4, err := manager.ip4am.Alloc(newPeer.GetNetworkPolicy())
+			ipv4, err := iface.IP4am.Alloc(newPeer.GetNetworkPolicy())
 			if err != nil {
 				// TODO: Differentiate log level by error type (i.e. no space is debug message, others are errors)
 				zap.L().Debug("can't allocate new IP for existing peer", zap.Error(err))
@@ -163,9 +304,33 @@ func (manager *Manager) updatePeer(newPeer *types.PeerInfo) error {
 			}
 		} else if !newPeer.Ipv4.Equal(*oldPeer.Ipv4) {
 			// Try to set up new ip, if it differs from old one
-			if err := manager.ip4am.Set(*newPeer.Ipv4, newPeer.GetNetworkPolicy()); err != nil {
+			if err := iface.IP4am.Set(*newPeer.Ipv4, newPeer.GetNetworkPolicy()); err != nil {
+				return ipOK, dbOK, wgOK, err
+			}
+		} else if newPeer.GetNetworkPolicy() != oldPeer.GetNetworkPolicy() {
+			// Re-apply the changed network policy to the same address
+			_ = iface.IP4am.Unset(*oldPeer.Ipv4)
+			if err := iface.IP4am.Set(*newPeer.Ipv4, newPeer.GetNetworkPolicy()); err != nil {
+				_ = iface.IP4am.Set(*oldPeer.Ipv4, oldPeer.GetNetworkPolicy())
 				return ipOK, dbOK, wgOK, err
 			}
+			policySet = true
+		}
+
+		// Prepare ipv6 address: keep the old one unless another is given explicitly
+		if iface.IP6am == nil {
+			newPeer.Ipv6 = nil
+		} else if newPeer.Ipv6 == nil {
+			newPeer.Ipv6 = oldPeer.Ipv6
+		}
+
+		if newPeer.Ipv6 != nil && (oldPeer.Ipv6 == nil || !newPeer.Ipv6.Equal(*oldPeer.Ipv6)) {
+			if err := iface.IP6am.Set(*newPeer.Ipv6); err != nil {
+				// Let the new ipv4 address be released on revert
+				ipOK = true
+				return ipOK, dbOK, wgOK, err
+			}
+			ipv6Set = true
 		}
 
 		// We finished IP updating
@@ -182,18 +347,23 @@ func (manager *Manager) updatePeer(newPeer *types.PeerInfo) error {
 		newPeer.ID = id
 		dbOK = true
 
-		// Update wireguard peer
-		if *oldPeer.WireguardPublicKey != *newPeer.WireguardPublicKey {
+		// Update wireguard peer, the pending shared peers are not there
+		if !oldPeer.Pending() && !equalPtr(oldPeer.WireguardPublicKey, newPeer.WireguardPublicKey) {
 			// Key changed - we need remove old peer and set new
-			if err := manager.wireguard.UnsetPeer(oldPeer); err != nil {
+			if err := iface.Wireguard.UnsetPeer(oldPeer); err != nil {
 				return ipOK, dbOK, wgOK, err
 			}
 		}
 
-		if err := manager.wireguard.SetPeer(newPeer); err != nil {
-			zap.L().Error("failed to set new peer, trying to revert old", zap.Error(err))
-			err = manager.wireguard.SetPeer(oldPeer)
-			return ipOK, dbOK, wgOK, err
+		if !newPeer.Pending() {
+			if err := iface.Wireguard.SetPeer(newPeer); err != nil {
+				if oldPeer.Pending() {
+					return ipOK, dbOK, wgOK, err
+				}
+				zap.L().Error("failed to set new peer, trying to revert old", zap.Error(err))
+				err = iface.Wireguard.SetPeer(oldPeer)
+				return ipOK, dbOK, wgOK, err
+			}
 		}
 
 		wgOK = true
@@ -208,18 +378,75 @@ func (manager *Manager) updatePeer(newPeer *types.PeerInfo) error {
 
 		if ipOK && !newPeer.Ipv4.Equal(*oldPeer.Ipv4) {
 			// Try to cleanup new IP
-			_ = manager.ip4am.Unset(*newPeer.Ipv4)
+			_ = iface.IP4am.Unset(*newPeer.Ipv4)
+		}
+
+		if policySet {
+			// Try to restore the old network policy
+			_ = iface.IP4am.Unset(*oldPeer.Ipv4)
+			_ = iface.IP4am.Set(*oldPeer.Ipv4, oldPeer.GetNetworkPolicy())
+		}
+
+		if ipv6Set {
+			_ = iface.IP6am.Unset(*newPeer.Ipv6)
 		}
 
 		if wgOK {
 			// Try to revert wireguard peer
-			_ = manager.wireguard.UnsetPeer(newPeer)
-			_ = manager.wireguard.SetPeer(oldPeer)
+			if !newPeer.Pending() {
+				_ = iface.Wireguard.UnsetPeer(newPeer)
+			}
+			if !oldPeer.Pending() {
+				_ = iface.Wireguard.SetPeer(oldPeer)
+			}
 		}
 
 		return err
 	}
 
+	// Release the replaced ipv6 address
+	if ipv6Set && oldPeer.Ipv6 != nil && iface.IP6am.Contains(*oldPeer.Ipv6) {
+		_ = iface.IP6am.Unset(*oldPeer.Ipv6)
+	}
+
+	// Follow the routed subnets changes
+	if err := iface.Wireguard.UnsetRoutes(staleSubnets(oldPeer.Subnets(), newPeer.Subnets())); err != nil {
+		zap.L().Error("failed to remove the stale peer subnets", zap.Int64("id", newPeer.ID), zap.Error(err))
+	}
+	if err := iface.Wireguard.SetRoutes(newPeer.Subnets()); err != nil {
+		zap.L().Error("failed to route the peer subnets", zap.Int64("id", newPeer.ID), zap.Error(err))
+	}
+
+	// Fill in the fields which are managed by the storage only
+	// to provide the full peer state to the event consumers.
+	if newPeer.Created == nil {
+		newPeer.Created = oldPeer.Created
+	}
+	if newPeer.Activity == nil {
+		newPeer.Activity = oldPeer.Activity
+	}
+	if newPeer.Upstream == nil {
+		newPeer.Upstream = oldPeer.Upstream
+	}
+	if newPeer.Downstream == nil {
+		newPeer.Downstream = oldPeer.Downstream
+	}
+	if newPeer.QuotaUsed == nil {
+		newPeer.QuotaUsed = oldPeer.QuotaUsed
+	}
+	if newPeer.QuotaReset == nil {
+		newPeer.QuotaReset = oldPeer.QuotaReset
+	}
+	if newPeer.Handshake == nil {
+		newPeer.Handshake = oldPeer.Handshake
+	}
+	if newPeer.Endpoint == nil {
+		newPeer.Endpoint = oldPeer.Endpoint
+	}
+
+	manager.indexPeer(newPeer.ID)
+	manager.renewLeases(oldPeer, newPeer)
+	manager.pushEvent(eventlog.PeerUpdate, newPeer)
 	return nil
 }
 
@@ -228,15 +455,7 @@ func (manager *Manager) findPeerByIdentifiers(identifiers *types.PeerIdentifiers
 		return nil, xerror.EInvalidArgument("no identifiers", nil)
 	}
 
-	peerQuery := types.PeerInfo{
-		PeerIdentifiers: *identifiers,
-	}
-
-	peers, err := manager.storage.SearchPeers(&peerQuery)
-	if err != nil {
-		return nil, err
-	}
-
+	peers := manager.index.search(identifiers)
 	if len(peers) == 0 {
 		return nil, xerror.EEntryNotFound("peer not found", nil)
 	}
@@ -248,22 +467,35 @@ func (manager *Manager) findPeerByIdentifiers(identifiers *types.PeerIdentifiers
 	return peers[0], nil
 }
 
+// sync updates the peer stats and fixes the interface drift under the manager lock,
+// the stats are stored and reported once the lock is released.
 func (manager *Manager) sync() {
-	manager.syncPeerStats()
+	manager.lock.Lock()
+	synced := manager.syncPeerStats()
+	manager.reconcile()
+	manager.lock.Unlock()
+
+	if synced != nil {
+		manager.flushPeerStats(synced)
+	}
 }
 
+// historyPurgeInterval defines how often the history out of the retention period is removed
+const historyPurgeInterval = time.Hour
+
 func (manager *Manager) background() {
 	syncPeerTicker := time.NewTicker(manager.runtime.Settings.GetUpdateStatisticsInterval().Value())
 	zap.L().Debug("Start update peer stats", zap.Stringer("interval", manager.runtime.Settings.GetUpdateStatisticsInterval()))
 
+	historyTicker := time.NewTicker(historyPurgeInterval)
+
 	defer func() {
 		syncPeerTicker.Stop()
+		historyTicker.Stop()
 		close(manager.done)
 	}()
 
-	manager.lock.Lock()
 	manager.sync()
-	manager.lock.Unlock()
 
 	for {
 		select {
@@ -271,9 +503,12 @@ func (manager *Manager) background() {
 			zap.L().Info("Shutting down manager background process")
 			return
 		case <-syncPeerTicker.C:
-			manager.lock.Lock()
 			manager.sync()
-			manager.lock.Unlock()
+		case <-historyTicker.C:
+			// touches the history tables only, no need to lock
+			manager.purgeTrafficHistory()
+			manager.purgeIPLeases()
+			manager.purgeEndpointHistory()
 		}
 	}
 }
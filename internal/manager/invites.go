@@ -0,0 +1,85 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// RedeemInvite creates the peer of the device enrolling by the invite code
+func (manager *Manager) RedeemInvite(code string, publicKey string) (*types.PeerInfo, error) {
+	if !manager.running.Load().(bool) {
+		return nil, xerror.EUnavailable("server is shutting down", nil)
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	invite, err := manager.storage.GetInviteByCode(code)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if invite.Expired(now) {
+		return nil, xerror.EEntryNotFound("invite has already been expired", nil)
+	}
+	if invite.UsedUp() {
+		return nil, types.ErrInviteUsedUp
+	}
+
+	peer := invite.NewPeer(publicKey, now)
+	if err := peer.Validate("ID", "Ipv4"); err != nil {
+		return nil, err
+	}
+	if err := manager.setPeer(&peer); err != nil {
+		return nil, err
+	}
+
+	redeemed, ok := manager.index.get(peer.ID)
+	if !ok {
+		redeemed = &peer
+	}
+
+	// The redemption is counted along with its record, the peer is taken back
+	// if the invite has been used up since it was read.
+	err = manager.storage.RedeemInvite(&types.InviteRedemption{
+		InviteId:           invite.ID,
+		PeerId:             redeemed.ID,
+		WireguardPublicKey: redeemed.WireguardPublicKey,
+		Ipv4:               redeemed.Ipv4,
+	})
+	if err != nil {
+		if err := manager.unsetPeer(&peer); err != nil {
+			zap.L().Error("failed to remove the peer of the failed invite redemption", zap.Int64("id", peer.ID), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	zap.L().Info("invite redeemed", zap.Int64("invite", invite.ID), zap.Int64("id", peer.ID))
+	return redeemed, nil
+}
+
+// InvitePeers returns the existing peers created by the invite,
+// see storage.ListInviteRedemptions for the expired and removed ones.
+func (manager *Manager) InvitePeers(id int64) ([]*types.PeerInfo, error) {
+	if !manager.running.Load().(bool) {
+		return nil, xerror.EUnavailable("server is shutting down", nil)
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	peers := make([]*types.PeerInfo, 0)
+	for _, peer := range manager.peers() {
+		if peer.InviteId != nil && *peer.InviteId == id {
+			p := *peer
+			peers = append(peers, &p)
+		}
+	}
+	return peers, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// openLeases records the addresses of the peer in the IP leases history.
+// The history is not critical for the peer itself, so the errors are logged only.
+func (manager *Manager) openLeases(peer *types.PeerInfo) {
+	now := xtime.Now()
+	for _, ip := range peerAddresses(peer) {
+		lease := &types.IPLease{
+			IP:             ip,
+			PeerId:         peer.ID,
+			UserId:         peer.UserId,
+			InstallationId: peer.InstallationId,
+			WireguardKey:   peer.WireguardPublicKey,
+			Started:        &now,
+		}
+		if err := manager.storage.OpenIPLease(lease); err != nil {
+			zap.L().Error("failed to open ip lease", zap.Int64("id", peer.ID), zap.String("ip", ip), zap.Error(err))
+		}
+	}
+}
+
+// closeLeases ends the active leases of the peer
+func (manager *Manager) closeLeases(peer *types.PeerInfo) {
+	if err := manager.storage.CloseIPLeases(peer.ID, time.Now()); err != nil {
+		zap.L().Error("failed to close ip leases", zap.Int64("id", peer.ID), zap.Error(err))
+	}
+}
+
+// renewLeases replaces the leases of the peer if its addresses or identity have changed
+func (manager *Manager) renewLeases(oldPeer *types.PeerInfo, newPeer *types.PeerInfo) {
+	if leaseEqual(oldPeer, newPeer) {
+		return
+	}
+
+	manager.closeLeases(oldPeer)
+	manager.openLeases(newPeer)
+}
+
+// purgeIPLeases removes the leases ended out of the retention period
+func (manager *Manager) purgeIPLeases() {
+	retention := manager.runtime.Settings.GetIPLeasesRetention()
+	if retention <= 0 {
+		return
+	}
+
+	n, err := manager.storage.PurgeIPLeases(time.Now().Add(-retention))
+	if err != nil {
+		zap.L().Error("failed to purge ip leases", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		zap.L().Debug("ip leases purged", zap.Int64("leases", n))
+	}
+}
+
+func peerAddresses(peer *types.PeerInfo) []string {
+	var addrs []string
+	if peer.Ipv4 != nil && peer.Ipv4.IP != nil {
+		addrs = append(addrs, peer.Ipv4.String())
+	}
+	if peer.Ipv6 != nil && peer.Ipv6.IP != nil {
+		addrs = append(addrs, peer.Ipv6.String())
+	}
+	return addrs
+}
+
+func leaseEqual(a *types.PeerInfo, b *types.PeerInfo) bool {
+	addrsA, addrsB := peerAddresses(a), peerAddresses(b)
+	if len(addrsA) != len(addrsB) {
+		return false
+	}
+	for i := range addrsA {
+		if addrsA[i] != addrsB[i] {
+			return false
+		}
+	}
+
+	return equalPtr(a.WireguardPublicKey, b.WireguardPublicKey) &&
+		equalPtr(a.UserId, b.UserId) &&
+		equalPtr(a.InstallationId, b.InstallationId)
+}
+
+func equalPtr[T comparable](a *T, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,49 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xnet"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestLeaseEqual(t *testing.T) {
+	ip := func(s string) *xnet.IP {
+		v := xnet.ParseIP(s)
+		return &v
+	}
+	str := func(s string) *string { return &s }
+	peer := func(ipv4 string, ipv6 *xnet.IP, key string, userId *string) *types.PeerInfo {
+		return &types.PeerInfo{
+			Ipv4:            ip(ipv4),
+			Ipv6:            ipv6,
+			WireguardInfo:   types.WireguardInfo{WireguardPublicKey: str(key)},
+			PeerIdentifiers: types.PeerIdentifiers{UserId: userId},
+		}
+	}
+
+	base := peer("10.235.0.2", ip("fd00:235::2"), "key", str("user"))
+	cases := []struct {
+		name  string
+		peer  *types.PeerInfo
+		equal bool
+	}{
+		{"same", peer("10.235.0.2", ip("fd00:235::2"), "key", str("user")), true},
+		{"ipv4 readdressed", peer("10.235.0.3", ip("fd00:235::2"), "key", str("user")), false},
+		{"ipv6 readdressed", peer("10.235.0.2", ip("fd00:235::3"), "key", str("user")), false},
+		{"ipv6 disabled", peer("10.235.0.2", nil, "key", str("user")), false},
+		{"key changed", peer("10.235.0.2", ip("fd00:235::2"), "other", str("user")), false},
+		{"user changed", peer("10.235.0.2", ip("fd00:235::2"), "key", str("other")), false},
+		{"user removed", peer("10.235.0.2", ip("fd00:235::2"), "key", nil), false},
+	}
+
+	for _, cc := range cases {
+		require.Equal(t, cc.equal, leaseEqual(base, cc.peer), cc.name)
+		require.Equal(t, cc.equal, leaseEqual(cc.peer, base), cc.name)
+	}
+}
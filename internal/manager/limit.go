@@ -0,0 +1,77 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"sort"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+var errTooManyPeers = xerror.ENLimitExceeded("too many peers for the user")
+
+// checkPeerLimit checks the new peer of the user against the limit:
+// rejects it or returns the least recently active peers of the user to evict
+// once the new peer is set, depending on the limit.
+func (manager *Manager) checkPeerLimit(peer *types.PeerInfo, limit *types.PeerLimit) ([]*types.PeerInfo, error) {
+	if limit == nil || peer.UserId == nil {
+		return nil, nil
+	}
+	if limit.Max <= 0 {
+		// Nothing to evict to make room for the new peer
+		return nil, errTooManyPeers
+	}
+
+	peers := manager.index.search(&types.PeerIdentifiers{UserId: peer.UserId})
+	excess := len(peers) - limit.Max + 1
+	if excess <= 0 {
+		return nil, nil
+	}
+	if !limit.Evict {
+		return nil, errTooManyPeers
+	}
+
+	return evictionCandidates(peers, excess), nil
+}
+
+// evictPeers removes the peers exceeding the per-user limit.
+func (manager *Manager) evictPeers(peers []*types.PeerInfo, limit *types.PeerLimit) error {
+	for _, old := range peers {
+		zap.L().Info("evicting the least recently active peer of the user",
+			zap.Int64("id", old.ID), zap.Stringp("user_id", old.UserId), zap.Int("limit", limit.Max))
+		if err := manager.unsetPeer(old); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evictionCandidates returns up to n least recently active peers.
+func evictionCandidates(peers []*types.PeerInfo, n int) []*types.PeerInfo {
+	candidates := make([]*types.PeerInfo, len(peers))
+	copy(candidates, peers)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return lastActive(candidates[i]) < lastActive(candidates[j])
+	})
+	if n < len(candidates) {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// lastActive returns the unix time of the last peer activity,
+// the peers never connected are counted since their creation.
+func lastActive(peer *types.PeerInfo) int64 {
+	var last int64
+	for _, t := range []*xtime.Time{peer.Created, peer.Activity, peer.Handshake} {
+		if t != nil && t.Unix() > last {
+			last = t.Unix()
+		}
+	}
+	return last
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestEvictionCandidates(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *xtime.Time { return &xtime.Time{Time: now.Add(d)} }
+
+	peers := []*types.PeerInfo{
+		{ID: 1, Created: at(-time.Hour), Handshake: at(-time.Minute)},
+		{ID: 2, Created: at(-2 * time.Hour)},
+		{ID: 3, Created: at(-3 * time.Hour), Activity: at(-30 * time.Minute)},
+		{ID: 4, Created: at(-10 * time.Minute)},
+		{ID: 5, Created: at(-2 * time.Hour)},
+	}
+
+	cases := []struct {
+		n   int
+		ids []int64
+	}{
+		{n: 0, ids: []int64{}},
+		{n: 1, ids: []int64{2}},
+		{n: 2, ids: []int64{2, 5}},
+		{n: 4, ids: []int64{2, 5, 3, 4}},
+		{n: 10, ids: []int64{2, 5, 3, 4, 1}},
+	}
+
+	for _, cc := range cases {
+		ids := []int64{}
+		for _, peer := range evictionCandidates(peers, cc.n) {
+			ids = append(ids, peer.ID)
+		}
+		require.Equal(t, cc.ids, ids, "n: %d", cc.n)
+	}
+
+	for i, peer := range peers {
+		require.EqualValues(t, i+1, peer.ID, "the given peers must be kept in order")
+	}
+}
@@ -7,17 +7,15 @@ package manager
 import (
 	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/vpnhouse/common-lib-go/geoip"
-	"github.com/vpnhouse/common-lib-go/ipam"
 	"github.com/vpnhouse/common-lib-go/statutils"
 	"github.com/vpnhouse/common-lib-go/xstats"
+	"github.com/vpnhouse/tunnel/internal/eventlog"
 	"github.com/vpnhouse/tunnel/internal/runtime"
 	"github.com/vpnhouse/tunnel/internal/stats"
 	"github.com/vpnhouse/tunnel/internal/storage"
 	"github.com/vpnhouse/tunnel/internal/types"
-	"github.com/vpnhouse/tunnel/internal/wireguard"
 	"go.uber.org/zap"
 )
 
@@ -27,33 +25,37 @@ type Manager struct {
 	runtime       *runtime.TunnelRuntime
 	lock          sync.RWMutex
 	storage       *storage.Storage
-	wireguard     *wireguard.Wireguard
-	ip4am         *ipam.IPAM
+	interfaces    []*Interface // the primary interface goes first
 	statsReporter *xstats.Service
 	geoipService  *geoip.Instance
+	eventLog      eventlog.EventPusher
 	wgStats       atomic.Pointer[wgStats]
+	extraStats    atomic.Pointer[stats.ExtraStats]
+	index         *peerIndex
 	running       atomic.Value
 	stop          chan struct{}
 	done          chan struct{}
 
 	upstreamSpeedAvg   *statutils.AvgValue
 	downstreamSpeedAvg *statutils.AvgValue
+	suspendedUsers     map[string]struct{} // users whose peers are suspended due to the user traffic quota
 }
 
 func New(
 	runtime *runtime.TunnelRuntime,
 	storage *storage.Storage,
-	wireguard *wireguard.Wireguard,
-	ip4am *ipam.IPAM,
+	interfaces []*Interface,
 	statsService *stats.Service,
 	geoipService *geoip.Instance,
+	eventLog eventlog.EventPusher,
 ) (*Manager, error) {
 	manager := &Manager{
 		runtime:            runtime,
 		storage:            storage,
-		wireguard:          wireguard,
-		ip4am:              ip4am,
+		interfaces:         interfaces,
 		geoipService:       geoipService,
+		eventLog:           eventLog,
+		index:              newPeerIndex(),
 		stop:               make(chan struct{}),
 		done:               make(chan struct{}),
 		upstreamSpeedAvg:   statutils.NewAvgValue(10),
@@ -61,28 +63,22 @@ func New(
 	}
 	var err error
 	manager.statsReporter, err = statsService.Register(ProtoName, func() stats.ExtraStats {
-		peers, err := manager.peers()
-		if err != nil {
-			return stats.ExtraStats{}
-		}
-
-		now := time.Now()
-		var active int
-		for _, peer := range peers {
-			if peer.Activity != nil && now.Sub(*peer.Activity.TimePtr()) < time.Minute {
-				active += 1
-			}
-		}
-
-		return stats.ExtraStats{
-			PeersTotal:  len(peers),
-			PeersActive: active,
+		// counted by syncPeerStats, so the manager is not locked here
+		if extra := manager.extraStats.Load(); extra != nil {
+			return *extra
 		}
+		return stats.ExtraStats{}
 	})
 	if err != nil {
 		return nil, err
 	}
 	manager.restorePeers()
+	for _, iface := range interfaces {
+		if iface.Wireguard.Adopted() {
+			manager.seedPeerStats()
+			break
+		}
+	}
 	manager.running.Store(true)
 
 	// Run background goroutine
@@ -110,11 +106,33 @@ func (manager *Manager) Running() bool {
 }
 
 func (manager *Manager) GetRuntimePeerStat(peer *types.PeerInfo) PeerStats {
+	if peer.WireguardPublicKey == nil {
+		// not activated shared peer
+		return PeerStats{}
+	}
 	statsPtr := manager.wgStats.Load()
 	return (*statsPtr)[*peer.WireguardPublicKey]
 }
 
 // admin.Handler implementation
 func (manager *Manager) KillActiveUserSessions(userId string) {
-	// TODO: add implementation
+	if !manager.Running() {
+		return
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	peers := manager.index.search(&types.PeerIdentifiers{UserId: &userId})
+	if len(peers) == 0 {
+		return
+	}
+
+	for _, peer := range peers {
+		if err := manager.unsetPeer(peer); err != nil {
+			zap.L().Error("failed to unset peer of the restricted user",
+				zap.String("user_id", userId), zap.Int64("id", peer.ID), zap.Error(err))
+		}
+	}
+
+	zap.L().Info("user sessions killed", zap.String("user_id", userId), zap.Int("peers", len(peers)))
 }
@@ -5,13 +5,12 @@
 package manager
 
 import (
-	"database/sql"
-	"errors"
 	"time"
 
 	"github.com/vpnhouse/common-lib-go/xerror"
 	"github.com/vpnhouse/common-lib-go/xtime"
 	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
 )
 
 func (manager *Manager) SetPeer(info *types.PeerInfo) error {
@@ -22,12 +21,7 @@ func (manager *Manager) SetPeer(info *types.PeerInfo) error {
 	defer manager.lock.Unlock()
 
 	// note: manager.setPeer changes given struct
-	err := manager.setPeer(info)
-	if err != nil {
-		return err
-	}
-	manager.syncPeerStats()
-	return nil
+	return manager.setPeer(info)
 }
 
 func (manager *Manager) UpdatePeer(info *types.PeerInfo) error {
@@ -36,12 +30,7 @@ func (manager *Manager) UpdatePeer(info *types.PeerInfo) error {
 	}
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
-	err := manager.updatePeer(info)
-	if err != nil {
-		return err
-	}
-	manager.syncPeerStats()
-	return nil
+	return manager.updatePeer(info)
 }
 
 func (manager *Manager) GetPeer(id int64) (*types.PeerInfo, error) {
@@ -51,7 +40,11 @@ func (manager *Manager) GetPeer(id int64) (*types.PeerInfo, error) {
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
 
-	return manager.storage.GetPeer(id)
+	peer, ok := manager.index.get(id)
+	if !ok {
+		return nil, xerror.EEntryNotFound("peer not found", nil, zap.Int64("id", id))
+	}
+	return peer, nil
 }
 
 func (manager *Manager) UnsetPeer(id int64) error {
@@ -61,20 +54,12 @@ func (manager *Manager) UnsetPeer(id int64) error {
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
 
-	info, err := manager.storage.GetPeer(id)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil
-		}
-		return err
+	info, ok := manager.index.get(id)
+	if !ok {
+		return nil
 	}
 
-	err = manager.unsetPeer(info)
-	if err != nil {
-		return err
-	}
-	manager.syncPeerStats()
-	return nil
+	return manager.unsetPeer(info)
 }
 
 func (manager *Manager) UnsetPeerByIdentifiers(identifiers *types.PeerIdentifiers) error {
@@ -89,12 +74,7 @@ func (manager *Manager) UnsetPeerByIdentifiers(identifiers *types.PeerIdentifier
 		return err
 	}
 
-	err = manager.unsetPeer(info)
-	if err != nil {
-		return err
-	}
-	manager.syncPeerStats()
-	return nil
+	return manager.unsetPeer(info)
 }
 
 func (manager *Manager) ListPeers() ([]*types.PeerInfo, error) {
@@ -104,50 +84,91 @@ func (manager *Manager) ListPeers() ([]*types.PeerInfo, error) {
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
 
-	return manager.storage.SearchPeers(nil)
+	return manager.index.search(&types.PeerIdentifiers{}), nil
 }
 
-func (manager *Manager) ConnectPeer(info *types.PeerInfo) error {
+// ConnectPeer creates the peer or updates the existing one with the same identifiers.
+// The existing peer keeps its preshared key, the given one is used if the peer has none.
+// The new peers are subject to the given per-user limit, nil means unlimited.
+func (manager *Manager) ConnectPeer(info *types.PeerInfo, limit *types.PeerLimit) error {
 	if !manager.running.Load().(bool) {
 		return xerror.EUnavailable("server is shutting down", nil)
 	}
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
 
-	oldPeerShadow := types.PeerInfo{
-		PeerIdentifiers: types.PeerIdentifiers{
-			UserId:         info.UserId,
-			InstallationId: info.InstallationId,
-		},
-	}
-
-	oldPeers, err := manager.storage.SearchPeers(&oldPeerShadow)
-	if err != nil {
-		return err
-	}
-
+	oldPeers := manager.index.search(&types.PeerIdentifiers{
+		UserId:         info.UserId,
+		InstallationId: info.InstallationId,
+	})
 	if len(oldPeers) == 0 {
-		err = manager.setPeer(info)
+		if err := manager.checkQuota(info); err != nil {
+			return err
+		}
+		evict, err := manager.checkPeerLimit(info, limit)
 		if err != nil {
 			return err
 		}
-		manager.syncPeerStats()
-		return nil
+		// Evict the old peers only when the new one is set,
+		// the user must not lose the working peers if it fails.
+		if err := manager.setPeer(info); err != nil {
+			return err
+		}
+
+		return manager.evictPeers(evict, limit)
 	}
 
 	if len(oldPeers) > 1 {
 		return xerror.EInternalError("too many peers for identifiers", nil)
 	}
 
-	info.ID = oldPeers[0].ID
-	info.Ipv4 = oldPeers[0].Ipv4
+	if err := manager.checkQuota(oldPeers[0]); err != nil {
+		return err
+	}
 
-	err = manager.updatePeer(info)
+	iface, err := manager.peerInterface(info)
 	if err != nil {
 		return err
 	}
-	manager.syncPeerStats()
-	return nil
+	if oldIface, _ := manager.peerInterface(oldPeers[0]); oldIface != iface {
+		// The client has switched to another interface,
+		// re-create the peer there keeping its quota usage.
+		info.QuotaBytes = oldPeers[0].QuotaBytes
+		info.QuotaPeriod = oldPeers[0].QuotaPeriod
+		info.QuotaUsed = oldPeers[0].QuotaUsed
+		info.QuotaReset = oldPeers[0].QuotaReset
+		if oldPeers[0].PresharedKey != nil || info.PresharedKey == nil {
+			info.PresharedKey = oldPeers[0].PresharedKey
+		}
+		if info.GroupId == nil {
+			info.GroupId = oldPeers[0].GroupId
+		}
+		if info.Routes == nil {
+			info.Routes = oldPeers[0].Routes
+		}
+		if info.RoutedSubnets == nil {
+			info.RoutedSubnets = oldPeers[0].RoutedSubnets
+		}
+		if info.DNS == nil {
+			info.DNS = oldPeers[0].DNS
+		}
+
+		if err := manager.unsetPeer(oldPeers[0]); err != nil {
+			return err
+		}
+		return manager.setPeer(info)
+	}
+
+	info.ID = oldPeers[0].ID
+	info.Ipv4 = oldPeers[0].Ipv4
+	info.Ipv6 = oldPeers[0].Ipv6
+	info.QuotaBytes = oldPeers[0].QuotaBytes
+	info.QuotaPeriod = oldPeers[0].QuotaPeriod
+	if oldPeers[0].PresharedKey != nil {
+		info.PresharedKey = oldPeers[0].PresharedKey
+	}
+
+	return manager.updatePeer(info)
 }
 
 func (manager *Manager) UpdatePeerExpiration(identifiers *types.PeerIdentifiers, expires *time.Time) error {
@@ -161,15 +182,7 @@ func (manager *Manager) UpdatePeerExpiration(identifiers *types.PeerIdentifiers,
 	manager.lock.Lock()
 	defer manager.lock.Unlock()
 
-	peerQuery := types.PeerInfo{
-		PeerIdentifiers: *identifiers,
-	}
-
-	peers, err := manager.storage.SearchPeers(&peerQuery)
-	if err != nil {
-		return err
-	}
-
+	peers := manager.index.search(identifiers)
 	if len(peers) == 0 {
 		return xerror.EEntryNotFound("peer not found", nil)
 	}
@@ -179,10 +192,5 @@ func (manager *Manager) UpdatePeerExpiration(identifiers *types.PeerIdentifiers,
 	}
 
 	peers[0].Expires = xtime.FromTimePtr(expires)
-	err = manager.updatePeer(peers[0])
-	if err != nil {
-		return err
-	}
-	manager.syncPeerStats()
-	return nil
+	return manager.updatePeer(peers[0])
 }
@@ -0,0 +1,152 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/eventlog"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+var errQuotaExceeded = xerror.ENLimitExceeded("traffic quota exceeded")
+
+// checkQuota rejects the peer if it or its user has used up the traffic quota
+func (manager *Manager) checkQuota(peer *types.PeerInfo) error {
+	if peer.QuotaExceeded() && !peer.QuotaResetDue(time.Now()) {
+		return errQuotaExceeded
+	}
+
+	if peer.UserId == nil {
+		return nil
+	}
+
+	quota, err := manager.storage.FindUserQuota(*peer.UserId)
+	if err != nil {
+		return err
+	}
+
+	if quota != nil && quota.Exceeded() && !quota.ResetDue(time.Now()) {
+		return errQuotaExceeded
+	}
+	return nil
+}
+
+// resetPeerQuota resets the quota usage of the peer when the quota period ends.
+// Returns true if the peer has been suspended before the reset.
+func (manager *Manager) resetPeerQuota(peer *types.PeerInfo, now time.Time) bool {
+	if !peer.QuotaResetDue(now) {
+		return false
+	}
+
+	suspended := peer.QuotaExceeded()
+	peer.ResetQuota(now)
+	if err := manager.storage.UpdatePeerQuota(peer); err != nil {
+		zap.L().Error("failed to reset peer quota", zap.Int64("id", peer.ID), zap.Error(err))
+	}
+
+	return suspended
+}
+
+// suspendPeer removes the peer which used up its quota from the wireguard interface
+// keeping the peer in the storage until the quota is reset.
+func (manager *Manager) suspendPeer(peer *types.PeerInfo) {
+	iface, err := manager.peerInterface(peer)
+	if err != nil {
+		zap.L().Error("failed to suspend peer", zap.Int64("id", peer.ID), zap.Error(err))
+		return
+	}
+
+	if err := iface.Wireguard.UnsetPeer(peer); err != nil {
+		zap.L().Error("failed to suspend peer", zap.Int64("id", peer.ID), zap.Error(err))
+		return
+	}
+
+	zap.L().Info("peer suspended due to the traffic quota", zap.Int64("id", peer.ID), zap.Int64p("quota", peer.QuotaBytes))
+	manager.pushEvent(eventlog.PeerQuotaExceeded, peer)
+}
+
+// resumePeer puts the peer back to the wireguard interface after the quota reset
+func (manager *Manager) resumePeer(peer *types.PeerInfo) {
+	iface, err := manager.peerInterface(peer)
+	if err != nil {
+		zap.L().Error("failed to resume peer", zap.Int64("id", peer.ID), zap.Error(err))
+		return
+	}
+
+	if err := iface.Wireguard.SetPeer(peer); err != nil {
+		zap.L().Error("failed to resume peer", zap.Int64("id", peer.ID), zap.Error(err))
+		return
+	}
+
+	zap.L().Info("peer resumed after the traffic quota reset", zap.Int64("id", peer.ID))
+}
+
+// userSuspended reports whether the peer is suspended due to the traffic quota of its user
+func (manager *Manager) userSuspended(peer *types.PeerInfo) bool {
+	if peer.UserId == nil {
+		return false
+	}
+	_, ok := manager.suspendedUsers[*peer.UserId]
+	return ok
+}
+
+// syncUserQuotas accounts the traffic of users, suspends the peers of ones who exceeded
+// their quota and resumes the peers of ones whose quota has been reset or raised.
+func (manager *Manager) syncUserQuotas(peers []*types.PeerInfo, wireguardPeers map[string]*wgtypes.Peer, usage map[string]int64, now time.Time) {
+	quotas, err := manager.storage.ListUserQuotas()
+	if err != nil {
+		return
+	}
+
+	exceeded := make(map[string]struct{})
+	for _, quota := range quotas {
+		if quota.ResetDue(now) {
+			quota.Reset(now)
+			if err := manager.storage.UpdateUserQuotaUsage(quota); err != nil {
+				zap.L().Error("failed to reset user quota", zap.String("user_id", quota.UserId), zap.Error(err))
+			}
+		}
+
+		if delta := usage[quota.UserId]; delta > 0 {
+			quota.QuotaUsed += delta
+			if err := manager.storage.AddUserQuotaUsage(quota.UserId, delta); err != nil {
+				zap.L().Error("failed to update user quota usage", zap.String("user_id", quota.UserId), zap.Error(err))
+			}
+		}
+
+		if quota.Exceeded() {
+			exceeded[quota.UserId] = struct{}{}
+		}
+	}
+
+	previous := manager.suspendedUsers
+	manager.suspendedUsers = exceeded
+	if len(exceeded) == 0 && len(previous) == 0 {
+		return
+	}
+
+	for _, peer := range peers {
+		if peer.UserId == nil || peer.WireguardPublicKey == nil {
+			continue
+		}
+
+		_, configured := wireguardPeers[*peer.WireguardPublicKey]
+		if _, ok := exceeded[*peer.UserId]; ok {
+			if configured {
+				zap.L().Info("suspending peer due to the user traffic quota", zap.Int64("id", peer.ID), zap.String("user_id", *peer.UserId))
+				manager.suspendPeer(peer)
+			}
+			continue
+		}
+
+		if _, ok := previous[*peer.UserId]; ok && !configured && !peer.QuotaExceeded() {
+			manager.resumePeer(peer)
+		}
+	}
+}
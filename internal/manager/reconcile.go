@@ -0,0 +1,226 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"net"
+	"slices"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/stats"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"github.com/vpnhouse/tunnel/internal/wireguard"
+	"go.uber.org/zap"
+)
+
+const (
+	driftMissing    = "missing"
+	driftUnknown    = "unknown"
+	driftMismatched = "mismatched"
+)
+
+var (
+	driftPeers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: stats.Namespace,
+		Name:      "wireguard_drift_peers",
+		Help:      "number of peers differing between the storage and the wireguard interface",
+	}, []string{"kind"})
+
+	driftFixed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: stats.Namespace,
+		Name:      "wireguard_drift_fixed",
+		Help:      "number of peers fixed on the wireguard interface by the reconciliation",
+	}, []string{"kind"})
+)
+
+func init() {
+	prometheus.MustRegister(driftPeers)
+	prometheus.MustRegister(driftFixed)
+}
+
+// DriftPeer describes a single difference between the storage and the wireguard interface
+type DriftPeer struct {
+	ID                 int64    `json:"id,omitempty"`
+	Interface          string   `json:"interface"`
+	PublicKey          string   `json:"public_key"`
+	ExpectedAllowedIPs []string `json:"expected_allowed_ips,omitempty"`
+	ActualAllowedIPs   []string `json:"actual_allowed_ips,omitempty"`
+
+	peer  *types.PeerInfo
+	iface *Interface
+}
+
+// DriftReport lists differences between the storage and the wireguard interface
+type DriftReport struct {
+	// Missing peers are stored but not configured on the interface
+	Missing []DriftPeer `json:"missing"`
+	// Unknown peers are configured on the interface but not stored
+	Unknown []DriftPeer `json:"unknown"`
+	// Mismatched peers are configured with the wrong allowed IPs
+	Mismatched []DriftPeer `json:"mismatched"`
+}
+
+func (r *DriftReport) Empty() bool {
+	return len(r.Missing) == 0 && len(r.Unknown) == 0 && len(r.Mismatched) == 0
+}
+
+// Drift returns differences between the storage and the wireguard interface
+// without fixing them.
+func (manager *Manager) Drift() (*DriftReport, error) {
+	if !manager.Running() {
+		return nil, xerror.EUnavailable("server is shutting down", nil)
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	return manager.drift()
+}
+
+func (manager *Manager) drift() (*DriftReport, error) {
+	peers := manager.peers()
+	report := &DriftReport{
+		Missing:    []DriftPeer{},
+		Unknown:    []DriftPeer{},
+		Mismatched: []DriftPeer{},
+	}
+
+	for _, iface := range manager.interfaces {
+		if err := manager.ifaceDrift(iface, peers, report); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(report.Unknown, func(i, j int) bool {
+		if report.Unknown[i].Interface != report.Unknown[j].Interface {
+			return report.Unknown[i].Interface < report.Unknown[j].Interface
+		}
+		return report.Unknown[i].PublicKey < report.Unknown[j].PublicKey
+	})
+
+	return report, nil
+}
+
+// ifaceDrift adds differences between the storage and the given interface to the report
+func (manager *Manager) ifaceDrift(iface *Interface, peers []*types.PeerInfo, report *DriftReport) error {
+	wireguardPeers, err := iface.Wireguard.GetPeers()
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]struct{}, len(peers))
+	for _, peer := range peers {
+		if peer.WireguardPublicKey == nil {
+			// Not activated shared peer
+			continue
+		}
+		if peerIface, err := manager.peerInterface(peer); err != nil || peerIface != iface {
+			continue
+		}
+		known[*peer.WireguardPublicKey] = struct{}{}
+
+		if peer.Expired() || peer.QuotaExceeded() || manager.userSuspended(peer) {
+			// Expired peers are wiped out and suspended ones are removed by syncPeerStats
+			continue
+		}
+
+		expected := allowedIPsStrings(wireguard.PeerAllowedIPs(peer))
+		wgPeer, ok := wireguardPeers[*peer.WireguardPublicKey]
+		if !ok {
+			report.Missing = append(report.Missing, DriftPeer{
+				ID:                 peer.ID,
+				Interface:          iface.Name,
+				PublicKey:          *peer.WireguardPublicKey,
+				ExpectedAllowedIPs: expected,
+				peer:               peer,
+				iface:              iface,
+			})
+			continue
+		}
+
+		actual := allowedIPsStrings(wgPeer.AllowedIPs)
+		if !slices.Equal(expected, actual) {
+			report.Mismatched = append(report.Mismatched, DriftPeer{
+				ID:                 peer.ID,
+				Interface:          iface.Name,
+				PublicKey:          *peer.WireguardPublicKey,
+				ExpectedAllowedIPs: expected,
+				ActualAllowedIPs:   actual,
+				peer:               peer,
+				iface:              iface,
+			})
+		}
+	}
+
+	for key, wgPeer := range wireguardPeers {
+		if _, ok := known[key]; ok {
+			continue
+		}
+		report.Unknown = append(report.Unknown, DriftPeer{
+			Interface:        iface.Name,
+			PublicKey:        key,
+			ActualAllowedIPs: allowedIPsStrings(wgPeer.AllowedIPs),
+			iface:            iface,
+		})
+	}
+
+	return nil
+}
+
+// reconcile brings the wireguard interface in line with the storage
+func (manager *Manager) reconcile() {
+	report, err := manager.drift()
+	if err != nil {
+		zap.L().Error("failed to check wireguard peers drift", zap.Error(err))
+		return
+	}
+
+	driftPeers.WithLabelValues(driftMissing).Set(float64(len(report.Missing)))
+	driftPeers.WithLabelValues(driftUnknown).Set(float64(len(report.Unknown)))
+	driftPeers.WithLabelValues(driftMismatched).Set(float64(len(report.Mismatched)))
+
+	if report.Empty() {
+		return
+	}
+
+	zap.L().Warn("wireguard peers drift detected",
+		zap.Int(driftMissing, len(report.Missing)),
+		zap.Int(driftUnknown, len(report.Unknown)),
+		zap.Int(driftMismatched, len(report.Mismatched)))
+
+	for _, d := range report.Missing {
+		if err := d.iface.Wireguard.SetPeer(d.peer); err != nil {
+			zap.L().Error("failed to restore missing peer", zap.Int64("id", d.ID), zap.Error(err))
+			continue
+		}
+		driftFixed.WithLabelValues(driftMissing).Inc()
+	}
+
+	for _, d := range report.Unknown {
+		if err := d.iface.Wireguard.UnsetPeerKey(d.PublicKey); err != nil {
+			zap.L().Error("failed to remove unknown peer", zap.String("pub_key", d.PublicKey), zap.Error(err))
+			continue
+		}
+		driftFixed.WithLabelValues(driftUnknown).Inc()
+	}
+
+	for _, d := range report.Mismatched {
+		if err := d.iface.Wireguard.SetPeer(d.peer); err != nil {
+			zap.L().Error("failed to fix peer allowed ips", zap.Int64("id", d.ID), zap.Error(err))
+			continue
+		}
+		driftFixed.WithLabelValues(driftMismatched).Inc()
+	}
+}
+
+func allowedIPsStrings(ipnets []net.IPNet) []string {
+	out := make([]string, len(ipnets))
+	for i, ipnet := range ipnets {
+		out[i] = ipnet.String()
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xnet"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"github.com/vpnhouse/tunnel/internal/wireguard"
+)
+
+func TestAllowedIPsDrift(t *testing.T) {
+	ipv4 := xnet.ParseIP("10.235.0.2")
+	ipv6 := xnet.ParseIP("fd00:235::2")
+	subnets := "192.168.10.0/24"
+	peer := &types.PeerInfo{Ipv4: &ipv4, Ipv6: &ipv6, RoutedSubnets: &subnets}
+	expected := allowedIPsStrings(wireguard.PeerAllowedIPs(peer))
+
+	parse := func(cidrs ...string) []net.IPNet {
+		out := make([]net.IPNet, len(cidrs))
+		for i, cidr := range cidrs {
+			_, ipnet, err := net.ParseCIDR(cidr)
+			require.NoError(t, err)
+			out[i] = *ipnet
+		}
+		return out
+	}
+
+	cases := []struct {
+		name       string
+		actual     []net.IPNet
+		mismatched bool
+	}{
+		{
+			name:   "same order",
+			actual: parse("10.235.0.2/32", "fd00:235::2/128", "192.168.10.0/24"),
+		},
+		{
+			name:   "reordered by the interface",
+			actual: parse("192.168.10.0/24", "fd00:235::2/128", "10.235.0.2/32"),
+		},
+		{
+			name:       "missing ipv6",
+			actual:     parse("10.235.0.2/32", "192.168.10.0/24"),
+			mismatched: true,
+		},
+		{
+			name:       "stale subnet",
+			actual:     parse("10.235.0.2/32", "fd00:235::2/128", "192.168.20.0/24"),
+			mismatched: true,
+		},
+		{
+			name:       "nothing allowed",
+			actual:     nil,
+			mismatched: true,
+		},
+	}
+
+	for _, cc := range cases {
+		actual := allowedIPsStrings(cc.actual)
+		require.Equal(t, cc.mismatched, !slices.Equal(expected, actual), cc.name)
+	}
+}
+
+func TestDriftReportEmpty(t *testing.T) {
+	cases := []struct {
+		report DriftReport
+		empty  bool
+	}{
+		{DriftReport{}, true},
+		{DriftReport{Missing: []DriftPeer{}, Unknown: []DriftPeer{}, Mismatched: []DriftPeer{}}, true},
+		{DriftReport{Missing: []DriftPeer{{ID: 1}}}, false},
+		{DriftReport{Unknown: []DriftPeer{{PublicKey: "key"}}}, false},
+		{DriftReport{Mismatched: []DriftPeer{{ID: 2}}}, false},
+	}
+
+	for _, cc := range cases {
+		require.Equal(t, cc.empty, cc.report.Empty(), "report: %+v", cc.report)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vpnhouse/common-lib-go/ippool"
+	"github.com/vpnhouse/tunnel/internal/stats"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+const (
+	restoreFailedAddress   = "address"
+	restoreFailedStorage   = "storage"
+	restoreFailedWireguard = "wireguard"
+)
+
+var (
+	restoreDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: stats.Namespace,
+		Name:      "peers_restore_duration_seconds",
+		Help:      "time taken to restore the stored peers on startup",
+	})
+
+	restoreFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: stats.Namespace,
+		Name:      "peers_restore_failed",
+		Help:      "number of peers failed to restore on startup",
+	}, []string{"stage"})
+)
+
+func init() {
+	prometheus.MustRegister(restoreDuration)
+	prometheus.MustRegister(restoreFailed)
+}
+
+// restore peers on startup
+func (manager *Manager) restorePeers() {
+	started := time.Now()
+	peers, err := manager.storage.SearchPeers(nil)
+	if err != nil {
+		// err has already been logged inside
+		return
+	}
+
+	// Peers are set on the interfaces in bulk once the addresses are reserved
+	restored := make(map[*Interface][]*types.PeerInfo, len(manager.interfaces))
+	for _, peer := range peers {
+		if peer.Expired() {
+			zap.L().Debug("wiping expired peer", zap.Any("peer", peer))
+			if err := manager.storage.DeletePeer(peer.ID); err == nil {
+				manager.closeLeases(peer)
+			}
+			continue
+		}
+
+		// the leases are renewed if the peer gets new addresses
+		original := *peer
+		changed := false
+		iface, err := manager.peerInterface(peer)
+		if err != nil {
+			// The interface has been removed from the configuration,
+			// move the peer to the primary one.
+			zap.L().Warn("moving peer to the primary interface", zap.Int64("id", peer.ID), zap.Error(err))
+			peer.WireguardInterface = nil
+			iface = manager.primary()
+			changed = true
+		}
+
+		if err := iface.IP4am.Set(*peer.Ipv4, peer.GetNetworkPolicy()); err != nil {
+			if !errors.Is(err, ippool.ErrNotInRange) {
+				zap.L().Error("can't reserve the address of the restored peer", zap.Int64("id", peer.ID), zap.Error(err))
+				restoreFailed.WithLabelValues(restoreFailedAddress).Inc()
+				continue
+			}
+
+			newIP, err := iface.IP4am.Alloc(peer.GetNetworkPolicy())
+			if err != nil {
+				// TODO(nikonov): remove peer OR mark it as invalid
+				//  to allow further migration by hand.
+				zap.L().Error("can't allocate ipv4 address for the restored peer", zap.Int64("id", peer.ID), zap.Error(err))
+				restoreFailed.WithLabelValues(restoreFailedAddress).Inc()
+				continue
+			}
+			peer.Ipv4 = &newIP
+			changed = true
+		}
+
+		if manager.restorePeerIPv6(iface, peer) {
+			changed = true
+		}
+
+		if changed {
+			if _, err := manager.storage.UpdatePeer(peer); err != nil {
+				zap.L().Error("can't update the restored peer", zap.Int64("id", peer.ID), zap.Error(err))
+				restoreFailed.WithLabelValues(restoreFailedStorage).Inc()
+				_ = iface.IP4am.Unset(*peer.Ipv4)
+				if iface.IP6am != nil && peer.Ipv6 != nil {
+					_ = iface.IP6am.Unset(*peer.Ipv6)
+				}
+				continue
+			}
+			manager.renewLeases(&original, peer)
+		}
+		manager.index.put(peer)
+
+		if peer.QuotaExceeded() {
+			// Suspended until the quota reset, see syncPeerStats
+			continue
+		}
+
+		if peer.Pending() {
+			// The shared peer gets to the interface on the activation
+			continue
+		}
+
+		restored[iface] = append(restored[iface], peer)
+	}
+
+	var total, failed int
+	for iface, peers := range restored {
+		errs := iface.Wireguard.ReplacePeers(peers)
+		for id, err := range errs {
+			zap.L().Error("can't set the restored peer", zap.Int64("id", id), zap.Error(err))
+		}
+		restoreFailed.WithLabelValues(restoreFailedWireguard).Add(float64(len(errs)))
+
+		var subnets []net.IPNet
+		for _, peer := range peers {
+			subnets = append(subnets, peer.Subnets()...)
+		}
+		if err := iface.Wireguard.SetRoutes(subnets); err != nil {
+			zap.L().Error("can't route the subnets of the restored peers", zap.String("iface", iface.Name), zap.Error(err))
+		}
+
+		total += len(peers)
+		failed += len(errs)
+	}
+
+	elapsed := time.Since(started)
+	restoreDuration.Set(elapsed.Seconds())
+	zap.L().Info("peers restored", zap.Int("peers", total), zap.Int("failed", failed), zap.Duration("elapsed", elapsed))
+}
+
+// restorePeerIPv6 reserves the stored IPv6 address of the peer,
+// or assigns a new one if the address is missing or the subnet has been changed.
+// Returns true if the peer's address has been changed.
+func (manager *Manager) restorePeerIPv6(iface *Interface, peer *types.PeerInfo) bool {
+	if iface.IP6am == nil {
+		if peer.Ipv6 == nil {
+			return false
+		}
+		// IPv6 addressing has been disabled
+		peer.Ipv6 = nil
+		return true
+	}
+
+	if peer.Ipv6 != nil && iface.IP6am.Contains(*peer.Ipv6) {
+		if err := iface.IP6am.Set(*peer.Ipv6); err == nil {
+			return false
+		}
+	}
+
+	ipv6, err := iface.IP6am.Alloc()
+	if err != nil {
+		zap.L().Error("can't allocate ipv6 address for the restored peer", zap.Int64("id", peer.ID), zap.Error(err))
+		changed := peer.Ipv6 != nil
+		peer.Ipv6 = nil
+		return changed
+	}
+
+	peer.Ipv6 = &ipv6
+	return true
+}
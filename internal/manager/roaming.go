@@ -0,0 +1,74 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"time"
+
+	"github.com/vpnhouse/tunnel/internal/eventlog"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// recordEndpoint appends the new endpoint of the peer to the endpoint history
+// and reports the roaming if the peer has been connected from another endpoint before.
+func (manager *Manager) recordEndpoint(peer *types.PeerInfo, previous *string, country string) {
+	last, err := manager.storage.LastPeerEndpoint(peer.ID)
+	if err != nil {
+		zap.L().Error("failed to get the last peer endpoint", zap.Int64("id", peer.ID), zap.Error(err))
+	}
+
+	err = manager.storage.AddPeerEndpoint(&types.PeerEndpoint{
+		PeerId:   peer.ID,
+		UserId:   peer.UserId,
+		Endpoint: *peer.Endpoint,
+		Country:  country,
+	})
+	if err != nil {
+		zap.L().Error("failed to record peer endpoint", zap.Int64("id", peer.ID), zap.Error(err))
+	}
+
+	if previous == nil {
+		// the first connection, not a roaming
+		return
+	}
+
+	var previousCountry string
+	if last != nil && last.Endpoint == *previous {
+		previousCountry = last.Country
+	}
+
+	zap.L().Debug("peer roamed",
+		zap.Int64("id", peer.ID),
+		zap.String("from", *previous),
+		zap.String("to", *peer.Endpoint),
+		zap.String("from_country", previousCountry),
+		zap.String("to_country", country))
+
+	payload := manager.peerEvent(peer)
+	// the runtime stats are not updated yet, so set the country explicitly
+	payload.Country = country
+	payload.PreviousEndpoint = *previous
+	payload.PreviousCountry = previousCountry
+	manager.pushPeerEvent(eventlog.PeerRoam, peer.ID, payload)
+}
+
+// purgeEndpointHistory removes the endpoint history out of the retention period,
+// it's kept as long as the IP leases history.
+func (manager *Manager) purgeEndpointHistory() {
+	retention := manager.runtime.Settings.GetIPLeasesRetention()
+	if retention <= 0 {
+		return
+	}
+
+	n, err := manager.storage.PurgePeerEndpoints(time.Now().Add(-retention))
+	if err != nil {
+		zap.L().Error("failed to purge peer endpoint history", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		zap.L().Debug("peer endpoint history purged", zap.Int64("endpoints", n))
+	}
+}
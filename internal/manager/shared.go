@@ -0,0 +1,82 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// ActivateSharedPeer sets the key of the device activating the peer via the shared link,
+// the peer replaces the previously activated device, if any.
+func (manager *Manager) ActivateSharedPeer(sharingKey string, publicKey string) (*types.PeerInfo, error) {
+	if !manager.running.Load().(bool) {
+		return nil, xerror.EUnavailable("server is shutting down", nil)
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	peer, ok := manager.index.getShared(sharingKey)
+	if !ok {
+		return nil, xerror.EEntryNotFound("no peer with a given sharing key where found", nil)
+	}
+
+	if err := peer.Activate(publicKey, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := manager.updatePeer(peer); err != nil {
+		return nil, err
+	}
+
+	zap.L().Info("shared peer activated", zap.Int64("id", peer.ID), zap.Intp("activations", peer.SharingActivations))
+	if activated, ok := manager.index.get(peer.ID); ok {
+		return activated, nil
+	}
+	return peer, nil
+}
+
+// ListSharedPeers returns the peers created by the shared links, both pending and activated
+func (manager *Manager) ListSharedPeers() ([]*types.PeerInfo, error) {
+	if !manager.running.Load().(bool) {
+		return nil, xerror.EUnavailable("server is shutting down", nil)
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	shared := make([]*types.PeerInfo, 0)
+	for _, peer := range manager.peers() {
+		if peer.Shared() {
+			p := *peer
+			shared = append(shared, &p)
+		}
+	}
+	return shared, nil
+}
+
+// RevokeSharedPeer revokes the shared link of the peer: the pending peer is removed
+// releasing its addresses, the activated one stays but can't be activated anymore.
+func (manager *Manager) RevokeSharedPeer(id int64) error {
+	if !manager.running.Load().(bool) {
+		return xerror.EUnavailable("server is shutting down", nil)
+	}
+	manager.lock.Lock()
+	defer manager.lock.Unlock()
+
+	peer, ok := manager.index.get(id)
+	if !ok || !peer.Shared() {
+		return xerror.EEntryNotFound("shared peer not found", nil, zap.Int64("id", id))
+	}
+
+	if peer.Pending() {
+		return manager.unsetPeer(peer)
+	}
+
+	revoked := ""
+	peer.SharingKey = &revoked
+	return manager.updatePeer(peer)
+}
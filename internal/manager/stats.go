@@ -1,12 +1,15 @@
 package manager
 
 import (
+	"net"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/vpnhouse/common-lib-go/xstats"
 	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/eventlog"
+	"github.com/vpnhouse/tunnel/internal/stats"
 	"github.com/vpnhouse/tunnel/internal/types"
 	"go.uber.org/zap"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -22,33 +25,69 @@ type PeerStats struct {
 	Country         string // user country
 
 	updated       time.Time
+	handshake     bool
 	wgReceived    int64
 	wgTransmitted int64
 }
 
-func (manager *Manager) syncPeerStats() {
-	wireguardPeers, err := manager.wireguard.GetPeers()
-	if err != nil {
-		return
-	}
+// statsSync is the result of the stats sync to be stored and reported out of the manager lock
+type statsSync struct {
+	now   time.Time
+	stats wgStats
+	peers []syncedPeer
+}
 
-	peers, err := manager.peers()
+// syncedPeer is the snapshot of the peer taken by the stats sync
+type syncedPeer struct {
+	peer      types.PeerInfo
+	update    types.PeerStatsUpdate
+	endpoint  *net.UDPAddr
+	previous  *string // the endpoint the peer has roamed from
+	roamed    bool
+	connected bool // the peer has made its first handshake
+}
+
+// syncPeerStats updates the runtime state of the indexed peers, suspends and removes them if needed.
+// It must be called under the manager lock, the returned result is flushed by flushPeerStats.
+func (manager *Manager) syncPeerStats() *statsSync {
+	wireguardPeers, err := manager.getPeers()
 	if err != nil {
-		return
+		return nil
 	}
 
+	peers := manager.peers()
 	oldStats := manager.wgStats.Load()
 	if oldStats == nil {
 		oldStats = &wgStats{}
 	}
 	newStats := make(wgStats)
 	expiredPeers := make([]*types.PeerInfo, 0)
+	suspendedPeers := make([]*types.PeerInfo, 0)
+	activePeers := make([]*types.PeerInfo, 0, len(peers))
+	userUsage := make(map[string]int64)
 	now := time.Now()
+	idleExpiry := manager.runtime.Settings.GetPeerIdleExpiry()
 	numPeersWithHadshakes := 0
+	synced := make([]syncedPeer, 0, len(peers))
 	for _, peer := range peers {
-		// Peer is expired - add it to the output list for later processing
+		if peer.Pending() {
+			// The shared peer holds its addresses until the link expires
+			if peer.SharingExpired(now) {
+				zap.L().Debug("shared peer link expired", zap.Int64("id", peer.ID))
+				expiredPeers = append(expiredPeers, peer)
+			}
+			continue
+		}
+
+		// Peer is expired - add it to the output list for later processing,
+		// the suspended peers can't make handshakes, so they are never idle.
 		if peer.Expires != nil && peer.Expires.Time.Before(now) {
 			expiredPeers = append(expiredPeers, peer)
+		} else if idleExpiry > 0 && peer.Idle(now, idleExpiry, lastHandshake(wireguardPeers, peer)) && !peer.QuotaExceeded() && !manager.userSuspended(peer) {
+			zap.L().Debug("peer expired due to inactivity", zap.Int64("id", peer.ID), zap.Any("handshake", peer.Handshake))
+			expiredPeers = append(expiredPeers, peer)
+		} else {
+			activePeers = append(activePeers, peer)
 		}
 
 		if peer.Activity != nil {
@@ -66,7 +105,27 @@ func (manager *Manager) syncPeerStats() {
 			continue
 		}
 
+		if manager.resetPeerQuota(peer, now) {
+			// The peer gets its stats on the next sync
+			if !manager.userSuspended(peer) {
+				manager.resumePeer(peer)
+			}
+			continue
+		}
+
 		wgPeer, ok := wireguardPeers[*peer.WireguardPublicKey]
+		if !ok && manager.userSuspended(peer) {
+			// Resumed by syncUserQuotas when the user quota is reset
+			continue
+		}
+		if peer.QuotaExceeded() {
+			// The peer is suspended, make sure it is not on the interface
+			if ok {
+				suspendedPeers = append(suspendedPeers, peer)
+			}
+			continue
+		}
+
 		if !ok {
 			zap.L().Error(
 				"peer is presented in the manager's storage but not configured on the interface",
@@ -79,11 +138,36 @@ func (manager *Manager) syncPeerStats() {
 		}
 
 		oldPeerStats := (*oldStats)[*peer.WireguardPublicKey]
-		newPeerStats := manager.handlePeerStats(oldPeerStats, peer, wgPeer, now)
+		firstConnect := peer.Activity == nil && !oldPeerStats.handshake && !wgPeer.LastHandshakeTime.IsZero()
+		previous := peer.Endpoint
+		update := types.PeerStatsUpdate{}
+		newPeerStats := manager.handlePeerStats(oldPeerStats, peer, wgPeer, now, &update)
 		newStats[*peer.WireguardPublicKey] = newPeerStats
+		synced = append(synced, syncedPeer{
+			peer:      *peer,
+			update:    update,
+			endpoint:  wgPeer.Endpoint,
+			previous:  previous,
+			roamed:    update.Handshake && peer.Endpoint != nil && !equalPtr(previous, peer.Endpoint),
+			connected: firstConnect,
+		})
+
+		if peer.UserId != nil {
+			userUsage[*peer.UserId] += newPeerStats.Upstream + newPeerStats.Downstream
+		}
+
+		if peer.QuotaExceeded() {
+			suspendedPeers = append(suspendedPeers, peer)
+		}
+	}
+
+	// Suspend peers used up their quota
+	for _, peer := range suspendedPeers {
+		manager.suspendPeer(peer)
 	}
 
-	manager.wgStats.Store(&newStats)
+	// Suspend peers of users used up their quota
+	manager.syncUserQuotas(activePeers, wireguardPeers, userUsage, now)
 
 	// Delete expired peers
 	for _, peer := range expiredPeers {
@@ -92,14 +176,114 @@ func (manager *Manager) syncPeerStats() {
 			zap.L().Error("failed to unset expired peer", zap.Error(err))
 		}
 	}
+
+	manager.countPeers(now)
+
+	return &statsSync{now: now, stats: newStats, peers: synced}
+}
+
+// flushPeerStats stores and reports the result of the stats sync,
+// it's called out of the manager lock, so the storage and the geoip lookups do not block the peer management.
+func (manager *Manager) flushPeerStats(sync *statsSync) {
+	updates := make([]types.PeerStatsUpdate, 0, len(sync.peers))
+	for i := range sync.peers {
+		synced := &sync.peers[i]
+		key := *synced.peer.WireguardPublicKey
+		peerStats := sync.stats[key]
+		peerStats.Country = manager.peerCountry(&synced.peer, synced.endpoint)
+		sync.stats[key] = peerStats
+
+		if synced.update.HasTraffic() {
+			manager.reportPeerStats(&synced.peer, &synced.update, peerStats.Country)
+		}
+		if synced.update.HasTraffic() || synced.update.Handshake {
+			synced.update.Peer = &synced.peer
+			updates = append(updates, synced.update)
+		}
+	}
+
+	manager.wgStats.Store(&sync.stats)
+	if err := manager.storage.UpdatePeerStats(sync.now, updates); err != nil {
+		zap.L().Error("failed to store peer stats", zap.Int("peers", len(updates)), zap.Error(err))
+	}
+
+	for i := range sync.peers {
+		synced := &sync.peers[i]
+		if synced.roamed {
+			manager.recordEndpoint(&synced.peer, synced.previous, sync.stats[*synced.peer.WireguardPublicKey].Country)
+		}
+		// Notify about peers made their first handshake
+		if synced.connected {
+			manager.pushEvent(eventlog.PeerFirstConnect, &synced.peer)
+		}
+	}
+}
+
+// reportPeerStats sends the traffic of the peer since the previous sync to the stats service
+func (manager *Manager) reportPeerStats(peer *types.PeerInfo, update *types.PeerStatsUpdate, country string) {
+	getOrZero := func(v *uuid.UUID) uuid.UUID {
+		if v == nil {
+			return uuid.UUID{}
+		} else {
+			return *v
+		}
+	}
+
+	manager.statsReporter.ReportStats(getOrZero(peer.SessionId), uint64(update.Downstream), uint64(update.Upstream), func(_ uuid.UUID, out *xstats.SessionData) {
+		out.Country = country
+		if peer.InstallationId != nil {
+			out.InstallationID = getOrZero(peer.InstallationId).String()
+		}
+		if peer.UserId != nil {
+			out.UserID = *peer.UserId
+		}
+	})
+}
+
+// countPeers updates the peer counters reported to the stats service
+func (manager *Manager) countPeers(now time.Time) {
+	peers := manager.peers()
+	var active int
+	for _, peer := range peers {
+		if peer.Activity != nil && now.Sub(peer.Activity.Time) < time.Minute {
+			active += 1
+		}
+	}
+
+	manager.extraStats.Store(&stats.ExtraStats{
+		PeersTotal:  len(peers),
+		PeersActive: active,
+	})
+}
+
+// seedPeerStats takes the traffic counters of the adopted interface as a baseline,
+// otherwise the traffic already accounted by the previous run is counted twice.
+func (manager *Manager) seedPeerStats() {
+	wireguardPeers, err := manager.getPeers()
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	seed := make(wgStats, len(wireguardPeers))
+	for key, wgPeer := range wireguardPeers {
+		seed[key] = PeerStats{
+			updated:       now,
+			handshake:     !wgPeer.LastHandshakeTime.IsZero(),
+			wgReceived:    wgPeer.ReceiveBytes,
+			wgTransmitted: wgPeer.TransmitBytes,
+		}
+	}
+
+	manager.wgStats.Store(&seed)
 }
 
-func (manager *Manager) peerCountry(peer *types.PeerInfo, wgPeer *wgtypes.Peer) string {
-	if manager.geoipService == nil || wgPeer.Endpoint == nil {
+func (manager *Manager) peerCountry(peer *types.PeerInfo, endpoint *net.UDPAddr) string {
+	if manager.geoipService == nil || endpoint == nil {
 		return ""
 	}
 
-	country, err := manager.geoipService.GetCountry(wgPeer.Endpoint.IP)
+	country, err := manager.geoipService.GetCountry(endpoint.IP)
 	if err != nil {
 		zap.L().Error("failed to detect country", zap.Stringp("peer", peer.Label))
 	}
@@ -108,10 +292,47 @@ func (manager *Manager) peerCountry(peer *types.PeerInfo, wgPeer *wgtypes.Peer)
 	return country
 }
 
-func (manager *Manager) handlePeerStats(oldPeerStats PeerStats, peer *types.PeerInfo, wgPeer *wgtypes.Peer, now time.Time) (peerStats PeerStats) {
+// lastHandshake returns the last handshake of the peer reported by the interface,
+// it is newer than the stored one until the peer stats are handled.
+func lastHandshake(wireguardPeers map[string]*wgtypes.Peer, peer *types.PeerInfo) time.Time {
+	if peer.WireguardPublicKey == nil {
+		return time.Time{}
+	}
+	wgPeer, ok := wireguardPeers[*peer.WireguardPublicKey]
+	if !ok {
+		return time.Time{}
+	}
+	return wgPeer.LastHandshakeTime
+}
+
+// updatePeerHandshake records the last handshake and the endpoint of the peer if they have changed,
+// the peer is stored along with the rest of the stats update.
+func (manager *Manager) updatePeerHandshake(peer *types.PeerInfo, wgPeer *wgtypes.Peer, update *types.PeerStatsUpdate) {
+	if wgPeer.LastHandshakeTime.IsZero() {
+		return
+	}
+
+	var endpoint *string
+	if wgPeer.Endpoint != nil {
+		s := wgPeer.Endpoint.String()
+		endpoint = &s
+	}
+
+	// the storage keeps the seconds only
+	handshake := wgPeer.LastHandshakeTime.Truncate(time.Second)
+	if peer.Handshake != nil && peer.Handshake.Unix() == handshake.Unix() && equalPtr(peer.Endpoint, endpoint) {
+		return
+	}
+
+	peer.Handshake = &xtime.Time{Time: handshake}
+	peer.Endpoint = endpoint
+	update.Handshake = true
+}
+
+func (manager *Manager) handlePeerStats(oldPeerStats PeerStats, peer *types.PeerInfo, wgPeer *wgtypes.Peer, now time.Time, update *types.PeerStatsUpdate) (peerStats PeerStats) {
 	peerStats = PeerStats{
-		updated: now,
-		Country: manager.peerCountry(peer, wgPeer),
+		updated:   now,
+		handshake: oldPeerStats.handshake || !wgPeer.LastHandshakeTime.IsZero(),
 	}
 
 	dRx := wgPeer.ReceiveBytes - oldPeerStats.wgReceived
@@ -132,42 +353,36 @@ func (manager *Manager) handlePeerStats(oldPeerStats PeerStats, peer *types.Peer
 		}
 	}
 
+	manager.updatePeerHandshake(peer, wgPeer, update)
+
 	if dRx == 0 && dTx == 0 {
 		return
 	}
 
-	getOrZero := func(v *uuid.UUID) uuid.UUID {
-		if v == nil {
-			return uuid.UUID{}
-		} else {
-			return *v
-		}
+	// The counters are replaced, not changed in place:
+	// the copies of the peer taken by the stats sync share them.
+	upstream := dRx
+	if peer.Upstream != nil {
+		upstream += *peer.Upstream
 	}
+	peer.Upstream = &upstream
 
-	manager.statsReporter.ReportStats(getOrZero(peer.SessionId), uint64(dTx), uint64(dRx), func(_ uuid.UUID, out *xstats.SessionData) {
-		out.Country = peerStats.Country
-		if peer.InstallationId != nil {
-			out.InstallationID = getOrZero(peer.InstallationId).String()
-		}
-		if peer.UserId != nil {
-			out.UserID = *peer.UserId
-		}
-	})
-
-	if peer.Upstream == nil {
-		peer.Upstream = &dRx
-	} else {
-		*peer.Upstream += dRx
+	quotaUsed := dRx + dTx
+	if peer.QuotaUsed != nil {
+		quotaUsed += *peer.QuotaUsed
 	}
+	peer.QuotaUsed = &quotaUsed
 
-	if peer.Downstream == nil {
-		peer.Downstream = &dTx
-	} else {
-		*peer.Downstream += dTx
+	downstream := dTx
+	if peer.Downstream != nil {
+		downstream += *peer.Downstream
 	}
+	peer.Downstream = &downstream
 
 	peer.Activity = xtime.FromTimePtr(&now)
-	manager.storage.UpdatePeerStats(now, peer)
+	peer.Updated = xtime.FromTimePtr(&now)
+	update.Upstream = dRx
+	update.Downstream = dTx
 
 	return
 }
@@ -0,0 +1,85 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xnet"
+	"github.com/vpnhouse/tunnel/internal/storage"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+// The peer updated between the stats sync and the flush must keep the synced stats
+func TestPeerUpdateBetweenStatsSyncAndFlush(t *testing.T) {
+	db, err := storage.New(filepath.Join(t.TempDir(), "db.sqlite3"), bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Shutdown() })
+
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	publicKey := key.PublicKey().String()
+	ipv4 := xnet.ParseIP("10.235.0.2")
+	label := "laptop"
+	id, err := db.CreatePeer(types.PeerInfo{
+		Label:         &label,
+		Ipv4:          &ipv4,
+		WireguardInfo: types.WireguardInfo{WireguardPublicKey: &publicKey},
+	})
+	require.NoError(t, err)
+
+	manager := &Manager{storage: db, index: newPeerIndex()}
+	manager.indexPeer(id)
+
+	// sync: the indexed peer gets the traffic, the snapshot is flushed later
+	now := time.Now()
+	wgPeer := &wgtypes.Peer{
+		Endpoint:          &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820},
+		LastHandshakeTime: now,
+		ReceiveBytes:      100,
+		TransmitBytes:     20,
+	}
+	update := types.PeerStatsUpdate{}
+	manager.handlePeerStats(PeerStats{}, manager.peers()[0], wgPeer, now, &update)
+	synced := *manager.peers()[0]
+	update.Peer = &synced
+
+	// update: the storage lags behind the index until the flush
+	changed, ok := manager.index.get(id)
+	require.True(t, ok)
+	newLabel := "phone"
+	changed.Label = &newLabel
+	_, err = db.UpdatePeer(changed)
+	require.NoError(t, err)
+	manager.indexPeer(id)
+
+	// flush
+	require.NoError(t, db.UpdatePeerStats(now, []types.PeerStatsUpdate{update}))
+
+	stored, err := db.GetPeer(id)
+	require.NoError(t, err)
+	indexed, ok := manager.index.get(id)
+	require.True(t, ok)
+	for _, peer := range []*types.PeerInfo{stored, indexed} {
+		require.Equal(t, newLabel, *peer.Label)
+		require.EqualValues(t, 100, *peer.Upstream)
+		require.EqualValues(t, 20, *peer.Downstream)
+		require.EqualValues(t, 120, *peer.QuotaUsed)
+		require.Equal(t, now.Unix(), peer.Handshake.Unix())
+		require.Equal(t, "192.0.2.1:51820", *peer.Endpoint)
+	}
+
+	// the next sync counts on top of the synced stats
+	wgPeer.ReceiveBytes += 50
+	oldStats := PeerStats{updated: now, handshake: true, wgReceived: 100, wgTransmitted: 20}
+	manager.handlePeerStats(oldStats, manager.peers()[0], wgPeer, now.Add(time.Second), &types.PeerStatsUpdate{})
+	require.EqualValues(t, 150, *manager.peers()[0].Upstream)
+}
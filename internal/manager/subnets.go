@@ -0,0 +1,67 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+// checkRoutedSubnets rejects the subnets routed through the peer if they overlap
+// the peer address pools or the subnets routed through other peers.
+func (manager *Manager) checkRoutedSubnets(peer *types.PeerInfo) error {
+	subnets := peer.Subnets()
+	if len(subnets) == 0 {
+		return nil
+	}
+
+	for _, subnet := range subnets {
+		for _, iface := range manager.interfaces {
+			for _, pool := range iface.Subnets {
+				if types.Overlaps(subnet, pool) {
+					msg := fmt.Sprintf("routed subnet %s overlaps the peer addresses of %s", subnet.String(), iface.Name)
+					return xerror.EInvalidField(msg, "routed_subnets", nil)
+				}
+			}
+		}
+	}
+
+	for _, other := range manager.peers() {
+		if other.ID == peer.ID || other.RoutedSubnets == nil {
+			continue
+		}
+		for _, otherSubnet := range other.Subnets() {
+			for _, subnet := range subnets {
+				if types.Overlaps(subnet, otherSubnet) {
+					msg := fmt.Sprintf("routed subnet %s overlaps %s routed through peer %d", subnet.String(), otherSubnet.String(), other.ID)
+					return xerror.EInvalidField(msg, "routed_subnets", nil)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// staleSubnets returns the old subnets which are not in the new ones
+func staleSubnets(old []net.IPNet, new []net.IPNet) []net.IPNet {
+	var stale []net.IPNet
+	for _, subnet := range old {
+		found := false
+		for _, s := range new {
+			if s.String() == subnet.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			stale = append(stale, subnet)
+		}
+	}
+	return stale
+}
@@ -0,0 +1,38 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestStaleSubnets(t *testing.T) {
+	cases := []struct {
+		old, new string
+		stale    []string
+	}{
+		{old: "", new: "192.168.10.0/24", stale: nil},
+		{old: "192.168.10.0/24", new: "192.168.10.0/24", stale: nil},
+		{old: "192.168.10.0/24, 10.10.0.0/16", new: "10.10.0.0/16", stale: []string{"192.168.10.0/24"}},
+		{old: "192.168.10.0/24", new: "192.168.0.0/16", stale: []string{"192.168.10.0/24"}},
+		{old: "192.168.10.0/24, fd00:10::/64", new: "", stale: []string{"192.168.10.0/24", "fd00:10::/64"}},
+	}
+
+	for _, cc := range cases {
+		old, err := types.ParseSubnets(cc.old)
+		require.NoError(t, err)
+		new, err := types.ParseSubnets(cc.new)
+		require.NoError(t, err)
+
+		var stale []string
+		for _, subnet := range staleSubnets(old, new) {
+			stale = append(stale, subnet.String())
+		}
+		require.Equal(t, cc.stale, stale, "%q -> %q", cc.old, cc.new)
+	}
+}
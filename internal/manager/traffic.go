@@ -0,0 +1,26 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package manager
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// purgeTrafficHistory removes the traffic history buckets out of the retention period
+func (manager *Manager) purgeTrafficHistory() {
+	now := time.Now()
+	for resolution, keep := range manager.runtime.Settings.GetTrafficHistoryRetention() {
+		n, err := manager.storage.PurgePeerTraffic(resolution, now.Add(-keep))
+		if err != nil {
+			zap.L().Error("failed to purge peer traffic history", zap.Error(err))
+			continue
+		}
+		if n > 0 {
+			zap.L().Debug("peer traffic history purged", zap.Duration("resolution", time.Duration(resolution)), zap.Int64("buckets", n))
+		}
+	}
+}
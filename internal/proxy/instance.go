@@ -19,6 +19,7 @@ import (
 	"github.com/vpnhouse/common-lib-go/xstats"
 	"github.com/vpnhouse/tunnel/internal/authorizer"
 	"github.com/vpnhouse/tunnel/internal/stats"
+	"go.uber.org/zap"
 )
 
 const ProtoName = "proxy"
@@ -41,6 +42,7 @@ type Instance struct {
 	statsService   *xstats.Service
 	geoipResolver  *geoip.Resolver
 	sessionCounter *keycounter.KeyCounter[string]
+	connections    *connTracker
 }
 
 type query struct {
@@ -48,6 +50,7 @@ type query struct {
 	installationID uuid.UUID
 	userID         string
 	country        string
+	conn           *trackedConn
 
 	releaser   func()
 	reporterTx func()
@@ -118,6 +121,7 @@ func New(
 		statsService:   statsReporter,
 		geoipResolver:  geoipResolver,
 		sessionCounter: sessionCounter,
+		connections:    newConnTracker(),
 	}
 
 	instance.fetcher = xproxy.Instance{
@@ -164,6 +168,8 @@ func (instance *Instance) ProxyHandler(next http.Handler) http.Handler {
 		if (instance.isMyRequest(r) || instance.cycledProxy(r)) && (r.Method != http.MethodConnect) {
 			next.ServeHTTP(w, r)
 		} else {
+			w, r, conn := withTrackedConn(w, r)
+			defer conn.cancel()
 			instance.fetcher.ServeHTTP(w, r)
 		}
 	})
@@ -187,13 +193,20 @@ func (instance *Instance) doAuth(r *http.Request) (*query, error) {
 	}
 
 	userID := token.Subject
+	sessionID := uuid.MustParse(token.Id)
 	instance.sessionCounter.Inc(userID)
 
+	conn := trackedConnFromContext(r.Context())
+	if conn != nil {
+		instance.connections.add(userID, sessionID, conn)
+	}
+
 	return &query{
-		sessionID:      uuid.MustParse(token.Id),
+		sessionID:      sessionID,
 		installationID: uuid.MustParse(token.InstallationId),
 		userID:         userID,
 		country:        clientInfo.Country,
+		conn:           conn,
 		releaser: func() {
 			instance.users.Release(token.Subject, user)
 		},
@@ -209,6 +222,9 @@ func (instance *Instance) doAuth(r *http.Request) (*query, error) {
 func (instance *Instance) doRelease(authInfo *query) {
 	authInfo.releaser()
 	instance.sessionCounter.Dec(authInfo.userID)
+	if authInfo.conn != nil {
+		instance.connections.remove(authInfo.userID, authInfo.sessionID, authInfo.conn)
+	}
 }
 
 func (q *query) onStatsSessionData(sessionID uuid.UUID, sessionData *xstats.SessionData) {
@@ -237,5 +253,11 @@ func (instance *Instance) doReportTx(description any, n uint64) {
 
 // admin.Handler implementation
 func (instance *Instance) KillActiveUserSessions(userId string) {
-	// TODO: add implementation
+	sessions, conns := instance.connections.kill(userId)
+	if conns == 0 {
+		return
+	}
+
+	zap.L().Info("proxy user sessions killed",
+		zap.String("user_id", userId), zap.Int("sessions", sessions), zap.Int("connections", conns))
 }
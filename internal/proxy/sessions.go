@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/vpnhouse/common-lib-go/xerror"
+)
+
+type contextKey struct{}
+
+// trackedConn represents a single proxied request
+// which can be terminated on demand.
+type trackedConn struct {
+	cancel context.CancelFunc
+
+	lock     sync.Mutex
+	hijacked net.Conn
+	closed   bool
+}
+
+func (c *trackedConn) attach(conn net.Conn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		// Termination requested before the connection was hijacked
+		_ = conn.Close()
+		return
+	}
+	c.hijacked = conn
+}
+
+func (c *trackedConn) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.closed = true
+	c.cancel()
+	if c.hijacked != nil {
+		_ = c.hijacked.Close()
+	}
+}
+
+// trackingWriter intercepts hijacking of the client connection (CONNECT requests)
+// to be able to close the hijacked stream.
+type trackingWriter struct {
+	http.ResponseWriter
+	conn *trackedConn
+}
+
+func (w *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, xerror.EInternalError("connection hijacking is not supported", nil)
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w.conn.attach(conn)
+	return conn, rw, nil
+}
+
+func (w *trackingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// withTrackedConn wraps the request and the response writer
+// to make the request terminable via the returned trackedConn.
+func withTrackedConn(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, *trackedConn) {
+	ctx, cancel := context.WithCancel(r.Context())
+	conn := &trackedConn{cancel: cancel}
+	ctx = context.WithValue(ctx, contextKey{}, conn)
+	return &trackingWriter{ResponseWriter: w, conn: conn}, r.WithContext(ctx), conn
+}
+
+func trackedConnFromContext(ctx context.Context) *trackedConn {
+	conn, _ := ctx.Value(contextKey{}).(*trackedConn)
+	return conn
+}
+
+// connTracker keeps active proxy connections per user and session
+type connTracker struct {
+	lock  sync.Mutex
+	users map[string]map[uuid.UUID]map[*trackedConn]struct{}
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{
+		users: make(map[string]map[uuid.UUID]map[*trackedConn]struct{}),
+	}
+}
+
+func (t *connTracker) add(userID string, sessionID uuid.UUID, conn *trackedConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	sessions, ok := t.users[userID]
+	if !ok {
+		sessions = make(map[uuid.UUID]map[*trackedConn]struct{})
+		t.users[userID] = sessions
+	}
+
+	conns, ok := sessions[sessionID]
+	if !ok {
+		conns = make(map[*trackedConn]struct{})
+		sessions[sessionID] = conns
+	}
+
+	conns[conn] = struct{}{}
+}
+
+func (t *connTracker) remove(userID string, sessionID uuid.UUID, conn *trackedConn) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	sessions, ok := t.users[userID]
+	if !ok {
+		return
+	}
+
+	conns, ok := sessions[sessionID]
+	if !ok {
+		return
+	}
+
+	delete(conns, conn)
+	if len(conns) == 0 {
+		delete(sessions, sessionID)
+	}
+	if len(sessions) == 0 {
+		delete(t.users, userID)
+	}
+}
+
+// kill closes all connections of the given user,
+// returns number of sessions and connections closed.
+func (t *connTracker) kill(userID string) (int, int) {
+	t.lock.Lock()
+	sessions := t.users[userID]
+	delete(t.users, userID)
+	t.lock.Unlock()
+
+	var numConns int
+	for _, conns := range sessions {
+		for conn := range conns {
+			conn.close()
+			numConns++
+		}
+	}
+
+	return len(sessions), numConns
+}
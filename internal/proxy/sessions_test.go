@@ -0,0 +1,216 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/auth"
+	"github.com/vpnhouse/common-lib-go/geoip"
+)
+
+func newTestConn() *trackedConn {
+	_, cancel := context.WithCancel(context.Background())
+	return &trackedConn{cancel: cancel}
+}
+
+func TestConnTrackerKill(t *testing.T) {
+	sessionA := uuid.New()
+	sessionB := uuid.New()
+
+	type conn struct {
+		user    string
+		session uuid.UUID
+	}
+	cases := []struct {
+		name     string
+		conns    []conn
+		kill     string
+		sessions int
+		closed   int
+	}{
+		{
+			name:  "unknown user",
+			conns: []conn{{"alice", sessionA}},
+			kill:  "bob",
+		},
+		{
+			name:     "single session",
+			conns:    []conn{{"alice", sessionA}, {"alice", sessionA}, {"bob", sessionB}},
+			kill:     "alice",
+			sessions: 1,
+			closed:   2,
+		},
+		{
+			name:     "multiple sessions",
+			conns:    []conn{{"alice", sessionA}, {"alice", sessionB}, {"bob", sessionB}},
+			kill:     "alice",
+			sessions: 2,
+			closed:   2,
+		},
+	}
+
+	for _, cc := range cases {
+		tracker := newConnTracker()
+		tracked := make([]*trackedConn, len(cc.conns))
+		for i, c := range cc.conns {
+			tracked[i] = newTestConn()
+			tracker.add(c.user, c.session, tracked[i])
+		}
+
+		sessions, closed := tracker.kill(cc.kill)
+		require.Equal(t, cc.sessions, sessions, cc.name)
+		require.Equal(t, cc.closed, closed, cc.name)
+		require.NotContains(t, tracker.users, cc.kill, cc.name)
+
+		for i, c := range cc.conns {
+			require.Equal(t, c.user == cc.kill, tracked[i].closed, cc.name)
+		}
+
+		sessions, closed = tracker.kill(cc.kill)
+		require.Zero(t, sessions, cc.name)
+		require.Zero(t, closed, cc.name)
+	}
+}
+
+func TestConnTrackerRemove(t *testing.T) {
+	session := uuid.New()
+	tracker := newConnTracker()
+	a := newTestConn()
+	b := newTestConn()
+
+	tracker.add("alice", session, a)
+	tracker.add("alice", session, b)
+
+	tracker.remove("alice", session, a)
+	require.Len(t, tracker.users["alice"][session], 1)
+
+	tracker.remove("alice", session, b)
+	require.NotContains(t, tracker.users, "alice", "empty users must be dropped")
+
+	// removing twice is a no-op
+	tracker.remove("alice", session, b)
+}
+
+func TestTrackedConnClose(t *testing.T) {
+	// hijacked before the termination
+	client, server := net.Pipe()
+	conn := newTestConn()
+	conn.attach(server)
+	conn.close()
+	_, err := client.Read(make([]byte, 1))
+	require.Error(t, err, "hijacked connection must be closed")
+
+	// hijacked after the termination
+	client, server = net.Pipe()
+	conn = newTestConn()
+	conn.close()
+	conn.attach(server)
+	_, err = client.Read(make([]byte, 1))
+	require.Error(t, err, "late hijacked connection must be closed")
+	require.Nil(t, conn.hijacked)
+}
+
+// testAuthorizer accepts any token as the one of the given user
+type testAuthorizer struct {
+	userID string
+}
+
+func (a testAuthorizer) Authenticate(ctx context.Context, tokenString string, myAudience string) (*auth.ClientClaims, error) {
+	claims := &auth.ClientClaims{}
+	claims.Subject = a.userID
+	claims.Id = uuid.New().String()
+	claims.InstallationId = uuid.New().String()
+	return claims, nil
+}
+
+// echoServer accepts the connections and echoes back everything received
+func echoServer(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener
+}
+
+func TestKillActiveUserSessions(t *testing.T) {
+	instance, err := New(&Config{ConnLimit: 10}, nil, nil, nil, &geoip.Resolver{})
+	require.NoError(t, err)
+	instance.authorizer = testAuthorizer{userID: "alice"}
+
+	server := httptest.NewServer(instance.ProxyHandler(http.NotFoundHandler()))
+	defer server.Close()
+	target := echoServer(t)
+
+	// open the tunnel to the target through the proxy
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	token := base64.StdEncoding.EncodeToString([]byte("token:"))
+	_, err = io.WriteString(conn, "CONNECT "+target.Addr().String()+" HTTP/1.1\r\n"+
+		"Host: "+target.Addr().String()+"\r\n"+
+		"Proxy-Authorization: Basic "+token+"\r\n\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	_, err = io.WriteString(conn, "ping")
+	require.NoError(t, err)
+	echo := make([]byte, 4)
+	_, err = io.ReadFull(reader, echo)
+	require.NoError(t, err)
+	require.Equal(t, "ping", string(echo))
+
+	// the authenticated tunnel is tracked by the user
+	instance.connections.lock.Lock()
+	require.Len(t, instance.connections.users["alice"], 1)
+	instance.connections.lock.Unlock()
+
+	// sessions of other users are untouched
+	instance.KillActiveUserSessions("bob")
+	_, err = io.WriteString(conn, "pong")
+	require.NoError(t, err)
+	_, err = io.ReadFull(reader, echo)
+	require.NoError(t, err)
+	require.Equal(t, "pong", string(echo))
+
+	instance.KillActiveUserSessions("alice")
+	_, err = reader.ReadByte()
+	require.Error(t, err, "killed tunnel must be closed")
+	require.NotErrorIs(t, err, os.ErrDeadlineExceeded, "killed tunnel must be closed")
+
+	instance.connections.lock.Lock()
+	require.NotContains(t, instance.connections.users, "alice")
+	instance.connections.lock.Unlock()
+}
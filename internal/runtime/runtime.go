@@ -18,6 +18,9 @@ import (
 
 type Flags struct {
 	RestartRequired bool
+	// Restarting is set while all services are being stopped and started again
+	// to let them keep their state (e.g the wireguard interface) for the next run.
+	Restarting bool
 }
 
 type ServicesInitFunc func(runtime *TunnelRuntime) error
@@ -88,6 +91,11 @@ func (runtime *TunnelRuntime) Stop() error {
 }
 
 func (runtime *TunnelRuntime) Restart() error {
+	runtime.Flags.Restarting = true
+	defer func() {
+		runtime.Flags.Restarting = false
+	}()
+
 	// Shutdown services
 	err := runtime.Stop()
 	if err != nil {
@@ -7,4 +7,10 @@ const (
 	DefaultMaxDownstreamTrafficChange     = "50Mb"
 
 	DefaultFlushStatisticsInterval = "5m"
+
+	DefaultTrafficHistory5mRetention     = "48h"
+	DefaultTrafficHistoryHourlyRetention = "720h"
+	DefaultTrafficHistoryDailyRetention  = "8760h"
+
+	DefaultIPLeasesRetention = "4320h"
 )
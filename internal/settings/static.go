@@ -5,6 +5,8 @@
 package settings
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"net"
 	"os"
@@ -30,6 +32,7 @@ import (
 	"github.com/vpnhouse/tunnel/internal/iprose"
 	"github.com/vpnhouse/tunnel/internal/proxy"
 	"github.com/vpnhouse/tunnel/internal/stats"
+	"github.com/vpnhouse/tunnel/internal/types"
 	"github.com/vpnhouse/tunnel/internal/wireguard"
 	"go.uber.org/zap"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -40,6 +43,7 @@ import (
 const (
 	defaultConfigDir = "/opt/vpnhouse/tunnel/"
 	configFileName   = "config.yaml"
+	secretsKeySize   = 32
 )
 
 type NetworkAccessPolicy struct {
@@ -95,6 +99,7 @@ type Config struct {
 	HTTP       HttpConfig       `yaml:"http"`
 
 	// optional configuration
+	WireguardInstances []wireguard.Config          `yaml:"wireguard_instances,omitempty"`
 	Proxy              *proxy.Config               `yaml:"proxy,omitempty"`
 	ExternalStats      *extstat.Config             `yaml:"external_stats,omitempty"`
 	Stats              *stats.Settings             `yanl:"stats,omitempty"`
@@ -110,6 +115,9 @@ type Config struct {
 	DNSFilter          *xdns.Config                `yaml:"dns_filter"`
 	PortRestrictions   *ipam.PortRestrictionConfig `yaml:"ports,omitempty"`
 	PeerStatistics     *PeerStatisticConfig        `yaml:"peer_statistics,omitempty"`
+	IPLeases           *IPLeasesConfig             `yaml:"ip_leases,omitempty"`
+	PeerLimit          *PeerLimitConfig            `yaml:"peer_limit,omitempty"`
+	ClientRoutes       *ClientRoutesConfig         `yaml:"client_routes,omitempty"`
 	GeoDBPath          string                      `yaml:"geo_db_path,omitempty"`
 	IPRose             iprose.Config               `yaml:"iprose,omitempty"`
 	Statistics         StatisticsConfig            `yaml:"statistics,omitempty"`
@@ -119,6 +127,10 @@ type Config struct {
 	MetricsLabels      map[string]string           `yaml:"metrics_labels"`
 	ReverseProxy       []*ReverseConfig            `yaml:"reverse_proxy"`
 
+	// SecretsKey encrypts secrets kept in the database,
+	// base64-encoded 32 bytes, generated automatically on the startup.
+	SecretsKey string `yaml:"secrets_key"`
+
 	// path to the config file, or default path in case of safe defaults.
 	// Used to override config via the admin API.
 	path string
@@ -194,6 +206,108 @@ func (s *Config) GetSentEventInterval() human.Interval {
 	return s.PeerStatistics.TrafficChangeSendEventInterval
 }
 
+func (s *Config) GetTrafficHistoryRetention() types.TrafficRetention {
+	c := defaultPeerStatisticConfig()
+	if s != nil && s.PeerStatistics != nil {
+		c = s.PeerStatistics
+	}
+	return types.TrafficRetention{
+		types.TrafficResolution5m:     c.TrafficHistory5mRetention.Value(),
+		types.TrafficResolutionHourly: c.TrafficHistoryHourlyRetention.Value(),
+		types.TrafficResolutionDaily:  c.TrafficHistoryDailyRetention.Value(),
+	}
+}
+
+// IPLeasesConfig configures the history of the IP addresses assigned to peers
+type IPLeasesConfig struct {
+	// How long to keep the ended leases, zero keeps them forever
+	Retention human.Interval `yaml:"retention" valid:"interval"`
+}
+
+// GetIPLeasesRetention returns how long to keep the ended IP leases, zero means forever
+func (s *Config) GetIPLeasesRetention() time.Duration {
+	if s == nil || s.IPLeases == nil {
+		return human.MustParseInterval(DefaultIPLeasesRetention).Value()
+	}
+	return s.IPLeases.Retention.Value()
+}
+
+const (
+	// PeerLimitReject rejects new peers of the user reached the limit
+	PeerLimitReject = "reject"
+	// PeerLimitEvict removes the least recently active peer of the user to make room for the new one
+	PeerLimitEvict = "evict"
+)
+
+// PeerLimitConfig limits the number of peers per user
+type PeerLimitConfig struct {
+	// Max number of peers per user, 0 means unlimited
+	MaxPerUser int `yaml:"max_per_user" valid:"natural"`
+	// Name of the JWT entitlement overriding the limit for the particular user,
+	// the zero or invalid entitlement value allows no peers
+	Entitlement string `yaml:"entitlement,omitempty"`
+	// What to do when the limit is reached: "reject" (default) or "evict"
+	Policy string `yaml:"policy,omitempty"`
+}
+
+func (s *PeerLimitConfig) validate() error {
+	switch s.Policy {
+	case "", PeerLimitReject, PeerLimitEvict:
+		return nil
+	}
+	return xerror.EInternalError("peer_limit.policy must be either reject or evict", nil, zap.String("policy", s.Policy))
+}
+
+// ClientRoutesConfig defines the networks the clients route through the tunnel,
+// see types.ClientRoutes. Peers may override the routes individually.
+type ClientRoutesConfig struct {
+	// Routes of all peers, "full" if not set
+	Default types.ClientRoutes `yaml:"default,omitempty"`
+	// Routes of peers by their network access policy, override the default ones
+	Policies map[int]types.ClientRoutes `yaml:"policies,omitempty"`
+}
+
+func (s *ClientRoutesConfig) validate() error {
+	if len(s.Default) > 0 {
+		if err := s.Default.Validate(); err != nil {
+			return err
+		}
+	}
+	for policy, routes := range s.Policies {
+		if err := routes.Validate(); err != nil {
+			return xerror.EInternalError("invalid client_routes.policies", err, zap.Int("policy", policy))
+		}
+	}
+	return nil
+}
+
+// GetClientRoutes returns the routes of the given peer: its own ones,
+// the ones of its network access policy or the default ones.
+// Nil peer stands for the default routes.
+func (s *Config) GetClientRoutes(peer *types.PeerInfo) types.ClientRoutes {
+	if peer != nil && peer.Routes != nil && len(*peer.Routes) > 0 {
+		return *peer.Routes
+	}
+	if s == nil || s.ClientRoutes == nil {
+		return types.ClientRoutesFull
+	}
+
+	if peer != nil {
+		policy := s.GetNetworkAccessPolicy().Access.DefaultPolicy.Int()
+		if peer.NetworkAccessPolicy != nil && *peer.NetworkAccessPolicy != ipam.AccessPolicyDefault {
+			policy = *peer.NetworkAccessPolicy
+		}
+		if routes, ok := s.ClientRoutes.Policies[policy]; ok {
+			return routes
+		}
+	}
+
+	if len(s.ClientRoutes.Default) > 0 {
+		return s.ClientRoutes.Default
+	}
+	return types.ClientRoutesFull
+}
+
 type HttpConfig struct {
 	// ListenAddr for HTTP server, default: ":80"
 	ListenAddr string `yaml:"listen_addr" valid:"listen_addr,required"`
@@ -247,6 +361,23 @@ type PeerStatisticConfig struct {
 	// "" or 0 means it's disabled
 	MaxUpstreamTrafficChange   human.Size `yaml:"max_upstream_traffic_change" valid:"size"`
 	MaxDownstreamTrafficChange human.Size `yaml:"max_downstream_traffic_change" valid:"size"`
+	// How long to keep the per-peer traffic history
+	// of the 5-minute, hourly and daily resolution.
+	TrafficHistory5mRetention     human.Interval `yaml:"traffic_history_5m_retention" valid:"interval"`
+	TrafficHistoryHourlyRetention human.Interval `yaml:"traffic_history_hourly_retention" valid:"interval"`
+	TrafficHistoryDailyRetention  human.Interval `yaml:"traffic_history_daily_retention" valid:"interval"`
+	// Remove peers which have made no wireguard handshake for the given period,
+	// the peers never connected are counted since their creation.
+	// "" or 0 means it's disabled
+	IdleExpiry human.Interval `yaml:"idle_expiry" valid:"interval"`
+}
+
+// GetPeerIdleExpiry returns the handshake age to remove peers after, zero means never
+func (s *Config) GetPeerIdleExpiry() time.Duration {
+	if s == nil || s.PeerStatistics == nil {
+		return 0
+	}
+	return s.PeerStatistics.IdleExpiry.Value()
 }
 
 func defaultPeerStatisticConfig() *PeerStatisticConfig {
@@ -255,6 +386,9 @@ func defaultPeerStatisticConfig() *PeerStatisticConfig {
 		TrafficChangeSendEventInterval: human.MustParseInterval(DefaultTrafficChangeSendEventInterval),
 		MaxUpstreamTrafficChange:       human.MustParseSize(DefaultMaxUpstreamTrafficChange),
 		MaxDownstreamTrafficChange:     human.MustParseSize(DefaultMaxDownstreamTrafficChange),
+		TrafficHistory5mRetention:      human.MustParseInterval(DefaultTrafficHistory5mRetention),
+		TrafficHistoryHourlyRetention:  human.MustParseInterval(DefaultTrafficHistoryHourlyRetention),
+		TrafficHistoryDailyRetention:   human.MustParseInterval(DefaultTrafficHistoryDailyRetention),
 	}
 }
 
@@ -266,6 +400,16 @@ func (s *PeerStatisticConfig) validate() {
 	if s.UpdateStatisticsInterval.Value() > s.TrafficChangeSendEventInterval.Value() {
 		s.TrafficChangeSendEventInterval = s.UpdateStatisticsInterval
 	}
+
+	if s.TrafficHistory5mRetention.Value() <= 0 {
+		s.TrafficHistory5mRetention = human.MustParseInterval(DefaultTrafficHistory5mRetention)
+	}
+	if s.TrafficHistoryHourlyRetention.Value() <= 0 {
+		s.TrafficHistoryHourlyRetention = human.MustParseInterval(DefaultTrafficHistoryHourlyRetention)
+	}
+	if s.TrafficHistoryDailyRetention.Value() <= 0 {
+		s.TrafficHistoryDailyRetention = human.MustParseInterval(DefaultTrafficHistoryDailyRetention)
+	}
 }
 
 type StatisticsConfig struct {
@@ -343,15 +487,34 @@ func loadStaticConfig(fs afero.Fs, path string) (*Config, error) {
 		c.Wireguard.PrivateKey = pk.String()
 		mustFlush = true
 	}
+	for i := range c.WireguardInstances {
+		if len(c.WireguardInstances[i].PrivateKey) == 0 {
+			pk, _ := wgtypes.GeneratePrivateKey()
+			c.WireguardInstances[i].PrivateKey = pk.String()
+			mustFlush = true
+		}
+	}
 
 	// apply on-load hooks here
 	if err := c.Wireguard.OnLoad(); err != nil {
 		return nil, err
 	}
+	for i := range c.WireguardInstances {
+		if err := c.WireguardInstances[i].OnLoad(); err != nil {
+			return nil, err
+		}
+	}
 	if len(c.InstanceID) == 0 {
 		c.InstanceID = uuid.New().String()
 		mustFlush = true
 	}
+	if len(c.SecretsKey) == 0 {
+		c.SecretsKey = generateSecretsKey()
+		mustFlush = true
+	}
+	if _, err := c.GetSecretsKey(); err != nil {
+		return nil, err
+	}
 
 	if mustFlush {
 		_ = c.flush()
@@ -392,9 +555,88 @@ func (s *Config) validate() error {
 		s.PeerStatistics.validate()
 	}
 
+	if s.PeerLimit != nil {
+		if err := s.PeerLimit.validate(); err != nil {
+			return err
+		}
+	}
+
+	if s.ClientRoutes != nil {
+		if err := s.ClientRoutes.validate(); err != nil {
+			return err
+		}
+	}
+
+	return s.validateWireguardInstances()
+}
+
+// validateWireguardInstances checks that the wireguard interfaces
+// do not share names, listen ports and subnets.
+func (s *Config) validateWireguardInstances() error {
+	if len(s.WireguardInstances) == 0 {
+		return nil
+	}
+
+	instances := s.WireguardInterfaces()
+	for i := range instances {
+		_, subnet, err := net.ParseCIDR(string(instances[i].Subnet))
+		if err != nil {
+			return xerror.EInternalError("invalid wireguard subnet", err, zap.String("iface", instances[i].Interface))
+		}
+
+		for _, other := range instances[:i] {
+			if instances[i].Interface == other.Interface {
+				return xerror.EInternalError("duplicate wireguard interface name", nil, zap.String("iface", other.Interface))
+			}
+			if instances[i].ListenPort == other.ListenPort {
+				return xerror.EInternalError("wireguard interfaces must listen on different ports", nil,
+					zap.String("iface", instances[i].Interface), zap.String("other", other.Interface))
+			}
+
+			_, otherSubnet, err := net.ParseCIDR(string(other.Subnet))
+			if err != nil {
+				continue
+			}
+			if subnet.Contains(otherSubnet.IP) || otherSubnet.Contains(subnet.IP) {
+				return xerror.EInternalError("wireguard interfaces must use non-overlapping subnets", nil,
+					zap.String("iface", instances[i].Interface), zap.String("other", other.Interface))
+			}
+		}
+	}
+
 	return nil
 }
 
+// WireguardInterfaces returns configurations of all wireguard interfaces,
+// the primary one goes first.
+// Extra interfaces inherit the public address of the primary one if not set.
+func (s *Config) WireguardInterfaces() []wireguard.Config {
+	configs := make([]wireguard.Config, 0, len(s.WireguardInstances)+1)
+	configs = append(configs, s.Wireguard)
+	for _, c := range s.WireguardInstances {
+		if len(c.ServerIPv4) == 0 {
+			c.ServerIPv4 = s.Wireguard.ServerIPv4
+		}
+		configs = append(configs, c)
+	}
+	return configs
+}
+
+// WireguardInterface returns configuration of the named wireguard interface,
+// empty name stands for the primary one.
+func (s *Config) WireguardInterface(name string) (wireguard.Config, bool) {
+	if len(name) == 0 {
+		return s.Wireguard, true
+	}
+
+	for _, c := range s.WireguardInterfaces() {
+		if c.Interface == name {
+			return c, true
+		}
+	}
+	return wireguard.Config{}, false
+}
+
 // safeDefaults provides safe static config with paths started with the rootDir
 func safeDefaults(rootDir string) *Config {
 	adminAPIConfig := defaultAdminAPIConfig()
@@ -405,6 +647,7 @@ func safeDefaults(rootDir string) *Config {
 	}
 	return &Config{
 		InstanceID: uuid.New().String(),
+		SecretsKey: generateSecretsKey(),
 		path:       filepath.Join(rootDir, configFileName),
 
 		HTTP: HttpConfig{
@@ -424,6 +667,24 @@ func safeDefaults(rootDir string) *Config {
 	}
 }
 
+// GetSecretsKey returns the key to encrypt secrets kept in the database
+func (s *Config) GetSecretsKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s.SecretsKey)
+	if err != nil {
+		return nil, xerror.EInternalError("failed to decode secrets_key", err)
+	}
+	if len(key) != secretsKeySize {
+		return nil, xerror.EInternalError(fmt.Sprintf("secrets_key must be %d bytes long", secretsKeySize), nil)
+	}
+	return key, nil
+}
+
+func generateSecretsKey() string {
+	key := make([]byte, secretsKeySize)
+	_, _ = rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
 func (s *Config) SetAdminPassword(plain string) error {
 	hash, err := validateAndHashPassword(plain)
 	if err != nil {
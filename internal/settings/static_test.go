@@ -11,6 +11,8 @@ import (
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/require"
 	"github.com/vpnhouse/common-lib-go/xhttp"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"github.com/vpnhouse/tunnel/internal/wireguard"
 )
 
 func TestEmptyFile(t *testing.T) {
@@ -60,6 +62,61 @@ func TestXValidation(t *testing.T) {
 	require.NoError(t, c.validate())
 }
 
+func TestWireguardInstancesValidation(t *testing.T) {
+	primary := wireguard.Config{Interface: "uwg0", ListenPort: 3000, Subnet: "10.235.0.0/16", ServerIPv4: "1.2.3.4"}
+	cases := []struct {
+		extra wireguard.Config
+		ok    bool
+	}{
+		{wireguard.Config{Interface: "uwg1", ListenPort: 443, Subnet: "10.236.0.0/24"}, true},
+		{wireguard.Config{Interface: "uwg0", ListenPort: 443, Subnet: "10.236.0.0/24"}, false},  // same name
+		{wireguard.Config{Interface: "uwg1", ListenPort: 3000, Subnet: "10.236.0.0/24"}, false}, // same port
+		{wireguard.Config{Interface: "uwg1", ListenPort: 443, Subnet: "10.235.1.0/24"}, false},  // nested subnet
+		{wireguard.Config{Interface: "uwg1", ListenPort: 443, Subnet: "10.0.0.0/8"}, false},     // outer subnet
+	}
+
+	for _, ca := range cases {
+		c := &Config{Wireguard: primary, WireguardInstances: []wireguard.Config{ca.extra}}
+		if ca.ok {
+			require.NoError(t, c.validate(), "extra: %+v", ca.extra)
+		} else {
+			require.Error(t, c.validate(), "extra: %+v", ca.extra)
+		}
+	}
+
+	c := &Config{Wireguard: primary, WireguardInstances: []wireguard.Config{cases[0].extra}}
+	extra, ok := c.WireguardInterface("uwg1")
+	require.True(t, ok)
+	require.Equal(t, primary.ServerIPv4, extra.ServerIPv4)
+	_, ok = c.WireguardInterface("uwg2")
+	require.False(t, ok)
+}
+
+func TestClientRoutes(t *testing.T) {
+	c := &Config{}
+	require.Equal(t, types.ClientRoutesFull, c.GetClientRoutes(nil))
+
+	policy := 2
+	custom := types.ClientRoutes("10.10.0.0/16")
+	c.ClientRoutes = &ClientRoutesConfig{
+		Default:  types.ClientRoutesPrivate,
+		Policies: map[int]types.ClientRoutes{policy: custom},
+	}
+	require.NoError(t, c.validate())
+	require.Equal(t, types.ClientRoutesPrivate, c.GetClientRoutes(nil))
+	require.Equal(t, custom, c.GetClientRoutes(&types.PeerInfo{NetworkAccessPolicy: &policy}))
+
+	own := types.ClientRoutesFull
+	require.Equal(t, own, c.GetClientRoutes(&types.PeerInfo{NetworkAccessPolicy: &policy, Routes: &own}))
+
+	require.Equal(t, []string{"10.10.0.0/16"}, custom.AllowedIPs(true))
+	require.Equal(t, []string{"0.0.0.0/0"}, types.ClientRoutesFull.AllowedIPs(false))
+	require.Equal(t, []string{"0.0.0.0/0", "::/0"}, types.ClientRoutesFull.AllowedIPs(true))
+
+	c.ClientRoutes.Policies[policy] = "10.10.0.0/33"
+	require.Error(t, c.validate())
+}
+
 func TestConfig_SetAdminPassword(t *testing.T) {
 	cases := []struct {
 		in string
@@ -1,6 +1,10 @@
 package stats
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 const Namespace = "tunnel"
 
@@ -42,10 +46,25 @@ func newPrometheusStats(proto string) *prometheusStats {
 		}),
 	}
 
-	prometheus.MustRegister(stats.peers)
-	prometheus.MustRegister(stats.active)
-	prometheus.MustRegister(stats.upstreamBytes)
-	prometheus.MustRegister(stats.downstreamBytes)
+	stats.peers = mustRegister(stats.peers)
+	stats.active = mustRegister(stats.active)
+	stats.upstreamBytes = mustRegister(stats.upstreamBytes)
+	stats.downstreamBytes = mustRegister(stats.downstreamBytes)
 
 	return &stats
 }
+
+// mustRegister registers the collector or returns the existing one
+// registered by the previous run of the service (e.g before the restart).
+func mustRegister[T prometheus.Collector](c T) T {
+	if err := prometheus.Register(c); err != nil {
+		var registered prometheus.AlreadyRegisteredError
+		if errors.As(err, &registered) {
+			if existing, ok := registered.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
@@ -25,9 +25,16 @@ var ErrNotFound = errors.New("not found")
 type Storage struct {
 	db       *sqlx.DB
 	keycache *keycache.Instance
+	secrets  *secretBox
 }
 
-func New(path string) (*Storage, error) {
+// New opens the database, secretsKey is used to encrypt secrets kept in the database.
+func New(path string, secretsKey []byte) (*Storage, error) {
+	secrets, err := newSecretBox(secretsKey)
+	if err != nil {
+		return nil, err
+	}
+
 	db, err := xstorage.NewSqlite3(path, migrations)
 	if err != nil {
 		return nil, err
@@ -36,6 +43,7 @@ func New(path string) (*Storage, error) {
 	storage := &Storage{
 		db:       db,
 		keycache: keycache.New(),
+		secrets:  secrets,
 	}
 
 	keys, err := storage.dbReadAuthorizerKeys()
@@ -0,0 +1,11 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "ipv6" VARCHAR(39);
+CREATE UNIQUE INDEX IF NOT EXISTS peers_ipv6 ON peers(ipv6);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+DROP INDEX IF EXISTS peers_ipv6;
+alter table "peers" drop column "ipv6";
+-- +migrate StatementEnd
@@ -0,0 +1,24 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "quota_bytes" integer;
+alter table "peers" add column "quota_period" varchar(16);
+alter table "peers" add column "quota_used" integer default 0;
+alter table "peers" add column "quota_reset" integer;
+
+CREATE TABLE IF NOT EXISTS user_quotas (
+    user_id         VARCHAR(256) PRIMARY KEY,
+    quota_bytes     INTEGER NOT NULL,
+    quota_period    VARCHAR(16) NOT NULL DEFAULT '',
+    quota_used      INTEGER NOT NULL DEFAULT 0,
+    quota_reset     INTEGER
+);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE user_quotas;
+alter table "peers" drop column "quota_bytes";
+alter table "peers" drop column "quota_period";
+alter table "peers" drop column "quota_used";
+alter table "peers" drop column "quota_reset";
+-- +migrate StatementEnd
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "wireguard_interface" varchar(32);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+alter table "peers" drop column "wireguard_interface";
+-- +migrate StatementEnd
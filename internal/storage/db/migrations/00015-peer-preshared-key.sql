@@ -0,0 +1,9 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "preshared_key" varchar(128);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+alter table "peers" drop column "preshared_key";
+-- +migrate StatementEnd
@@ -0,0 +1,25 @@
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS peer_groups (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    name                VARCHAR(256) NOT NULL UNIQUE,
+    net_access_policy   INTEGER,
+    net_rate_limit      INTEGER,
+    dns                 VARCHAR(256),
+    quota_bytes         INTEGER,
+    quota_period        VARCHAR(16),
+    expire_seconds      INTEGER,
+    created             INTEGER,
+    updated             INTEGER
+);
+
+alter table "peers" add column "group_id" integer;
+CREATE INDEX IF NOT EXISTS peers_group_id ON peers(group_id);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+DROP INDEX IF EXISTS peers_group_id;
+alter table "peers" drop column "group_id";
+DROP TABLE peer_groups;
+-- +migrate StatementEnd
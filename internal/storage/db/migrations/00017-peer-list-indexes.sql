@@ -0,0 +1,25 @@
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE INDEX IF NOT EXISTS peers_label_sort ON peers(coalesce(label, ''), id);
+CREATE INDEX IF NOT EXISTS peers_created ON peers(created, id);
+CREATE INDEX IF NOT EXISTS peers_updated ON peers(updated, id);
+CREATE INDEX IF NOT EXISTS peers_expires ON peers(coalesce(expires, 0), id);
+CREATE INDEX IF NOT EXISTS peers_expires_state ON peers(expires);
+CREATE INDEX IF NOT EXISTS peers_activity ON peers(coalesce(activity, 0), id);
+CREATE INDEX IF NOT EXISTS peers_activity_range ON peers(activity);
+CREATE INDEX IF NOT EXISTS peers_upstream ON peers(upstream, id);
+CREATE INDEX IF NOT EXISTS peers_downstream ON peers(downstream, id);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+DROP INDEX IF EXISTS peers_label_sort;
+DROP INDEX IF EXISTS peers_created;
+DROP INDEX IF EXISTS peers_updated;
+DROP INDEX IF EXISTS peers_expires;
+DROP INDEX IF EXISTS peers_expires_state;
+DROP INDEX IF EXISTS peers_activity;
+DROP INDEX IF EXISTS peers_activity_range;
+DROP INDEX IF EXISTS peers_upstream;
+DROP INDEX IF EXISTS peers_downstream;
+-- +migrate StatementEnd
@@ -0,0 +1,18 @@
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS peer_traffic (
+    peer_id     INTEGER NOT NULL,
+    resolution  INTEGER NOT NULL,
+    bucket      INTEGER NOT NULL,
+    upstream    INTEGER NOT NULL DEFAULT 0,
+    downstream  INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (peer_id, resolution, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS peer_traffic_retention ON peer_traffic(resolution, bucket);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE peer_traffic;
+-- +migrate StatementEnd
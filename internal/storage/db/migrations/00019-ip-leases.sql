@@ -0,0 +1,28 @@
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS ip_leases (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    ip              VARCHAR(39) NOT NULL,
+    peer_id         INTEGER NOT NULL,
+    user_id         VARCHAR(256),
+    installation_id VARCHAR(36),
+    wireguard_key   VARCHAR(44),
+    started         INTEGER NOT NULL,
+    ended           INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS ip_leases_ip ON ip_leases(ip, started);
+CREATE INDEX IF NOT EXISTS ip_leases_peer_id ON ip_leases(peer_id, ended);
+CREATE INDEX IF NOT EXISTS ip_leases_ended ON ip_leases(ended);
+
+-- the existing peers hold their addresses since the creation
+INSERT INTO ip_leases(ip, peer_id, user_id, installation_id, wireguard_key, started)
+    SELECT ipv4, id, user_id, installation_id, wireguard_key, created FROM peers;
+INSERT INTO ip_leases(ip, peer_id, user_id, installation_id, wireguard_key, started)
+    SELECT ipv6, id, user_id, installation_id, wireguard_key, created FROM peers WHERE ipv6 IS NOT NULL;
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE ip_leases;
+-- +migrate StatementEnd
@@ -0,0 +1,13 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "handshake" integer;
+alter table "peers" add column "endpoint" VARCHAR(64);
+alter table "peers" add column "activated" integer;
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+alter table "peers" drop column "handshake";
+alter table "peers" drop column "endpoint";
+alter table "peers" drop column "activated";
+-- +migrate StatementEnd
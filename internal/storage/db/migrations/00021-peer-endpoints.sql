@@ -0,0 +1,20 @@
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS peer_endpoints (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    peer_id     INTEGER NOT NULL,
+    user_id     VARCHAR(256),
+    endpoint    VARCHAR(64) NOT NULL,
+    country     VARCHAR(8) NOT NULL DEFAULT '',
+    seen        INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS peer_endpoints_peer_id ON peer_endpoints(peer_id, seen);
+CREATE INDEX IF NOT EXISTS peer_endpoints_user_id ON peer_endpoints(user_id, seen);
+CREATE INDEX IF NOT EXISTS peer_endpoints_seen ON peer_endpoints(seen);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+DROP TABLE peer_endpoints;
+-- +migrate StatementEnd
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "routes" VARCHAR(1024);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+alter table "peers" drop column "routes";
+-- +migrate StatementEnd
@@ -0,0 +1,9 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "routed_subnets" VARCHAR(1024);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+alter table "peers" drop column "routed_subnets";
+-- +migrate StatementEnd
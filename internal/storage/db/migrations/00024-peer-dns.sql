@@ -0,0 +1,9 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "dns" VARCHAR(256);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+alter table "peers" drop column "dns";
+-- +migrate StatementEnd
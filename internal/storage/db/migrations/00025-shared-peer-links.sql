@@ -0,0 +1,16 @@
+-- +migrate Up
+-- +migrate StatementBegin
+alter table "peers" add column "sharing_activations" integer;
+alter table "peers" add column "sharing_max_activations" integer;
+
+update "peers" set "sharing_activations" = 1 where "sharing_key_expiration" < 0;
+update "peers" set "sharing_key_expiration" = null where "sharing_key_expiration" < 0;
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+update "peers" set "sharing_key_expiration" = -1 where "sharing_activations" > 0;
+
+alter table "peers" drop column "sharing_activations";
+alter table "peers" drop column "sharing_max_activations";
+-- +migrate StatementEnd
@@ -0,0 +1,40 @@
+-- +migrate Up
+-- +migrate StatementBegin
+CREATE TABLE IF NOT EXISTS invites (
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    code                VARCHAR(64) NOT NULL UNIQUE,
+    label               VARCHAR(256),
+    max_redemptions     INTEGER,
+    redemptions         INTEGER NOT NULL DEFAULT 0,
+    expires             INTEGER,
+    net_access_policy   INTEGER,
+    net_rate_limit      INTEGER,
+    quota_bytes         INTEGER,
+    quota_period        VARCHAR(16),
+    peer_expire_seconds INTEGER,
+    created             INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS invite_redemptions (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    invite_id       INTEGER NOT NULL,
+    peer_id         INTEGER NOT NULL,
+    wireguard_key   VARCHAR(64),
+    ipv4            VARCHAR(64),
+    created         INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS invite_redemptions_invite_id ON invite_redemptions(invite_id);
+
+alter table "peers" add column "invite_id" integer;
+CREATE INDEX IF NOT EXISTS peers_invite_id ON peers(invite_id);
+-- +migrate StatementEnd
+
+-- +migrate Down
+-- +migrate StatementBegin
+DROP INDEX IF EXISTS peers_invite_id;
+alter table "peers" drop column "invite_id";
+DROP INDEX IF EXISTS invite_redemptions_invite_id;
+DROP TABLE invite_redemptions;
+DROP TABLE invites;
+-- +migrate StatementEnd
@@ -0,0 +1,83 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// AddPeerEndpoint appends the endpoint to the history of the peer
+func (storage *Storage) AddPeerEndpoint(endpoint *types.PeerEndpoint) error {
+	if endpoint.Seen == nil {
+		now := xtime.Now()
+		endpoint.Seen = &now
+	}
+
+	query := `
+		INSERT INTO
+			peer_endpoints(peer_id, user_id, endpoint, country, seen)
+		VALUES(:peer_id, :user_id, :endpoint, :country, :seen)
+	`
+	res, err := storage.db.NamedExec(query, endpoint)
+	if err != nil {
+		return xerror.EStorageError("can't insert peer endpoint", err, zap.Any("endpoint", endpoint))
+	}
+
+	endpoint.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// LastPeerEndpoint returns the latest endpoint of the peer, nil if there is none
+func (storage *Storage) LastPeerEndpoint(peerId int64) (*types.PeerEndpoint, error) {
+	row := storage.db.QueryRowx("SELECT * FROM peer_endpoints WHERE peer_id = $1 ORDER BY seen DESC, id DESC LIMIT 1", peerId)
+
+	var endpoint types.PeerEndpoint
+	if err := row.StructScan(&endpoint); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, xerror.EStorageError("failed to scan into types.PeerEndpoint", err, zap.Int64("peer_id", peerId))
+	}
+	return &endpoint, nil
+}
+
+// ListPeerEndpoints returns the endpoint history of the peer, the latest go first
+func (storage *Storage) ListPeerEndpoints(peerId int64, limit int) ([]*types.PeerEndpoint, error) {
+	rows, err := storage.db.Queryx("SELECT * FROM peer_endpoints WHERE peer_id = $1 ORDER BY seen DESC, id DESC LIMIT $2", peerId, limit)
+	if err != nil {
+		return nil, xerror.EStorageError("can't read peer endpoints", err, zap.Int64("peer_id", peerId))
+	}
+	defer rows.Close()
+
+	endpoints := []*types.PeerEndpoint{}
+	for rows.Next() {
+		var endpoint types.PeerEndpoint
+		if err := rows.StructScan(&endpoint); err != nil {
+			zap.L().Error("can't scan peer endpoint", zap.Error(err))
+			continue
+		}
+		endpoints = append(endpoints, &endpoint)
+	}
+
+	return endpoints, nil
+}
+
+// PurgePeerEndpoints removes the endpoint history older than the given moment
+func (storage *Storage) PurgePeerEndpoints(before time.Time) (int64, error) {
+	res, err := storage.db.Exec("DELETE FROM peer_endpoints WHERE seen < $1", before.Unix())
+	if err != nil {
+		return 0, xerror.EStorageError("can't purge peer endpoints", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return n, nil
+}
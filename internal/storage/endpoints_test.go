@@ -0,0 +1,78 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestPeerEndpoints(t *testing.T) {
+	storage := newTestStorage(t)
+	start := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	last, err := storage.LastPeerEndpoint(1)
+	require.NoError(t, err)
+	require.Nil(t, last, "no history yet")
+
+	history := []struct {
+		peerId   int64
+		endpoint string
+		country  string
+		seen     time.Duration
+	}{
+		{1, "1.2.3.4:51820", "de", 0},
+		{1, "5.6.7.8:40000", "fr", time.Hour},
+		{2, "9.9.9.9:51820", "", 2 * time.Hour},
+		// the roaming within the same second
+		{1, "1.2.3.4:51821", "de", time.Hour},
+	}
+	for _, h := range history {
+		seen := xtime.Time{Time: start.Add(h.seen)}
+		err := storage.AddPeerEndpoint(&types.PeerEndpoint{PeerId: h.peerId, Endpoint: h.endpoint, Country: h.country, Seen: &seen})
+		require.NoError(t, err)
+	}
+
+	cases := []struct {
+		peerId    int64
+		limit     int
+		endpoints []string
+	}{
+		{peerId: 1, limit: 10, endpoints: []string{"1.2.3.4:51821", "5.6.7.8:40000", "1.2.3.4:51820"}},
+		{peerId: 1, limit: 1, endpoints: []string{"1.2.3.4:51821"}},
+		{peerId: 2, limit: 10, endpoints: []string{"9.9.9.9:51820"}},
+		{peerId: 3, limit: 10, endpoints: []string{}},
+	}
+
+	for _, cc := range cases {
+		endpoints, err := storage.ListPeerEndpoints(cc.peerId, cc.limit)
+		require.NoError(t, err)
+		got := []string{}
+		for _, e := range endpoints {
+			got = append(got, e.Endpoint)
+		}
+		require.Equal(t, cc.endpoints, got, "peer: %d", cc.peerId)
+
+		last, err := storage.LastPeerEndpoint(cc.peerId)
+		require.NoError(t, err)
+		if len(cc.endpoints) == 0 {
+			require.Nil(t, last)
+		} else {
+			require.Equal(t, cc.endpoints[0], last.Endpoint, "peer: %d", cc.peerId)
+		}
+	}
+
+	n, err := storage.PurgePeerEndpoints(start.Add(90 * time.Minute))
+	require.NoError(t, err)
+	require.EqualValues(t, 3, n)
+
+	last, err = storage.LastPeerEndpoint(1)
+	require.NoError(t, err)
+	require.Nil(t, last)
+}
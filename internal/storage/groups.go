@@ -0,0 +1,110 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+func (storage *Storage) CreatePeerGroup(group *types.PeerGroup) (int64, error) {
+	if err := group.Validate("ID"); err != nil {
+		return -1, err
+	}
+
+	now := xtime.Now()
+	group.Created = &now
+	group.Updated = &now
+
+	query := `
+		INSERT INTO
+			peer_groups(name, net_access_policy, net_rate_limit, dns, quota_bytes, quota_period, expire_seconds, created, updated)
+		VALUES(:name, :net_access_policy, :net_rate_limit, :dns, :quota_bytes, :quota_period, :expire_seconds, :created, :updated)
+	`
+	res, err := storage.db.NamedExec(query, group)
+	if err != nil {
+		return -1, xerror.EStorageError("can't insert peer group", err, zap.Any("group", group))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, xerror.EStorageError("can't get peer group id after insert", err, zap.Any("group", group))
+	}
+
+	group.ID = id
+	return id, nil
+}
+
+func (storage *Storage) UpdatePeerGroup(group *types.PeerGroup) error {
+	if err := group.Validate(); err != nil {
+		return err
+	}
+
+	now := xtime.Now()
+	group.Updated = &now
+
+	query := `
+		UPDATE peer_groups SET
+			name = :name,
+			net_access_policy = :net_access_policy,
+			net_rate_limit = :net_rate_limit,
+			dns = :dns,
+			quota_bytes = :quota_bytes,
+			quota_period = :quota_period,
+			expire_seconds = :expire_seconds,
+			updated = :updated
+		WHERE id = :id
+	`
+	if _, err := storage.db.NamedExec(query, group); err != nil {
+		return xerror.EStorageError("can't update peer group", err, zap.Any("group", group))
+	}
+	return nil
+}
+
+func (storage *Storage) GetPeerGroup(id int64) (*types.PeerGroup, error) {
+	row := storage.db.QueryRowx("SELECT * FROM peer_groups WHERE id = $1", id)
+
+	var group types.PeerGroup
+	if err := row.StructScan(&group); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, xerror.EEntryNotFound("peer group not found", nil, zap.Int64("id", id))
+		}
+		return nil, xerror.EStorageError("failed to scan into types.PeerGroup", err, zap.Int64("id", id))
+	}
+
+	return &group, nil
+}
+
+func (storage *Storage) ListPeerGroups() ([]*types.PeerGroup, error) {
+	rows, err := storage.db.Queryx("SELECT * FROM peer_groups ORDER BY name")
+	if err != nil {
+		return nil, xerror.EStorageError("can't read peer groups", err)
+	}
+	defer rows.Close()
+
+	var groups []*types.PeerGroup
+	for rows.Next() {
+		var group types.PeerGroup
+		if err := rows.StructScan(&group); err != nil {
+			zap.L().Error("can't scan peer group", zap.Error(err))
+			continue
+		}
+		groups = append(groups, &group)
+	}
+
+	return groups, nil
+}
+
+func (storage *Storage) DeletePeerGroup(id int64) error {
+	if _, err := storage.db.Exec("DELETE FROM peer_groups WHERE id = $1", id); err != nil {
+		return xerror.EStorageError("failed to delete peer group", err, zap.Int64("id", id))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+func (storage *Storage) CreateInvite(invite *types.Invite) (int64, error) {
+	if err := invite.Validate("ID"); err != nil {
+		return -1, err
+	}
+
+	now := xtime.Now()
+	invite.Created = &now
+	invite.Redemptions = 0
+
+	query := `
+		INSERT INTO
+			invites(code, label, max_redemptions, redemptions, expires, net_access_policy, net_rate_limit, quota_bytes, quota_period, peer_expire_seconds, created)
+		VALUES(:code, :label, :max_redemptions, :redemptions, :expires, :net_access_policy, :net_rate_limit, :quota_bytes, :quota_period, :peer_expire_seconds, :created)
+	`
+	res, err := storage.db.NamedExec(query, invite)
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+			return -1, xerror.EInvalidField("invite code is already taken", "code", err)
+		}
+		return -1, xerror.EStorageError("can't insert invite", err, zap.Any("invite", invite))
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return -1, xerror.EStorageError("can't get invite id after insert", err, zap.Any("invite", invite))
+	}
+
+	invite.ID = id
+	return id, nil
+}
+
+func (storage *Storage) GetInvite(id int64) (*types.Invite, error) {
+	row := storage.db.QueryRowx("SELECT * FROM invites WHERE id = $1", id)
+
+	var invite types.Invite
+	if err := row.StructScan(&invite); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, xerror.EEntryNotFound("invite not found", nil, zap.Int64("id", id))
+		}
+		return nil, xerror.EStorageError("failed to scan into types.Invite", err, zap.Int64("id", id))
+	}
+
+	return &invite, nil
+}
+
+func (storage *Storage) GetInviteByCode(code string) (*types.Invite, error) {
+	row := storage.db.QueryRowx("SELECT * FROM invites WHERE code = $1", code)
+
+	var invite types.Invite
+	if err := row.StructScan(&invite); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, xerror.EEntryNotFound("invite not found", nil)
+		}
+		return nil, xerror.EStorageError("failed to scan into types.Invite", err)
+	}
+
+	return &invite, nil
+}
+
+func (storage *Storage) ListInvites() ([]*types.Invite, error) {
+	rows, err := storage.db.Queryx("SELECT * FROM invites ORDER BY id")
+	if err != nil {
+		return nil, xerror.EStorageError("can't read invites", err)
+	}
+	defer rows.Close()
+
+	var invites []*types.Invite
+	for rows.Next() {
+		var invite types.Invite
+		if err := rows.StructScan(&invite); err != nil {
+			zap.L().Error("can't scan invite", zap.Error(err))
+			continue
+		}
+		invites = append(invites, &invite)
+	}
+
+	return invites, nil
+}
+
+// RedeemInvite counts the redemption of the invite unless it has reached the limit
+// and records the peer created by it, both in a single transaction.
+func (storage *Storage) RedeemInvite(redemption *types.InviteRedemption) error {
+	if redemption.Created == nil {
+		now := xtime.Now()
+		redemption.Created = &now
+	}
+
+	tx, err := storage.db.Beginx()
+	if err != nil {
+		return xerror.EStorageError("failed to start the transaction", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	query := `
+		UPDATE invites SET redemptions = redemptions + 1
+		WHERE id = $1 AND (max_redemptions IS NULL OR redemptions < max_redemptions)
+	`
+	res, err := tx.Exec(query, redemption.InviteId)
+	if err != nil {
+		return xerror.EStorageError("can't redeem invite", err, zap.Int64("id", redemption.InviteId))
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return xerror.EStorageError("can't redeem invite", err, zap.Int64("id", redemption.InviteId))
+	}
+	if n == 0 {
+		return types.ErrInviteUsedUp
+	}
+
+	query = `
+		INSERT INTO
+			invite_redemptions(invite_id, peer_id, wireguard_key, ipv4, created)
+		VALUES(:invite_id, :peer_id, :wireguard_key, :ipv4, :created)
+	`
+	res, err = tx.NamedExec(query, redemption)
+	if err != nil {
+		return xerror.EStorageError("can't insert invite redemption", err, zap.Any("redemption", redemption))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return xerror.EStorageError("can't commit invite redemption", err, zap.Int64("id", redemption.InviteId))
+	}
+
+	redemption.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// ListInviteRedemptions returns all the redemptions of the invite, the earliest go first
+func (storage *Storage) ListInviteRedemptions(inviteId int64) ([]*types.InviteRedemption, error) {
+	rows, err := storage.db.Queryx("SELECT * FROM invite_redemptions WHERE invite_id = $1 ORDER BY id", inviteId)
+	if err != nil {
+		return nil, xerror.EStorageError("can't read invite redemptions", err, zap.Int64("invite_id", inviteId))
+	}
+	defer rows.Close()
+
+	redemptions := []*types.InviteRedemption{}
+	for rows.Next() {
+		var redemption types.InviteRedemption
+		if err := rows.StructScan(&redemption); err != nil {
+			zap.L().Error("can't scan invite redemption", zap.Error(err))
+			continue
+		}
+		redemptions = append(redemptions, &redemption)
+	}
+
+	return redemptions, nil
+}
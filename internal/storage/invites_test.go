@@ -0,0 +1,107 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestRedeemInvite(t *testing.T) {
+	storage := newTestStorage(t)
+	intp := func(v int) *int { return &v }
+
+	cases := []struct {
+		code           string
+		maxRedemptions *int
+		redeem         int
+		redemptions    int
+	}{
+		{code: "UNLIMITED-1", redeem: 5, redemptions: 5},
+		{code: "SINGLE-USE-1", maxRedemptions: intp(1), redeem: 3, redemptions: 1},
+		{code: "LIMITED-0001", maxRedemptions: intp(3), redeem: 5, redemptions: 3},
+	}
+
+	for _, cc := range cases {
+		invite := &types.Invite{Code: cc.code, MaxRedemptions: cc.maxRedemptions}
+		_, err := storage.CreateInvite(invite)
+		require.NoError(t, err, cc.code)
+
+		redemptions := 0
+		for i := 0; i < cc.redeem; i++ {
+			err := storage.RedeemInvite(&types.InviteRedemption{InviteId: invite.ID, PeerId: int64(i + 1)})
+			if err == nil {
+				redemptions++
+			}
+		}
+		require.Equal(t, cc.redemptions, redemptions, cc.code)
+
+		stored, err := storage.GetInviteByCode(cc.code)
+		require.NoError(t, err, cc.code)
+		require.Equal(t, cc.redemptions, stored.Redemptions, cc.code)
+		require.Equal(t, cc.maxRedemptions != nil, stored.UsedUp(), cc.code)
+
+		// the rejected redemptions are not recorded
+		records, err := storage.ListInviteRedemptions(invite.ID)
+		require.NoError(t, err, cc.code)
+		require.Len(t, records, cc.redemptions, cc.code)
+	}
+
+	_, err := storage.CreateInvite(&types.Invite{Code: "UNLIMITED-1"})
+	require.Error(t, err, "the code must be unique")
+	require.Contains(t, err.Error(), "already taken")
+}
+
+func TestInviteRedemptions(t *testing.T) {
+	storage := newTestStorage(t)
+
+	invite := &types.Invite{Code: "WORKSHOP-2021"}
+	_, err := storage.CreateInvite(invite)
+	require.NoError(t, err)
+
+	var peers []int64
+	for i := 0; i < 3; i++ {
+		peer := newTestPeer(t, i)
+		peer.InviteId = &invite.ID
+		id, err := storage.CreatePeer(peer)
+		require.NoError(t, err)
+		peers = append(peers, id)
+
+		err = storage.RedeemInvite(&types.InviteRedemption{
+			InviteId:           invite.ID,
+			PeerId:             id,
+			WireguardPublicKey: peer.WireguardPublicKey,
+			Ipv4:               peer.Ipv4,
+		})
+		require.NoError(t, err)
+	}
+
+	// the redemptions outlive the peers
+	require.NoError(t, storage.DeletePeer(peers[1]))
+
+	cases := []struct {
+		inviteId int64
+		peers    []int64
+	}{
+		{inviteId: invite.ID, peers: peers},
+		{inviteId: invite.ID + 1, peers: []int64{}},
+	}
+
+	for _, cc := range cases {
+		redemptions, err := storage.ListInviteRedemptions(cc.inviteId)
+		require.NoError(t, err)
+
+		ids := []int64{}
+		for _, redemption := range redemptions {
+			require.Equal(t, cc.inviteId, redemption.InviteId)
+			require.NotNil(t, redemption.Ipv4)
+			require.NotNil(t, redemption.Created)
+			ids = append(ids, redemption.PeerId)
+		}
+		require.Equal(t, cc.peers, ids, "invite: %d", cc.inviteId)
+	}
+}
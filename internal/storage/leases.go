@@ -0,0 +1,88 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// OpenIPLease appends the lease to the history
+func (storage *Storage) OpenIPLease(lease *types.IPLease) error {
+	if lease.Started == nil {
+		now := xtime.Now()
+		lease.Started = &now
+	}
+
+	query := `
+		INSERT INTO
+			ip_leases(ip, peer_id, user_id, installation_id, wireguard_key, started)
+		VALUES(:ip, :peer_id, :user_id, :installation_id, :wireguard_key, :started)
+	`
+	res, err := storage.db.NamedExec(query, lease)
+	if err != nil {
+		return xerror.EStorageError("can't insert ip lease", err, zap.Any("lease", lease))
+	}
+
+	lease.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// CloseIPLeases ends the active leases of the peer
+func (storage *Storage) CloseIPLeases(peerId int64, at time.Time) error {
+	query := "UPDATE ip_leases SET ended = $1 WHERE peer_id = $2 AND ended IS NULL"
+	if _, err := storage.db.Exec(query, at.Unix(), peerId); err != nil {
+		return xerror.EStorageError("can't close ip leases", err, zap.Int64("peer_id", peerId))
+	}
+	return nil
+}
+
+// FindIPLeases returns the leases of the IP address, the latest go first.
+// If the moment is given, only the leases active at that moment are returned.
+func (storage *Storage) FindIPLeases(ip string, at *time.Time, limit int) ([]*types.IPLease, error) {
+	query := "SELECT * FROM ip_leases WHERE ip = :ip"
+	params := map[string]interface{}{
+		"ip":    ip,
+		"limit": limit,
+	}
+	if at != nil {
+		query += " AND started <= :at AND (ended IS NULL OR ended > :at)"
+		params["at"] = at.Unix()
+	}
+	query += " ORDER BY started DESC, id DESC LIMIT :limit"
+
+	rows, err := storage.db.NamedQuery(query, params)
+	if err != nil {
+		return nil, xerror.EStorageError("can't lookup ip leases", err, zap.String("ip", ip))
+	}
+	defer rows.Close()
+
+	leases := []*types.IPLease{}
+	for rows.Next() {
+		var lease types.IPLease
+		if err := rows.StructScan(&lease); err != nil {
+			zap.L().Error("can't scan ip lease", zap.Error(err))
+			continue
+		}
+		leases = append(leases, &lease)
+	}
+
+	return leases, nil
+}
+
+// PurgeIPLeases removes the leases ended before the given moment
+func (storage *Storage) PurgeIPLeases(before time.Time) (int64, error) {
+	res, err := storage.db.Exec("DELETE FROM ip_leases WHERE ended < $1", before.Unix())
+	if err != nil {
+		return 0, xerror.EStorageError("can't purge ip leases", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return n, nil
+}
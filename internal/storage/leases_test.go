@@ -0,0 +1,79 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestIPLeases(t *testing.T) {
+	storage := newTestStorage(t)
+	start := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	open := func(peerId int64, d time.Duration) {
+		started := xtime.Time{Time: at(d)}
+		userId := "user"
+		err := storage.OpenIPLease(&types.IPLease{IP: "10.235.0.2", PeerId: peerId, UserId: &userId, Started: &started})
+		require.NoError(t, err)
+	}
+
+	// the address is used by the peer 1, then by the peer 2 which is still active
+	open(1, 0)
+	require.NoError(t, storage.CloseIPLeases(1, at(time.Hour)))
+	open(2, 2*time.Hour)
+	// closing twice keeps the original end
+	require.NoError(t, storage.CloseIPLeases(1, at(3*time.Hour)))
+
+	cases := []struct {
+		name  string
+		at    *time.Time
+		peers []int64
+	}{
+		{name: "whole history", peers: []int64{2, 1}},
+		{name: "before the first lease", at: timePtr(at(-time.Minute)), peers: []int64{}},
+		{name: "first lease", at: timePtr(at(30 * time.Minute)), peers: []int64{1}},
+		{name: "lease end is exclusive", at: timePtr(at(time.Hour)), peers: []int64{}},
+		{name: "between the leases", at: timePtr(at(90 * time.Minute)), peers: []int64{}},
+		{name: "active lease", at: timePtr(at(24 * time.Hour)), peers: []int64{2}},
+	}
+
+	for _, cc := range cases {
+		leases, err := storage.FindIPLeases("10.235.0.2", cc.at, 10)
+		require.NoError(t, err, cc.name)
+		peers := []int64{}
+		for _, lease := range leases {
+			peers = append(peers, lease.PeerId)
+		}
+		require.Equal(t, cc.peers, peers, cc.name)
+	}
+
+	leases, err := storage.FindIPLeases("10.235.0.2", nil, 10)
+	require.NoError(t, err)
+	require.Nil(t, leases[0].Ended)
+	require.Equal(t, at(time.Hour).Unix(), leases[1].Ended.Unix())
+
+	leases, err = storage.FindIPLeases("10.235.0.3", nil, 10)
+	require.NoError(t, err)
+	require.Empty(t, leases)
+
+	// only the ended leases are purged
+	n, err := storage.PurgeIPLeases(at(48 * time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	leases, err = storage.FindIPLeases("10.235.0.2", nil, 10)
+	require.NoError(t, err)
+	require.Len(t, leases, 1)
+	require.EqualValues(t, 2, leases[0].PeerId)
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
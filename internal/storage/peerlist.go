@@ -0,0 +1,252 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// peerSortKey is the SQL expression to sort peers by,
+// it matches the expression of the corresponding index.
+type peerSortKey struct {
+	expr  string
+	text  bool
+	value func(peer *types.PeerInfo) interface{}
+}
+
+func unixOrZero(t *xtime.Time) interface{} {
+	if t == nil {
+		return int64(0)
+	}
+	return t.Unix()
+}
+
+func int64OrZero(v *int64) interface{} {
+	if v == nil {
+		return int64(0)
+	}
+	return *v
+}
+
+var peerSortKeys = map[string]peerSortKey{
+	types.PeerSortId: {
+		expr:  "id",
+		value: func(p *types.PeerInfo) interface{} { return p.ID },
+	},
+	types.PeerSortLabel: {
+		expr: "coalesce(label, '')",
+		text: true,
+		value: func(p *types.PeerInfo) interface{} {
+			if p.Label == nil {
+				return ""
+			}
+			return *p.Label
+		},
+	},
+	types.PeerSortCreated: {
+		expr:  "created",
+		value: func(p *types.PeerInfo) interface{} { return unixOrZero(p.Created) },
+	},
+	types.PeerSortUpdated: {
+		expr:  "updated",
+		value: func(p *types.PeerInfo) interface{} { return unixOrZero(p.Updated) },
+	},
+	types.PeerSortExpires: {
+		expr:  "coalesce(expires, 0)",
+		value: func(p *types.PeerInfo) interface{} { return unixOrZero(p.Expires) },
+	},
+	types.PeerSortActivity: {
+		expr:  "coalesce(activity, 0)",
+		value: func(p *types.PeerInfo) interface{} { return unixOrZero(p.Activity) },
+	},
+	types.PeerSortUpstream: {
+		expr:  "upstream",
+		value: func(p *types.PeerInfo) interface{} { return int64OrZero(p.Upstream) },
+	},
+	types.PeerSortDownstream: {
+		expr:  "downstream",
+		value: func(p *types.PeerInfo) interface{} { return int64OrZero(p.Downstream) },
+	},
+}
+
+// peerCursor points to the last peer of the page
+type peerCursor struct {
+	Value json.RawMessage `json:"v"`
+	ID    int64           `json:"id"`
+}
+
+func encodePeerCursor(key peerSortKey, peer *types.PeerInfo) string {
+	value, _ := json.Marshal(key.value(peer))
+	data, _ := json.Marshal(peerCursor{Value: value, ID: peer.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePeerCursor(key peerSortKey, s string) (interface{}, int64, error) {
+	errInvalid := xerror.EInvalidField("invalid cursor", "cursor", nil)
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, 0, errInvalid
+	}
+
+	var cursor peerCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, 0, errInvalid
+	}
+
+	// the value type must match the sort expression,
+	// otherwise sqlite compares the values of different types.
+	if key.text {
+		var value string
+		if err := json.Unmarshal(cursor.Value, &value); err != nil {
+			return nil, 0, errInvalid
+		}
+		return value, cursor.ID, nil
+	}
+
+	var value int64
+	if err := json.Unmarshal(cursor.Value, &value); err != nil {
+		return nil, 0, errInvalid
+	}
+	return value, cursor.ID, nil
+}
+
+// ListPeers returns the page of peers matching the query
+func (storage *Storage) ListPeers(query *types.PeerQuery) (*types.PeerPage, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	sort := query.Sort
+	if len(sort) == 0 {
+		sort = types.PeerSortId
+	}
+	key := peerSortKeys[sort]
+
+	var where []string
+	params := map[string]interface{}{}
+
+	if len(query.Search) > 0 {
+		where = append(where, "(label LIKE :search ESCAPE '\\' OR user_id LIKE :search ESCAPE '\\')")
+		params["search"] = "%" + escapeLike(query.Search) + "%"
+	}
+	if len(query.IP) > 0 {
+		where = append(where, "(ipv4 = :ip OR ipv6 = :ip)")
+		params["ip"] = query.IP
+	}
+	switch query.State {
+	case types.PeerStateActive:
+		where = append(where, "(expires IS NULL OR expires > :now)")
+		params["now"] = time.Now().Unix()
+	case types.PeerStateExpired:
+		where = append(where, "expires <= :now")
+		params["now"] = time.Now().Unix()
+	}
+	if query.ActivityFrom != nil {
+		where = append(where, "activity >= :activity_from")
+		params["activity_from"] = query.ActivityFrom.Unix()
+	}
+	if query.ActivityTo != nil {
+		where = append(where, "activity < :activity_to")
+		params["activity_to"] = query.ActivityTo.Unix()
+	}
+
+	zapQuery := zap.Any("query", query)
+
+	total, err := storage.countPeers(where, params)
+	if err != nil {
+		return nil, xerror.EStorageError("can't count peers", err, zapQuery)
+	}
+
+	order, cmp := "ASC", ">"
+	if query.Desc {
+		order, cmp = "DESC", "<"
+	}
+
+	if len(query.Cursor) > 0 {
+		value, id, err := decodePeerCursor(key, query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		where = append(where, "("+key.expr+" "+cmp+" :cursor_value OR ("+key.expr+" = :cursor_value AND id "+cmp+" :cursor_id))")
+		params["cursor_value"] = value
+		params["cursor_id"] = id
+	}
+
+	stmt := "SELECT * FROM peers" + whereClause(where) + " ORDER BY " + key.expr + " " + order + ", id " + order
+	if query.Limit > 0 {
+		// fetch one more to know if there is the next page
+		stmt += " LIMIT :limit"
+		params["limit"] = query.Limit + 1
+	}
+
+	rows, err := storage.db.NamedQuery(stmt, params)
+	if err != nil {
+		return nil, xerror.EStorageError("can't list peers", err, zapQuery)
+	}
+	defer rows.Close()
+
+	page := &types.PeerPage{Total: total}
+	for rows.Next() {
+		var p types.PeerInfo
+		if err := rows.StructScan(&p); err != nil {
+			zap.L().Error("can't scan peer", zap.Error(err), zapQuery)
+			continue
+		}
+		storage.openPeer(&p)
+
+		if query.Limit > 0 && len(page.Peers) == query.Limit {
+			page.NextCursor = encodePeerCursor(key, page.Peers[len(page.Peers)-1])
+			break
+		}
+
+		// We must ensure database integrity
+		if err := p.Validate(); err != nil {
+			zap.L().Error("skipping invalid peer", zap.Error(err), zapQuery)
+			continue
+		}
+
+		page.Peers = append(page.Peers, &p)
+	}
+
+	return page, nil
+}
+
+func (storage *Storage) countPeers(where []string, params map[string]interface{}) (int64, error) {
+	rows, err := storage.db.NamedQuery("SELECT count(*) FROM peers"+whereClause(where), params)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var total int64
+	if rows.Next() {
+		if err := rows.Scan(&total); err != nil {
+			return 0, err
+		}
+	}
+	return total, rows.Err()
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
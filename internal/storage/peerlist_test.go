@@ -0,0 +1,115 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xnet"
+	"github.com/vpnhouse/common-lib-go/xtime"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	storage, err := New(filepath.Join(t.TempDir(), "db.sqlite3"), bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = storage.Shutdown() })
+	return storage
+}
+
+func newTestPeer(t *testing.T, n int) types.PeerInfo {
+	key, err := wgtypes.GeneratePrivateKey()
+	require.NoError(t, err)
+	publicKey := key.PublicKey().String()
+	ipv4 := xnet.ParseIP(fmt.Sprintf("10.235.0.%d", n+2))
+	return types.PeerInfo{
+		Ipv4:          &ipv4,
+		WireguardInfo: types.WireguardInfo{WireguardPublicKey: &publicKey},
+	}
+}
+
+func TestPeerCursor(t *testing.T) {
+	label := "laptop"
+	created := xtime.Time{}
+	peer := &types.PeerInfo{ID: 42, Label: &label, Created: &created}
+
+	cases := []struct {
+		sort  string
+		value interface{}
+	}{
+		{types.PeerSortId, int64(42)},
+		{types.PeerSortLabel, "laptop"},
+		{types.PeerSortCreated, created.Unix()},
+		{types.PeerSortActivity, int64(0)},
+		{types.PeerSortUpstream, int64(0)},
+	}
+
+	for _, cc := range cases {
+		key := peerSortKeys[cc.sort]
+		value, id, err := decodePeerCursor(key, encodePeerCursor(key, peer))
+		require.NoError(t, err, cc.sort)
+		require.Equal(t, cc.value, value, cc.sort)
+		require.Equal(t, peer.ID, id, cc.sort)
+	}
+
+	invalid := []string{"", "!", "e30", "eyJ2IjoibGFwdG9wIiwiaWQiOjF9"}
+	for _, cursor := range invalid {
+		_, _, err := decodePeerCursor(peerSortKeys[types.PeerSortId], cursor)
+		require.Error(t, err, "cursor: %q", cursor)
+	}
+}
+
+func TestListPeersPagination(t *testing.T) {
+	storage := newTestStorage(t)
+
+	labels := []string{"b", "a", "c", "a", "b"}
+	for i, label := range labels {
+		peer := newTestPeer(t, i)
+		label := label
+		peer.Label = &label
+		_, err := storage.CreatePeer(peer)
+		require.NoError(t, err)
+	}
+
+	cases := []struct {
+		query types.PeerQuery
+		ids   []int64
+	}{
+		{types.PeerQuery{}, []int64{1, 2, 3, 4, 5}},
+		{types.PeerQuery{Desc: true}, []int64{5, 4, 3, 2, 1}},
+		{types.PeerQuery{Sort: types.PeerSortLabel}, []int64{2, 4, 1, 5, 3}},
+		{types.PeerQuery{Sort: types.PeerSortLabel, Desc: true}, []int64{3, 5, 1, 4, 2}},
+		{types.PeerQuery{Search: "a"}, []int64{2, 4}},
+		{types.PeerQuery{IP: "10.235.0.4"}, []int64{3}},
+	}
+
+	for _, cc := range cases {
+		for _, limit := range []int{0, 1, 2, 5} {
+			query := cc.query
+			query.Limit = limit
+
+			var ids []int64
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, len(labels)+1, "too many pages")
+				page, err := storage.ListPeers(&query)
+				require.NoError(t, err)
+				require.EqualValues(t, len(cc.ids), page.Total, "query: %+v", query)
+				for _, peer := range page.Peers {
+					ids = append(ids, peer.ID)
+				}
+				if len(page.NextCursor) == 0 {
+					break
+				}
+				query.Cursor = page.NextCursor
+			}
+			require.Equal(t, cc.ids, ids, "query: %+v", query)
+		}
+	}
+}
@@ -41,6 +41,7 @@ func (storage *Storage) SearchPeers(filter *types.PeerInfo) ([]*types.PeerInfo,
 			zap.L().Error("can't scan peer", zap.Error(err), zapFilter)
 			continue
 		}
+		storage.openPeer(&p)
 
 		// We must ensure database integrity
 		if err := p.Validate(); err != nil {
@@ -82,7 +83,12 @@ func (storage *Storage) CreatePeer(peer types.PeerInfo) (int64, error) {
 
 	zap.L().Debug("Create peer", zap.Any("peer", peer), zap.String("query", query))
 
-	res, err := storage.db.NamedExec(query, peer)
+	sealedPeer, err := storage.sealPeer(&peer)
+	if err != nil {
+		return -1, err
+	}
+
+	res, err := storage.db.NamedExec(query, sealedPeer)
 	if err != nil {
 		return -1, xerror.EStorageError("can't insert peer to sqlite", err, zap.Any("peer", peer), zap.String("query", query))
 	}
@@ -95,13 +101,58 @@ func (storage *Storage) CreatePeer(peer types.PeerInfo) (int64, error) {
 	return id, nil
 }
 
-// Update only statistics related peer details
-func (storage *Storage) UpdatePeerStats(now time.Time, peer *types.PeerInfo) error {
-	peer.Updated = &xtime.Time{Time: now}
-	query := "UPDATE peers SET updated=:updated, activity=:activity, upstream=:upstream, downstream=:downstream WHERE id=:id"
-	_, err := storage.db.NamedExec(query, peer)
+// UpdatePeerStats stores the changes found by the stats sync in a single transaction
+func (storage *Storage) UpdatePeerStats(now time.Time, updates []types.PeerStatsUpdate) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	tx, err := storage.db.Beginx()
+	if err != nil {
+		return xerror.EStorageError("failed to start the transaction", err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	statsStmt, err := tx.PrepareNamed("UPDATE peers SET updated=:updated, activity=:activity, upstream=:upstream, downstream=:downstream, quota_used=:quota_used WHERE id=:id")
+	if err != nil {
+		return xerror.EStorageError("can't prepare peer stats update", err)
+	}
+	defer statsStmt.Close()
+
+	handshakeStmt, err := tx.PrepareNamed("UPDATE peers SET handshake=:handshake, endpoint=:endpoint WHERE id=:id")
 	if err != nil {
-		return xerror.EStorageError("can't update peer stats", err, zap.Any("peer", peer))
+		return xerror.EStorageError("can't prepare peer handshake update", err)
+	}
+	defer handshakeStmt.Close()
+
+	trafficStmt, err := tx.Preparex(addPeerTrafficQuery)
+	if err != nil {
+		return xerror.EStorageError("can't prepare peer traffic history update", err)
+	}
+	defer trafficStmt.Close()
+
+	updated := xtime.Time{Time: now}
+	for _, update := range updates {
+		peer := update.Peer
+		if update.HasTraffic() {
+			peer.Updated = &updated
+			if _, err := statsStmt.Exec(peer); err != nil {
+				return xerror.EStorageError("can't update peer stats", err, zap.Int64("id", peer.ID))
+			}
+			if _, err := trafficStmt.Exec(peerTrafficArgs(peer.ID, now, update.Upstream, update.Downstream)...); err != nil {
+				return xerror.EStorageError("can't update peer traffic history", err, zap.Int64("id", peer.ID))
+			}
+		}
+
+		if update.Handshake {
+			if _, err := handshakeStmt.Exec(peer); err != nil {
+				return xerror.EStorageError("can't update peer handshake", err, zap.Int64("id", peer.ID))
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return xerror.EStorageError("failed to commit peer stats", err)
 	}
 	return nil
 }
@@ -116,14 +167,19 @@ func (storage *Storage) UpdatePeer(peer *types.PeerInfo) (int64, error) {
 	now := xtime.Now()
 	peer.Updated = &now
 
-	query, err := xstorage.GetUpdateRequest("peers", "id", peer, []string{"created", "activity", "upstream", "downstream"})
+	query, err := xstorage.GetUpdateRequest("peers", "id", peer, []string{"created", "activity", "upstream", "downstream", "quota_used", "quota_reset", "handshake", "endpoint"})
 	zap.L().Debug("Update peer", zap.Any("peer", peer), zap.String("query", query))
 
 	if err != nil {
 		return -1, xerror.EStorageError("can't insert peer", err, zap.Any("peer", peer))
 	}
 
-	if _, err := storage.db.NamedExec(query, peer); err != nil {
+	sealedPeer, err := storage.sealPeer(peer)
+	if err != nil {
+		return -1, err
+	}
+
+	if _, err := storage.db.NamedExec(query, sealedPeer); err != nil {
 		return -1, xerror.EStorageError("can't update peer in sqlite", err, zap.Any("peer", peer), zap.String("query", query))
 	}
 
@@ -138,8 +194,12 @@ func (storage *Storage) GetPeer(id int64) (*types.PeerInfo, error) {
 
 	var peer types.PeerInfo
 	if err := row.StructScan(&peer); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, xerror.EEntryNotFound("peer not found", nil, zap.Int64("id", id))
+		}
 		return nil, xerror.EStorageError("failed to scan into types.PeerInfo", err, zap.Int64("id", id))
 	}
+	storage.openPeer(&peer)
 
 	if err := peer.Validate(); err != nil {
 		return nil, err
@@ -171,42 +231,7 @@ func (s *Storage) GetPeerBySharingKey(skey string) (types.PeerInfo, error) {
 		}
 		return types.PeerInfo{}, xerror.EStorageError("failed to scan into types.PeerInfo", err, zap.String("key", skey))
 	}
+	s.openPeer(&peer)
 
 	return peer, nil
 }
-
-func (storage *Storage) ActivateSharedPeer(sharingKey string, pubkey string) (int64, error) {
-	q := `select * from peers where sharing_key = $1`
-
-	txx, err := storage.db.Beginx()
-	if err != nil {
-		return -1, xerror.EInternalError("failed to start the transaction", err)
-	}
-
-	row := txx.QueryRowx(q, sharingKey)
-	var peer types.PeerInfo
-	if err := row.StructScan(&peer); err != nil {
-		_ = txx.Rollback()
-
-		if errors.Is(err, sql.ErrNoRows) {
-			return -1, xerror.EEntryNotFound("no peer with a given sharing key where found", nil)
-		}
-		return -1, xerror.EStorageError("failed to scan into types.PeerInfo", err, zap.String("key", sharingKey))
-	}
-
-	if peer.SharingKeyExpiration != nil && *peer.SharingKeyExpiration > 0 {
-		zap.L().Debug("peer: peer reactivation")
-	}
-
-	// note: do not remove the sharing key value to be able to query
-	//  and re-activate the peer using the pre-shared URL.
-	q = `update peers set sharing_key_expiration = -1, wireguard_key = $1 where id = $2`
-	if _, err := txx.Exec(q, pubkey, peer.ID); err != nil {
-		_ = txx.Rollback()
-		return -1, xerror.EStorageError("failed to update peer", err)
-	}
-
-	_ = txx.Commit()
-	zap.L().Info("shared peer activated", zap.Int64("id", peer.ID), zap.String("sharing_key", sharingKey))
-	return peer.ID, nil
-}
@@ -0,0 +1,103 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// UpdatePeerQuota stores the quota usage details of the peer
+func (storage *Storage) UpdatePeerQuota(peer *types.PeerInfo) error {
+	query := "UPDATE peers SET quota_used=:quota_used, quota_reset=:quota_reset WHERE id=:id"
+	if _, err := storage.db.NamedExec(query, peer); err != nil {
+		return xerror.EStorageError("can't update peer quota", err, zap.Int64("id", peer.ID))
+	}
+	return nil
+}
+
+// FindUserQuota returns the quota of the given user, nil if the user has no quota set
+func (storage *Storage) FindUserQuota(userId string) (*types.UserQuota, error) {
+	row := storage.db.QueryRowx("SELECT * FROM user_quotas WHERE user_id = $1", userId)
+
+	var quota types.UserQuota
+	if err := row.StructScan(&quota); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, xerror.EStorageError("failed to scan into types.UserQuota", err, zap.String("user_id", userId))
+	}
+
+	return &quota, nil
+}
+
+func (storage *Storage) ListUserQuotas() ([]*types.UserQuota, error) {
+	rows, err := storage.db.Queryx("SELECT * FROM user_quotas ORDER BY user_id")
+	if err != nil {
+		return nil, xerror.EStorageError("can't read user quotas", err)
+	}
+	defer rows.Close()
+
+	var quotas []*types.UserQuota
+	for rows.Next() {
+		var quota types.UserQuota
+		if err := rows.StructScan(&quota); err != nil {
+			zap.L().Error("can't scan user quota", zap.Error(err))
+			continue
+		}
+		quotas = append(quotas, &quota)
+	}
+
+	return quotas, nil
+}
+
+// SetUserQuota creates or replaces the user quota limit keeping the current usage
+func (storage *Storage) SetUserQuota(quota *types.UserQuota) error {
+	if err := quota.Validate(); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO
+			user_quotas(user_id, quota_bytes, quota_period, quota_used, quota_reset)
+		VALUES(:user_id, :quota_bytes, :quota_period, :quota_used, :quota_reset)
+		ON CONFLICT(user_id) DO UPDATE SET
+			quota_bytes = excluded.quota_bytes,
+			quota_period = excluded.quota_period
+	`
+	if _, err := storage.db.NamedExec(query, quota); err != nil {
+		return xerror.EStorageError("can't set user quota", err, zap.Any("quota", quota))
+	}
+	return nil
+}
+
+func (storage *Storage) DeleteUserQuota(userId string) error {
+	if _, err := storage.db.Exec("DELETE FROM user_quotas WHERE user_id = $1", userId); err != nil {
+		return xerror.EStorageError("can't delete user quota", err, zap.String("user_id", userId))
+	}
+	return nil
+}
+
+// AddUserQuotaUsage adds the traffic to the quota usage of the user, if any
+func (storage *Storage) AddUserQuotaUsage(userId string, bytes int64) error {
+	query := "UPDATE user_quotas SET quota_used = quota_used + $1 WHERE user_id = $2"
+	if _, err := storage.db.Exec(query, bytes, userId); err != nil {
+		return xerror.EStorageError("can't update user quota usage", err, zap.String("user_id", userId))
+	}
+	return nil
+}
+
+// UpdateUserQuotaUsage stores the quota usage details of the user
+func (storage *Storage) UpdateUserQuotaUsage(quota *types.UserQuota) error {
+	query := "UPDATE user_quotas SET quota_used=:quota_used, quota_reset=:quota_reset WHERE user_id=:user_id"
+	if _, err := storage.db.NamedExec(query, quota); err != nil {
+		return xerror.EStorageError("can't update user quota usage", err, zap.String("user_id", quota.UserId))
+	}
+	return nil
+}
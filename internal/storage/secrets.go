@@ -0,0 +1,96 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// secretBox encrypts secrets kept in the database, e.g peers' preshared keys
+type secretBox struct {
+	aead cipher.AEAD
+}
+
+func newSecretBox(key []byte) (*secretBox, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, xerror.EInternalError("invalid storage secrets key", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, xerror.EInternalError("failed to create storage secrets cipher", err)
+	}
+
+	return &secretBox{aead: aead}, nil
+}
+
+// seal returns base64-encoded nonce followed by the encrypted value
+func (b *secretBox) seal(plain string) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", xerror.EInternalError("failed to generate nonce", err)
+	}
+
+	sealed := b.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (b *secretBox) open(sealed string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", xerror.EStorageError("failed to decode the secret", err)
+	}
+
+	nonceSize := b.aead.NonceSize()
+	if len(data) < nonceSize {
+		return "", xerror.EStorageError("the secret is too short", nil)
+	}
+
+	plain, err := b.aead.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return "", xerror.EStorageError("failed to decrypt the secret", err)
+	}
+	return string(plain), nil
+}
+
+// sealPeer returns a copy of the peer with secrets encrypted to store them
+func (storage *Storage) sealPeer(peer *types.PeerInfo) (*types.PeerInfo, error) {
+	if peer.PresharedKey == nil {
+		return peer, nil
+	}
+
+	sealed, err := storage.secrets.seal(*peer.PresharedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealedPeer := *peer
+	sealedPeer.PresharedKey = &sealed
+	return &sealedPeer, nil
+}
+
+// openPeer decrypts secrets of the peer read from the database.
+// Secrets which can't be decrypted (e.g the key has been changed) are dropped.
+func (storage *Storage) openPeer(peer *types.PeerInfo) {
+	if peer.PresharedKey == nil {
+		return
+	}
+
+	plain, err := storage.secrets.open(*peer.PresharedKey)
+	if err != nil {
+		zap.L().Error("dropping undecryptable peer preshared key", zap.Int64("id", peer.ID), zap.Error(err))
+		peer.PresharedKey = nil
+		return
+	}
+	peer.PresharedKey = &plain
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestSecretBox(t *testing.T) {
+	box, err := newSecretBox(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	other, err := newSecretBox(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+
+	cases := []string{
+		"",
+		"short",
+		"yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=",
+	}
+
+	for _, plain := range cases {
+		sealed, err := box.seal(plain)
+		require.NoError(t, err, "plain: %q", plain)
+		if len(plain) > 0 {
+			require.NotContains(t, sealed, plain, "the secret must be encrypted")
+		}
+
+		again, err := box.seal(plain)
+		require.NoError(t, err)
+		require.NotEqual(t, sealed, again, "the nonce must be random")
+
+		opened, err := box.open(sealed)
+		require.NoError(t, err, "plain: %q", plain)
+		require.Equal(t, plain, opened)
+
+		_, err = other.open(sealed)
+		require.Error(t, err, "must not be opened with another key")
+	}
+}
+
+func TestSecretBoxOpenInvalid(t *testing.T) {
+	box, err := newSecretBox(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+
+	cases := []string{
+		"not base64!",
+		"AAAA",
+		"AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+	}
+
+	for _, sealed := range cases {
+		_, err := box.open(sealed)
+		require.Error(t, err, "sealed: %q", sealed)
+	}
+}
+
+func TestSealPeer(t *testing.T) {
+	box, err := newSecretBox(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	storage := &Storage{secrets: box}
+
+	psk := "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk="
+	peer := &types.PeerInfo{ID: 1, WireguardInfo: types.WireguardInfo{PresharedKey: &psk}}
+
+	sealed, err := storage.sealPeer(peer)
+	require.NoError(t, err)
+	require.Equal(t, psk, *peer.PresharedKey, "the original peer must be kept intact")
+	require.NotEqual(t, psk, *sealed.PresharedKey)
+
+	storage.openPeer(sealed)
+	require.Equal(t, psk, *sealed.PresharedKey)
+
+	// the key has been changed
+	sealed, err = storage.sealPeer(peer)
+	require.NoError(t, err)
+	storage.secrets, err = newSecretBox(bytes.Repeat([]byte{2}, 32))
+	require.NoError(t, err)
+	storage.openPeer(sealed)
+	require.Nil(t, sealed.PresharedKey, "undecryptable key must be dropped")
+
+	// no secrets to seal
+	empty := &types.PeerInfo{ID: 2}
+	sealed, err = storage.sealPeer(empty)
+	require.NoError(t, err)
+	require.Nil(t, sealed.PresharedKey)
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/types"
+	"go.uber.org/zap"
+)
+
+// addPeerTrafficQuery accounts the traffic of the peer in the history buckets of every resolution,
+// see peerTrafficArgs for the arguments.
+const addPeerTrafficQuery = `
+	INSERT INTO
+		peer_traffic(peer_id, resolution, bucket, upstream, downstream)
+	VALUES (?, ?, ?, ?, ?), (?, ?, ?, ?, ?), (?, ?, ?, ?, ?)
+	ON CONFLICT(peer_id, resolution, bucket) DO UPDATE SET
+		upstream = upstream + excluded.upstream,
+		downstream = downstream + excluded.downstream
+`
+
+func peerTrafficArgs(peerId int64, at time.Time, upstream int64, downstream int64) []interface{} {
+	args := make([]interface{}, 0, 5*len(types.TrafficResolutions))
+	for _, resolution := range types.TrafficResolutions {
+		size := resolution.Seconds()
+		bucket := at.Unix() / size * size
+		args = append(args, peerId, size, bucket, upstream, downstream)
+	}
+	return args
+}
+
+// GetPeerTraffic returns the traffic history of the peer within [from, to)
+// aggregated by the given step from the buckets of the given resolution.
+// Buckets without traffic are omitted, the points are aligned to the step.
+func (storage *Storage) GetPeerTraffic(peerId int64, resolution types.TrafficResolution, from time.Time, to time.Time, step time.Duration) ([]types.TrafficPoint, error) {
+	stepSeconds := int64(step / time.Second)
+
+	query := `
+		SELECT
+			bucket / $1 * $1 AS point,
+			sum(upstream),
+			sum(downstream)
+		FROM
+			peer_traffic
+		WHERE
+			peer_id = $2
+			AND resolution = $3
+			AND bucket >= $4
+			AND bucket < $5
+		GROUP BY point
+		ORDER BY point
+	`
+	rows, err := storage.db.Query(query, stepSeconds, peerId, resolution.Seconds(), from.Unix(), to.Unix())
+	if err != nil {
+		return nil, xerror.EStorageError("can't read peer traffic history", err, zap.Int64("id", peerId))
+	}
+	defer rows.Close()
+
+	points := []types.TrafficPoint{}
+	for rows.Next() {
+		var point int64
+		var p types.TrafficPoint
+		if err := rows.Scan(&point, &p.Upstream, &p.Downstream); err != nil {
+			return nil, xerror.EStorageError("can't scan peer traffic history", err, zap.Int64("id", peerId))
+		}
+		p.Time = time.Unix(point, 0).UTC()
+		points = append(points, p)
+	}
+
+	return points, nil
+}
+
+// PurgePeerTraffic removes the history buckets of the given resolution older than the given moment
+func (storage *Storage) PurgePeerTraffic(resolution types.TrafficResolution, before time.Time) (int64, error) {
+	res, err := storage.db.Exec("DELETE FROM peer_traffic WHERE resolution = $1 AND bucket < $2", resolution.Seconds(), before.Unix())
+	if err != nil {
+		return 0, xerror.EStorageError("can't purge peer traffic history", err)
+	}
+
+	n, _ := res.RowsAffected()
+	return n, nil
+}
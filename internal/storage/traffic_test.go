@@ -0,0 +1,96 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/tunnel/internal/types"
+)
+
+func TestPeerTraffic(t *testing.T) {
+	storage := newTestStorage(t)
+
+	day := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	samples := []struct {
+		at         time.Time
+		upstream   int64
+		downstream int64
+	}{
+		{day.Add(1 * time.Minute), 10, 1},
+		{day.Add(4 * time.Minute), 20, 2},
+		{day.Add(61 * time.Minute), 30, 3},
+		{day.Add(25 * time.Hour), 40, 4},
+	}
+	for _, s := range samples {
+		_, err := storage.db.Exec(addPeerTrafficQuery, peerTrafficArgs(1, s.at, s.upstream, s.downstream)...)
+		require.NoError(t, err)
+	}
+	// the traffic of another peer must not be counted
+	_, err := storage.db.Exec(addPeerTrafficQuery, peerTrafficArgs(2, day, 1000, 1000)...)
+	require.NoError(t, err)
+
+	point := func(d time.Duration, upstream int64, downstream int64) types.TrafficPoint {
+		return types.TrafficPoint{Time: day.Add(d), Upstream: upstream, Downstream: downstream}
+	}
+	cases := []struct {
+		resolution types.TrafficResolution
+		from       time.Time
+		to         time.Time
+		step       time.Duration
+		want       []types.TrafficPoint
+	}{
+		{
+			resolution: types.TrafficResolution5m, from: day, to: day.Add(2 * time.Hour), step: 5 * time.Minute,
+			want: []types.TrafficPoint{point(0, 30, 3), point(60*time.Minute, 30, 3)},
+		},
+		{
+			resolution: types.TrafficResolution5m, from: day, to: day.Add(2 * time.Hour), step: 15 * time.Minute,
+			want: []types.TrafficPoint{point(0, 30, 3), point(60*time.Minute, 30, 3)},
+		},
+		{
+			resolution: types.TrafficResolutionHourly, from: day, to: day.Add(48 * time.Hour), step: time.Hour,
+			want: []types.TrafficPoint{point(0, 30, 3), point(time.Hour, 30, 3), point(25*time.Hour, 40, 4)},
+		},
+		{
+			resolution: types.TrafficResolutionDaily, from: day, to: day.Add(48 * time.Hour), step: 24 * time.Hour,
+			want: []types.TrafficPoint{point(0, 60, 6), point(24*time.Hour, 40, 4)},
+		},
+		{
+			resolution: types.TrafficResolutionHourly, from: day.Add(time.Hour), to: day.Add(2 * time.Hour), step: time.Hour,
+			want: []types.TrafficPoint{point(time.Hour, 30, 3)},
+		},
+		{
+			// nothing before from is counted, even within the first point
+			resolution: types.TrafficResolution5m, from: day.Add(5 * time.Minute), to: day.Add(2 * time.Hour), step: time.Hour,
+			want: []types.TrafficPoint{point(time.Hour, 30, 3)},
+		},
+		{
+			resolution: types.TrafficResolutionHourly, from: day.Add(72 * time.Hour), to: day.Add(96 * time.Hour), step: time.Hour,
+			want: []types.TrafficPoint{},
+		},
+	}
+
+	for _, cc := range cases {
+		points, err := storage.GetPeerTraffic(1, cc.resolution, cc.from, cc.to, cc.step)
+		require.NoError(t, err)
+		require.Equal(t, cc.want, points, "from: %s, to: %s, step: %s", cc.from, cc.to, cc.step)
+	}
+
+	// purging the finest resolution keeps the coarser ones
+	n, err := storage.PurgePeerTraffic(types.TrafficResolution5m, day.Add(48*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 4, n)
+
+	points, err := storage.GetPeerTraffic(1, types.TrafficResolution5m, day, day.Add(48*time.Hour), 5*time.Minute)
+	require.NoError(t, err)
+	require.Empty(t, points)
+
+	points, err = storage.GetPeerTraffic(1, types.TrafficResolutionHourly, day, day.Add(48*time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+}
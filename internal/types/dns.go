@@ -0,0 +1,41 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"net"
+	"strings"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+)
+
+// splitDNS splits the comma-separated list of DNS servers, nil if not set
+func splitDNS(dns *string) []string {
+	if dns == nil || len(*dns) == 0 {
+		return nil
+	}
+
+	servers := strings.Split(*dns, ",")
+	for i := range servers {
+		servers[i] = strings.TrimSpace(servers[i])
+	}
+	return servers
+}
+
+// validateDNS checks the DNS servers the same way as the ipv4list
+// validator does for the global wireguard settings.
+func validateDNS(dns *string) error {
+	for _, server := range splitDNS(dns) {
+		if ip := net.ParseIP(server); ip == nil || ip.To4() == nil {
+			return xerror.EInvalidField("invalid DNS server address "+server, "dns", nil)
+		}
+	}
+	return nil
+}
+
+// DNSServers returns the list of DNS servers of the peer, nil if not set
+func (peer *PeerInfo) DNSServers() []string {
+	return splitDNS(peer.DNS)
+}
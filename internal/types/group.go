@@ -0,0 +1,134 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+)
+
+// PeerGroup carries the default policies for its member peers.
+// Peers inherit the policies of the group unless they override them.
+type PeerGroup struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+
+	NetworkAccessPolicy *int `db:"net_access_policy"`
+	RateLimit           *int `db:"net_rate_limit"`
+	// Comma-separated list of DNS servers to announce to clients
+	DNS *string `db:"dns"`
+
+	QuotaBytes  *int64       `db:"quota_bytes"`
+	QuotaPeriod *QuotaPeriod `db:"quota_period"`
+	// Peers expire in the given number of seconds since their creation
+	ExpireSeconds *int64 `db:"expire_seconds"`
+
+	Created *xtime.Time `db:"created"`
+	Updated *xtime.Time `db:"updated"`
+}
+
+func (g *PeerGroup) Validate(omit ...string) error {
+	if g == nil {
+		return xerror.EInvalidArgument("empty peer group", nil)
+	}
+
+	if !in("ID", omit) && g.ID == 0 {
+		return xerror.EInvalidArgument("empty peer group id", nil)
+	}
+
+	if len(g.Name) == 0 {
+		return xerror.EInvalidField("group name is required", "name", nil)
+	}
+
+	if err := validateDNS(g.DNS); err != nil {
+		return err
+	}
+
+	if g.QuotaBytes != nil && *g.QuotaBytes < 0 {
+		return xerror.EInvalidField("quota must not be negative", "quota_bytes", nil)
+	}
+
+	if g.QuotaPeriod != nil {
+		if err := g.QuotaPeriod.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if g.ExpireSeconds != nil && *g.ExpireSeconds <= 0 {
+		return xerror.EInvalidField("expiration period must be positive", "expire_seconds", nil)
+	}
+
+	return nil
+}
+
+// DNSServers returns the list of DNS servers of the group, nil if not set
+func (g *PeerGroup) DNSServers() []string {
+	return splitDNS(g.DNS)
+}
+
+// Inherit applies the policies of the group to the peer unless they are overridden.
+// The previous group is the one the peer has inherited its policies from, if any:
+// the peer's values equal to the previous ones are considered inherited,
+// so they follow the group changes.
+func (g *PeerGroup) Inherit(peer *PeerInfo, previous *PeerGroup) {
+	if previous == nil {
+		previous = &PeerGroup{}
+	}
+
+	inherit(&peer.NetworkAccessPolicy, g.NetworkAccessPolicy, previous.NetworkAccessPolicy)
+	inherit(&peer.RateLimit, g.RateLimit, previous.RateLimit)
+	inherit(&peer.QuotaBytes, g.QuotaBytes, previous.QuotaBytes)
+	inherit(&peer.QuotaPeriod, g.QuotaPeriod, previous.QuotaPeriod)
+
+	g.inheritExpires(peer, previous)
+}
+
+func (g *PeerGroup) inheritExpires(peer *PeerInfo, previous *PeerGroup) {
+	created := time.Now()
+	if peer.Created != nil {
+		created = peer.Created.Time
+	}
+
+	if peer.Expires != nil {
+		prev := previous.expires(created)
+		// the creation time is set by the storage a moment later,
+		// and the timestamps are stored with the second precision.
+		if prev == nil || prev.Sub(peer.Expires.Time).Abs() > time.Second {
+			// overridden by the peer
+			return
+		}
+	}
+
+	if expires := g.expires(created); expires != nil {
+		peer.Expires = &xtime.Time{Time: *expires}
+	} else {
+		peer.Expires = nil
+	}
+}
+
+func (g *PeerGroup) expires(created time.Time) *time.Time {
+	if g.ExpireSeconds == nil {
+		return nil
+	}
+	expires := created.Add(time.Duration(*g.ExpireSeconds) * time.Second)
+	return &expires
+}
+
+func inherit[T comparable](value **T, group *T, previous *T) {
+	if *value != nil && (previous == nil || **value != *previous) {
+		// overridden by the peer
+		return
+	}
+
+	if group == nil {
+		*value = nil
+		return
+	}
+
+	v := *group
+	*value = &v
+}
@@ -0,0 +1,105 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xtime"
+)
+
+func TestPeerGroupInherit(t *testing.T) {
+	intp := func(v int) *int { return &v }
+	int64p := func(v int64) *int64 { return &v }
+	created := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *xtime.Time { return &xtime.Time{Time: created.Add(d)} }
+
+	cases := []struct {
+		name     string
+		peer     PeerInfo
+		group    PeerGroup
+		previous *PeerGroup
+		want     PeerInfo
+	}{
+		{
+			name:  "empty peer joins the group",
+			peer:  PeerInfo{},
+			group: PeerGroup{RateLimit: intp(100), QuotaBytes: int64p(1000), ExpireSeconds: int64p(60)},
+			want:  PeerInfo{RateLimit: intp(100), QuotaBytes: int64p(1000), Expires: at(time.Minute)},
+		},
+		{
+			name:  "peer overrides the group",
+			peer:  PeerInfo{RateLimit: intp(5), Expires: at(time.Hour)},
+			group: PeerGroup{RateLimit: intp(100), ExpireSeconds: int64p(60)},
+			want:  PeerInfo{RateLimit: intp(5), Expires: at(time.Hour)},
+		},
+		{
+			name:     "inherited values follow the group",
+			peer:     PeerInfo{RateLimit: intp(100), NetworkAccessPolicy: intp(1), Expires: at(time.Minute)},
+			group:    PeerGroup{RateLimit: intp(200), NetworkAccessPolicy: intp(2), ExpireSeconds: int64p(120)},
+			previous: &PeerGroup{RateLimit: intp(100), NetworkAccessPolicy: intp(1), ExpireSeconds: int64p(60)},
+			want:     PeerInfo{RateLimit: intp(200), NetworkAccessPolicy: intp(2), Expires: at(2 * time.Minute)},
+		},
+		{
+			name:     "overridden values survive the group change",
+			peer:     PeerInfo{RateLimit: intp(5), Expires: at(time.Hour)},
+			group:    PeerGroup{RateLimit: intp(200), ExpireSeconds: int64p(120)},
+			previous: &PeerGroup{RateLimit: intp(100), ExpireSeconds: int64p(60)},
+			want:     PeerInfo{RateLimit: intp(5), Expires: at(time.Hour)},
+		},
+		{
+			name:     "inherited values are dropped with the group",
+			peer:     PeerInfo{RateLimit: intp(100), QuotaBytes: int64p(1000), Expires: at(time.Minute)},
+			group:    PeerGroup{},
+			previous: &PeerGroup{RateLimit: intp(100), QuotaBytes: int64p(1000), ExpireSeconds: int64p(60)},
+			want:     PeerInfo{},
+		},
+		{
+			name:     "expiration within the storage precision is inherited",
+			peer:     PeerInfo{Expires: at(time.Minute + 500*time.Millisecond)},
+			group:    PeerGroup{ExpireSeconds: int64p(120)},
+			previous: &PeerGroup{ExpireSeconds: int64p(60)},
+			want:     PeerInfo{Expires: at(2 * time.Minute)},
+		},
+	}
+
+	for _, cc := range cases {
+		cc.peer.Created = at(0)
+		cc.want.Created = at(0)
+		cc.group.Inherit(&cc.peer, cc.previous)
+		require.Equal(t, cc.want, cc.peer, cc.name)
+	}
+}
+
+func TestPeerGroupValidate(t *testing.T) {
+	int64p := func(v int64) *int64 { return &v }
+	period := func(p QuotaPeriod) *QuotaPeriod { return &p }
+	dns := func(s string) *string { return &s }
+
+	cases := []struct {
+		group PeerGroup
+		ok    bool
+	}{
+		{PeerGroup{Name: "staff"}, true},
+		{PeerGroup{Name: "staff", QuotaBytes: int64p(0), QuotaPeriod: period(QuotaPeriodDaily), ExpireSeconds: int64p(60)}, true},
+		{PeerGroup{Name: "staff", DNS: dns("1.1.1.1, 8.8.8.8")}, true},
+		{PeerGroup{}, false},
+		{PeerGroup{Name: "staff", QuotaBytes: int64p(-1)}, false},
+		{PeerGroup{Name: "staff", QuotaPeriod: period("yearly")}, false},
+		{PeerGroup{Name: "staff", ExpireSeconds: int64p(0)}, false},
+		{PeerGroup{Name: "staff", DNS: dns("not an address")}, false},
+	}
+
+	for _, cc := range cases {
+		err := cc.group.Validate("ID")
+		if cc.ok {
+			require.NoError(t, err, "group: %+v", cc.group)
+		} else {
+			require.Error(t, err, "group: %+v", cc.group)
+		}
+	}
+}
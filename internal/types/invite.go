@@ -0,0 +1,122 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xnet"
+	"github.com/vpnhouse/common-lib-go/xtime"
+)
+
+// inviteCodeRe requires the codes long enough not to be guessed
+var inviteCodeRe = regexp.MustCompile(`^[A-Za-z0-9_-]{10,64}$`)
+
+// InviteRedemption records the peer created by the invite,
+// the record is kept when the peer expires or gets removed.
+type InviteRedemption struct {
+	ID                 int64       `db:"id"`
+	InviteId           int64       `db:"invite_id"`
+	PeerId             int64       `db:"peer_id"`
+	WireguardPublicKey *string     `db:"wireguard_key"`
+	Ipv4               *xnet.IP    `db:"ipv4"`
+	Created            *xtime.Time `db:"created"`
+}
+
+// Invite lets the guest devices enroll themselves by the code, e.g on events and workshops.
+// Unlike the shared link, every redemption creates its own peer with the policies of the invite.
+type Invite struct {
+	ID    int64   `db:"id"`
+	Code  string  `db:"code"`
+	Label *string `db:"label"`
+
+	// The invite may be redeemed the given number of times, unlimited if not set
+	MaxRedemptions *int `db:"max_redemptions"`
+	Redemptions    int  `db:"redemptions"`
+	// The invite can't be redeemed after the expiration
+	Expires *xtime.Time `db:"expires"`
+
+	// Policies of the peers created by the invite
+	NetworkAccessPolicy *int         `db:"net_access_policy"`
+	RateLimit           *int         `db:"net_rate_limit"`
+	QuotaBytes          *int64       `db:"quota_bytes"`
+	QuotaPeriod         *QuotaPeriod `db:"quota_period"`
+	// Peers expire in the given number of seconds since the redemption
+	PeerExpireSeconds *int64 `db:"peer_expire_seconds"`
+
+	Created *xtime.Time `db:"created"`
+}
+
+func (inv *Invite) Validate(omit ...string) error {
+	if inv == nil {
+		return xerror.EInvalidArgument("empty invite", nil)
+	}
+
+	if !in("ID", omit) && inv.ID == 0 {
+		return xerror.EInvalidArgument("empty invite id", nil)
+	}
+
+	if !inviteCodeRe.MatchString(inv.Code) {
+		return xerror.EInvalidField("invite code must be 10 to 64 letters, digits, dashes or underscores", "code", nil)
+	}
+
+	if inv.MaxRedemptions != nil && *inv.MaxRedemptions <= 0 {
+		return xerror.EInvalidField("redemptions limit must be positive", "max_redemptions", nil)
+	}
+
+	if inv.QuotaBytes != nil && *inv.QuotaBytes < 0 {
+		return xerror.EInvalidField("quota must not be negative", "quota_bytes", nil)
+	}
+
+	if inv.QuotaPeriod != nil {
+		if err := inv.QuotaPeriod.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if inv.PeerExpireSeconds != nil && *inv.PeerExpireSeconds <= 0 {
+		return xerror.EInvalidField("expiration period must be positive", "peer_expire_seconds", nil)
+	}
+
+	return nil
+}
+
+// ErrInviteUsedUp is returned on the redemption of the invite redeemed the maximum number of times
+var ErrInviteUsedUp = xerror.EForbidden("the invite has been redeemed the maximum number of times")
+
+// UsedUp reports whether the invite has been redeemed the maximum number of times
+func (inv *Invite) UsedUp() bool {
+	return inv.MaxRedemptions != nil && inv.Redemptions >= *inv.MaxRedemptions
+}
+
+// Expired reports whether the invite can't be redeemed anymore by the time
+func (inv *Invite) Expired(now time.Time) bool {
+	return inv.Expires != nil && inv.Expires.Time.Before(now)
+}
+
+// NewPeer prepares the peer of the device redeeming the invite
+func (inv *Invite) NewPeer(publicKey string, now time.Time) PeerInfo {
+	id := inv.ID
+	peer := PeerInfo{
+		Label:               inv.Label,
+		InviteId:            &id,
+		NetworkAccessPolicy: inv.NetworkAccessPolicy,
+		RateLimit:           inv.RateLimit,
+		QuotaBytes:          inv.QuotaBytes,
+		QuotaPeriod:         inv.QuotaPeriod,
+		WireguardInfo: WireguardInfo{
+			WireguardPublicKey: &publicKey,
+		},
+	}
+
+	if inv.PeerExpireSeconds != nil {
+		expires := xtime.Time{Time: now.Add(time.Duration(*inv.PeerExpireSeconds) * time.Second)}
+		peer.Expires = &expires
+	}
+
+	return peer
+}
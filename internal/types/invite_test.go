@@ -0,0 +1,66 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInviteValidate(t *testing.T) {
+	intp := func(v int) *int { return &v }
+	int64p := func(v int64) *int64 { return &v }
+	period := func(p QuotaPeriod) *QuotaPeriod { return &p }
+
+	cases := []struct {
+		invite Invite
+		ok     bool
+	}{
+		{Invite{Code: "WORKSHOP-2021"}, true},
+		{Invite{Code: "ABCDEFGHJK", MaxRedemptions: intp(50), QuotaBytes: int64p(0), QuotaPeriod: period(QuotaPeriodDaily), PeerExpireSeconds: int64p(3600)}, true},
+		{Invite{Code: "ABCDEFGHJ"}, false},
+		{Invite{Code: "WORKSHOP 2021"}, false},
+		{Invite{Code: ""}, false},
+		{Invite{Code: "WORKSHOP-2021", MaxRedemptions: intp(0)}, false},
+		{Invite{Code: "WORKSHOP-2021", QuotaBytes: int64p(-1)}, false},
+		{Invite{Code: "WORKSHOP-2021", QuotaPeriod: period("yearly")}, false},
+		{Invite{Code: "WORKSHOP-2021", PeerExpireSeconds: int64p(0)}, false},
+	}
+
+	for _, cc := range cases {
+		err := cc.invite.Validate("ID")
+		if cc.ok {
+			require.NoError(t, err, "invite: %+v", cc.invite)
+		} else {
+			require.Error(t, err, "invite: %+v", cc.invite)
+		}
+	}
+}
+
+func TestInviteNewPeer(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	label := "workshop"
+	policy := 2
+	expireSeconds := int64(3600)
+
+	cases := []struct {
+		invite  Invite
+		expires *time.Time
+	}{
+		{invite: Invite{ID: 1, Label: &label}},
+		{invite: Invite{ID: 2, NetworkAccessPolicy: &policy, PeerExpireSeconds: &expireSeconds}, expires: func() *time.Time { t := now.Add(time.Hour); return &t }()},
+	}
+
+	for _, cc := range cases {
+		peer := cc.invite.NewPeer("public key", now)
+		require.Equal(t, cc.invite.ID, *peer.InviteId)
+		require.Equal(t, "public key", *peer.WireguardPublicKey)
+		require.Equal(t, cc.invite.Label, peer.Label)
+		require.Equal(t, cc.invite.NetworkAccessPolicy, peer.NetworkAccessPolicy)
+		require.Equal(t, cc.expires, peer.Expires.TimePtr(), "invite: %d", cc.invite.ID)
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"github.com/google/uuid"
+	"github.com/vpnhouse/common-lib-go/xtime"
+)
+
+// IPLease records the IP address assigned to the peer for a period of time,
+// the leases outlive peers to answer who used the address at the given moment.
+type IPLease struct {
+	ID             int64       `db:"id"`
+	IP             string      `db:"ip"`
+	PeerId         int64       `db:"peer_id"`
+	UserId         *string     `db:"user_id"`
+	InstallationId *uuid.UUID  `db:"installation_id"`
+	WireguardKey   *string     `db:"wireguard_key"`
+	Started        *xtime.Time `db:"started"`
+	// nil while the lease is active
+	Ended *xtime.Time `db:"ended"`
+}
@@ -0,0 +1,19 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import "github.com/vpnhouse/common-lib-go/xtime"
+
+// PeerEndpoint records the wireguard endpoint the peer has connected from
+type PeerEndpoint struct {
+	ID       int64   `db:"id"`
+	PeerId   int64   `db:"peer_id"`
+	UserId   *string `db:"user_id"`
+	Endpoint string  `db:"endpoint"`
+	// Country of the endpoint by geoip, empty if unknown
+	Country string `db:"country"`
+	// When the peer has switched to the endpoint
+	Seen *xtime.Time `db:"seen"`
+}
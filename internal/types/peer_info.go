@@ -19,6 +19,11 @@ import (
 
 type WireguardInfo struct {
 	WireguardPublicKey *string `db:"wireguard_key"`
+	// Name of the wireguard interface the peer belongs to,
+	// nil means the primary one.
+	WireguardInterface *string `db:"wireguard_interface"`
+	// Optional preshared key, encrypted in the storage
+	PresharedKey *string `db:"preshared_key" json:"-"`
 }
 
 type PeerIdentifiers struct {
@@ -34,20 +39,49 @@ type PeerInfo struct {
 	ID      int64       `db:"id"`
 	Label   *string     `db:"label"`
 	Ipv4    *xnet.IP    `db:"ipv4" json:"-"`
+	Ipv6    *xnet.IP    `db:"ipv6" json:"-"`
 	Created *xtime.Time `db:"created"`
 	Updated *xtime.Time `db:"updated"`
 	Expires *xtime.Time `db:"expires"`
 	Claims  *string     `db:"claims"`
 
+	// Shared peers get their key on the activation via the link, see Activate
 	SharingKey           *string `db:"sharing_key"`
 	SharingKeyExpiration *int64  `db:"sharing_key_expiration"`
+	// How many times the link has been activated, and may be activated at most
+	SharingActivations    *int `db:"sharing_activations"`
+	SharingMaxActivations *int `db:"sharing_max_activations"`
+	// Invite the peer has been created by, see Invite
+	InviteId *int64 `db:"invite_id"`
+
+	// Group the peer inherits its policies from, see PeerGroup
+	GroupId *int64 `db:"group_id"`
 
 	NetworkAccessPolicy *int `db:"net_access_policy"`
 	RateLimit           *int `db:"net_rate_limit"`
+	// Networks the client routes through the tunnel, overrides the configured ones
+	Routes *ClientRoutes `db:"routes"`
+	// Comma-separated list of networks behind the peer, e.g a branch office LAN,
+	// routed through the peer by the server.
+	RoutedSubnets *string `db:"routed_subnets"`
+	// Comma-separated list of DNS servers to announce to the client,
+	// overrides the ones of the group and the interface settings.
+	DNS *string `db:"dns"`
 
 	Upstream   *int64      `db:"upstream"`
 	Downstream *int64      `db:"downstream"`
 	Activity   *xtime.Time `db:"activity"`
+	// Last wireguard handshake and the endpoint the peer connects from
+	Handshake *xtime.Time `db:"handshake"`
+	Endpoint  *string     `db:"endpoint"`
+	// Time the shared peer has been activated by the device
+	Activated *xtime.Time `db:"activated"`
+
+	// Traffic quota, the usage is counted within the current quota period
+	QuotaBytes  *int64       `db:"quota_bytes"`
+	QuotaPeriod *QuotaPeriod `db:"quota_period"`
+	QuotaUsed   *int64       `db:"quota_used"`
+	QuotaReset  *xtime.Time  `db:"quota_reset"`
 }
 
 func (peer *PeerInfo) GetNetworkPolicy() ipam.Policy {
@@ -102,6 +136,9 @@ func (peer *PeerInfo) IntoProto() *proto.PeerInfo {
 	if peer.Activity != nil {
 		p.Activity = proto.TimestampFromTime(peer.Activity.Time)
 	}
+	if peer.Endpoint != nil {
+		p.Endpoint = *peer.Endpoint
+	}
 
 	return p
 }
@@ -117,6 +154,36 @@ func in(f string, fields []string) bool {
 	return false
 }
 
+// PeerOnlineTimeout is the handshake age the peer is considered offline after.
+// Wireguard re-handshakes every 2 minutes while there is any traffic,
+// the keepalive makes the traffic on the idle tunnel.
+const PeerOnlineTimeout = 3 * time.Minute
+
+// Online reports whether the peer has made the handshake recently
+func (peer *PeerInfo) Online(now time.Time) bool {
+	return peer.Handshake != nil && now.Sub(peer.Handshake.Time) < PeerOnlineTimeout
+}
+
+// Idle reports whether the peer has shown no sign of life for the given period:
+// the latest of the stored handshake, the given one reported by the interface,
+// the traffic activity and the activation of the shared peer is counted.
+// The peers never connected are counted since their creation.
+func (peer *PeerInfo) Idle(now time.Time, period time.Duration, handshake time.Time) bool {
+	since := handshake
+	for _, t := range []*xtime.Time{peer.Handshake, peer.Activity, peer.Activated} {
+		if t != nil && t.Time.After(since) {
+			since = t.Time
+		}
+	}
+	if since.IsZero() {
+		if peer.Created == nil {
+			return false
+		}
+		since = peer.Created.Time
+	}
+	return now.Sub(since) > period
+}
+
 func (peer *PeerInfo) Expired() bool {
 	if peer.Expires == nil {
 		return false
@@ -146,6 +213,39 @@ func (peer *PeerInfo) Validate(omit ...string) error {
 		}
 	}
 
+	// IPv6 address is optional: dual-stack addressing may be disabled
+	if !in("Ipv6", omit) && peer.Ipv6 != nil && peer.Ipv6.IP != nil {
+		if peer.Ipv6.Isv4() {
+			return xerror.EInvalidField("ipv6 format is invalid", "ipv6", nil)
+		}
+	}
+
+	if peer.QuotaBytes != nil && *peer.QuotaBytes < 0 {
+		return xerror.EInvalidField("quota must not be negative", "quota_bytes", nil)
+	}
+
+	if peer.QuotaPeriod != nil {
+		if err := peer.QuotaPeriod.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if peer.Routes != nil && len(*peer.Routes) > 0 {
+		if err := peer.Routes.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if peer.RoutedSubnets != nil {
+		if _, err := ParseSubnets(*peer.RoutedSubnets); err != nil {
+			return err
+		}
+	}
+
+	if err := validateDNS(peer.DNS); err != nil {
+		return err
+	}
+
 	if peer.WireguardPublicKey == nil && (peer.SharingKey == nil || len(*peer.SharingKey) == 0) {
 		return xerror.EInvalidField("peer must have public key set", "wireguard_key", nil)
 	}
@@ -157,5 +257,11 @@ func (peer *PeerInfo) Validate(omit ...string) error {
 		}
 	}
 
+	if peer.PresharedKey != nil && len(*peer.PresharedKey) > 0 {
+		if _, err := wgtypes.ParseKey(*peer.PresharedKey); err != nil {
+			return xerror.EInvalidField("invalid preshared key given to a peer", "preshared_key", err)
+		}
+	}
+
 	return nil
 }
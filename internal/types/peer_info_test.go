@@ -0,0 +1,75 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xtime"
+)
+
+func TestPeerIdle(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	ago := func(d time.Duration) *xtime.Time { return &xtime.Time{Time: now.Add(-d)} }
+	period := 24 * time.Hour
+
+	cases := []struct {
+		name      string
+		peer      PeerInfo
+		handshake time.Time
+		idle      bool
+	}{
+		{
+			name: "no timestamps",
+			peer: PeerInfo{},
+		},
+		{
+			name: "recent handshake",
+			peer: PeerInfo{Created: ago(48 * time.Hour), Handshake: ago(time.Hour)},
+		},
+		{
+			name: "stale handshake",
+			peer: PeerInfo{Created: ago(48 * time.Hour), Handshake: ago(25 * time.Hour)},
+			idle: true,
+		},
+		{
+			name: "handshake at the period bound",
+			peer: PeerInfo{Created: ago(48 * time.Hour), Handshake: ago(period)},
+		},
+		{
+			name: "never connected, just created",
+			peer: PeerInfo{Created: ago(time.Hour)},
+		},
+		{
+			name: "never connected since long ago",
+			peer: PeerInfo{Created: ago(25 * time.Hour)},
+			idle: true,
+		},
+		{
+			name:      "stale stored handshake, fresh one on the interface",
+			peer:      PeerInfo{Created: ago(48 * time.Hour), Handshake: ago(25 * time.Hour)},
+			handshake: now.Add(-time.Minute),
+		},
+		{
+			name: "stale handshake, recent traffic",
+			peer: PeerInfo{Created: ago(48 * time.Hour), Handshake: ago(25 * time.Hour), Activity: ago(time.Hour)},
+		},
+		{
+			name: "shared link created long ago, activated recently",
+			peer: PeerInfo{Created: ago(48 * time.Hour), Activated: ago(time.Hour)},
+		},
+		{
+			name: "shared peer activated long ago",
+			peer: PeerInfo{Created: ago(48 * time.Hour), Activated: ago(25 * time.Hour)},
+			idle: true,
+		},
+	}
+
+	for _, cc := range cases {
+		require.Equal(t, cc.idle, cc.peer.Idle(now, period, cc.handshake), cc.name)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+// PeerLimit limits the number of peers of the user, the zero Max allows no peers
+type PeerLimit struct {
+	Max int
+	// Evict the least recently active peer instead of rejecting the new one
+	Evict bool
+}
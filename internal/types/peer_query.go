@@ -0,0 +1,83 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+)
+
+// PeerState filters peers by their expiration
+type PeerState string
+
+const (
+	PeerStateAny     PeerState = ""
+	PeerStateActive  PeerState = "active"
+	PeerStateExpired PeerState = "expired"
+)
+
+// Peer fields the peers list can be sorted by
+const (
+	PeerSortId         = "id"
+	PeerSortLabel      = "label"
+	PeerSortCreated    = "created"
+	PeerSortUpdated    = "updated"
+	PeerSortExpires    = "expires"
+	PeerSortActivity   = "activity"
+	PeerSortUpstream   = "upstream"
+	PeerSortDownstream = "downstream"
+)
+
+const PeerQueryMaxLimit = 1000
+
+// PeerQuery describes the page of the peers list
+type PeerQuery struct {
+	// Substring of the peer label or the user id
+	Search string
+	// IPv4 or IPv6 address of the peer
+	IP    string
+	State PeerState
+	// Last activity range, the upper bound is exclusive
+	ActivityFrom *time.Time
+	ActivityTo   *time.Time
+
+	Sort string
+	Desc bool
+	// Opaque position returned with the previous page, empty for the first page
+	Cursor string
+	// Page size, zero means the whole list
+	Limit int
+}
+
+func (q *PeerQuery) Validate() error {
+	switch q.State {
+	case PeerStateAny, PeerStateActive, PeerStateExpired:
+	default:
+		return xerror.EInvalidField("unknown peer state, want one of active or expired", "state", nil)
+	}
+
+	switch q.Sort {
+	case "", PeerSortId, PeerSortLabel, PeerSortCreated, PeerSortUpdated,
+		PeerSortExpires, PeerSortActivity, PeerSortUpstream, PeerSortDownstream:
+	default:
+		return xerror.EInvalidField("unknown sort field", "sort", nil)
+	}
+
+	if q.Limit < 0 || q.Limit > PeerQueryMaxLimit {
+		return xerror.EInvalidField("page size is out of range", "limit", nil)
+	}
+
+	return nil
+}
+
+// PeerPage is the result of PeerQuery
+type PeerPage struct {
+	Peers []*PeerInfo
+	// Number of peers matching the query regardless of the pagination
+	Total int64
+	// Cursor of the next page, empty if it's the last one
+	NextCursor string
+}
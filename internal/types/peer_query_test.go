@@ -0,0 +1,36 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerQueryValidate(t *testing.T) {
+	cases := []struct {
+		query PeerQuery
+		err   string
+	}{
+		{query: PeerQuery{}},
+		{query: PeerQuery{State: PeerStateActive, Sort: PeerSortActivity, Desc: true, Limit: 50}},
+		{query: PeerQuery{State: PeerStateExpired, Sort: PeerSortLabel, Limit: PeerQueryMaxLimit}},
+		{query: PeerQuery{State: "deleted"}, err: "peer state"},
+		{query: PeerQuery{Sort: "ipv4"}, err: "sort field"},
+		{query: PeerQuery{Limit: -1}, err: "page size"},
+		{query: PeerQuery{Limit: PeerQueryMaxLimit + 1}, err: "page size"},
+	}
+
+	for _, cc := range cases {
+		err := cc.query.Validate()
+		if len(cc.err) == 0 {
+			require.NoError(t, err, "query: %+v", cc.query)
+		} else {
+			require.Error(t, err, "query: %+v", cc.query)
+			require.Contains(t, err.Error(), cc.err, "query: %+v", cc.query)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+// PeerStatsUpdate is the change of the peer's runtime state found by the stats sync
+type PeerStatsUpdate struct {
+	Peer *PeerInfo
+	// Traffic since the previous sync, the counters, the activity and the quota usage
+	// of the peer are stored if any traffic has been seen.
+	Upstream   int64
+	Downstream int64
+	// Handshake is set if the last handshake or the endpoint of the peer has changed
+	Handshake bool
+}
+
+// HasTraffic reports whether the peer has sent or received anything since the previous sync
+func (u *PeerStatsUpdate) HasTraffic() bool {
+	return u.Upstream != 0 || u.Downstream != 0
+}
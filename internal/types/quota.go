@@ -0,0 +1,156 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+)
+
+// QuotaPeriod defines how often the traffic quota usage is reset
+type QuotaPeriod string
+
+const (
+	// QuotaPeriodNone means that the quota usage is never reset
+	QuotaPeriodNone    QuotaPeriod = ""
+	QuotaPeriodDaily   QuotaPeriod = "daily"
+	QuotaPeriodWeekly  QuotaPeriod = "weekly"
+	QuotaPeriodMonthly QuotaPeriod = "monthly"
+)
+
+func (p QuotaPeriod) Validate() error {
+	switch p {
+	case QuotaPeriodNone, QuotaPeriodDaily, QuotaPeriodWeekly, QuotaPeriodMonthly:
+		return nil
+	}
+	return xerror.EInvalidField("unknown quota period, want one of daily, weekly or monthly", "quota_period", nil)
+}
+
+// Next returns the time of the next quota reset after the given moment,
+// nil means that the quota is never reset.
+func (p QuotaPeriod) Next(from time.Time) *xtime.Time {
+	var next time.Time
+	switch p {
+	case QuotaPeriodDaily:
+		next = from.AddDate(0, 0, 1)
+	case QuotaPeriodWeekly:
+		next = from.AddDate(0, 0, 7)
+	case QuotaPeriodMonthly:
+		next = from.AddDate(0, 1, 0)
+	default:
+		return nil
+	}
+	return &xtime.Time{Time: next}
+}
+
+// UserQuota limits the traffic of all peers belonging to the user
+type UserQuota struct {
+	UserId      string      `db:"user_id"`
+	QuotaBytes  int64       `db:"quota_bytes"`
+	QuotaPeriod QuotaPeriod `db:"quota_period"`
+	QuotaUsed   int64       `db:"quota_used"`
+	QuotaReset  *xtime.Time `db:"quota_reset"`
+}
+
+func (q *UserQuota) Validate() error {
+	if q == nil {
+		return xerror.EInvalidArgument("empty user quota", nil)
+	}
+	if len(q.UserId) == 0 {
+		return xerror.EInvalidField("user id is required", "user_id", nil)
+	}
+	if q.QuotaBytes < 0 {
+		return xerror.EInvalidField("quota must not be negative", "quota_bytes", nil)
+	}
+	return q.QuotaPeriod.Validate()
+}
+
+func (q *UserQuota) Exceeded() bool {
+	return q.QuotaUsed >= q.QuotaBytes
+}
+
+func (q *UserQuota) Remaining() int64 {
+	return remaining(q.QuotaBytes, q.QuotaUsed)
+}
+
+// ResetDue reports whether the quota usage must be reset at the given moment
+func (q *UserQuota) ResetDue(now time.Time) bool {
+	return resetDue(q.QuotaPeriod, q.QuotaReset, now)
+}
+
+// Reset zeroes the quota usage and schedules the next reset
+func (q *UserQuota) Reset(now time.Time) {
+	q.QuotaUsed = 0
+	q.QuotaReset = q.QuotaPeriod.Next(now)
+}
+
+// HasQuota reports whether the traffic of the peer is limited
+func (peer *PeerInfo) HasQuota() bool {
+	return peer.QuotaBytes != nil
+}
+
+// QuotaExceeded reports whether the peer has used up its traffic quota
+func (peer *PeerInfo) QuotaExceeded() bool {
+	if !peer.HasQuota() {
+		return false
+	}
+	return peer.quotaUsed() >= *peer.QuotaBytes
+}
+
+// QuotaRemaining returns the traffic left for the peer,
+// nil means that the traffic is not limited.
+func (peer *PeerInfo) QuotaRemaining() *int64 {
+	if !peer.HasQuota() {
+		return nil
+	}
+	v := remaining(*peer.QuotaBytes, peer.quotaUsed())
+	return &v
+}
+
+// QuotaResetDue reports whether the quota usage must be reset at the given moment
+func (peer *PeerInfo) QuotaResetDue(now time.Time) bool {
+	if !peer.HasQuota() {
+		return false
+	}
+	return resetDue(peer.quotaPeriod(), peer.QuotaReset, now)
+}
+
+// ResetQuota zeroes the quota usage and schedules the next reset
+func (peer *PeerInfo) ResetQuota(now time.Time) {
+	var zeroVal int64
+	peer.QuotaUsed = &zeroVal
+	peer.QuotaReset = peer.quotaPeriod().Next(now)
+}
+
+func (peer *PeerInfo) quotaUsed() int64 {
+	if peer.QuotaUsed == nil {
+		return 0
+	}
+	return *peer.QuotaUsed
+}
+
+func (peer *PeerInfo) quotaPeriod() QuotaPeriod {
+	if peer.QuotaPeriod == nil {
+		return QuotaPeriodNone
+	}
+	return *peer.QuotaPeriod
+}
+
+func remaining(limit int64, used int64) int64 {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+func resetDue(period QuotaPeriod, reset *xtime.Time, now time.Time) bool {
+	if period == QuotaPeriodNone {
+		return false
+	}
+	// the reset time is not scheduled yet: the quota has just been set up
+	return reset == nil || !reset.Time.After(now)
+}
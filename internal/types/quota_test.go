@@ -0,0 +1,150 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vpnhouse/common-lib-go/xtime"
+)
+
+func TestPeerQuota(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	bytes := func(v int64) *int64 { return &v }
+	period := func(p QuotaPeriod) *QuotaPeriod { return &p }
+	at := func(t time.Time) *xtime.Time { return &xtime.Time{Time: t} }
+
+	cases := []struct {
+		name      string
+		peer      PeerInfo
+		exceeded  bool
+		remaining *int64
+		resetDue  bool
+	}{
+		{
+			name: "no quota",
+			peer: PeerInfo{QuotaUsed: bytes(100)},
+		},
+		{
+			name:      "under quota",
+			peer:      PeerInfo{QuotaBytes: bytes(100), QuotaUsed: bytes(40)},
+			remaining: bytes(60),
+		},
+		{
+			name:      "nothing used yet",
+			peer:      PeerInfo{QuotaBytes: bytes(100)},
+			remaining: bytes(100),
+		},
+		{
+			name:      "used up",
+			peer:      PeerInfo{QuotaBytes: bytes(100), QuotaUsed: bytes(100)},
+			exceeded:  true,
+			remaining: bytes(0),
+		},
+		{
+			name:      "overused",
+			peer:      PeerInfo{QuotaBytes: bytes(100), QuotaUsed: bytes(150)},
+			exceeded:  true,
+			remaining: bytes(0),
+		},
+		{
+			name:      "reset not scheduled yet",
+			peer:      PeerInfo{QuotaBytes: bytes(100), QuotaPeriod: period(QuotaPeriodDaily)},
+			remaining: bytes(100),
+			resetDue:  true,
+		},
+		{
+			name:      "reset in the future",
+			peer:      PeerInfo{QuotaBytes: bytes(100), QuotaUsed: bytes(100), QuotaPeriod: period(QuotaPeriodDaily), QuotaReset: at(now.Add(time.Hour))},
+			exceeded:  true,
+			remaining: bytes(0),
+		},
+		{
+			name:      "reset passed",
+			peer:      PeerInfo{QuotaBytes: bytes(100), QuotaUsed: bytes(100), QuotaPeriod: period(QuotaPeriodWeekly), QuotaReset: at(now.Add(-time.Hour))},
+			exceeded:  true,
+			remaining: bytes(0),
+			resetDue:  true,
+		},
+	}
+
+	for _, cc := range cases {
+		require.Equal(t, cc.exceeded, cc.peer.QuotaExceeded(), cc.name)
+		require.Equal(t, cc.remaining, cc.peer.QuotaRemaining(), cc.name)
+		require.Equal(t, cc.resetDue, cc.peer.QuotaResetDue(now), cc.name)
+
+		if cc.resetDue {
+			cc.peer.ResetQuota(now)
+			require.False(t, cc.peer.QuotaExceeded(), cc.name)
+			require.False(t, cc.peer.QuotaResetDue(now), cc.name)
+			require.Equal(t, cc.peer.QuotaPeriod.Next(now), cc.peer.QuotaReset, cc.name)
+		}
+	}
+}
+
+func TestUserQuota(t *testing.T) {
+	now := time.Date(2021, 10, 31, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name     string
+		quota    UserQuota
+		valid    bool
+		exceeded bool
+		resetDue bool
+		next     time.Time
+	}{
+		{
+			name:  "never reset",
+			quota: UserQuota{UserId: "user", QuotaBytes: 100, QuotaUsed: 10},
+			valid: true,
+		},
+		{
+			name:     "exceeded daily",
+			quota:    UserQuota{UserId: "user", QuotaBytes: 100, QuotaUsed: 100, QuotaPeriod: QuotaPeriodDaily},
+			valid:    true,
+			exceeded: true,
+			resetDue: true,
+			next:     now.AddDate(0, 0, 1),
+		},
+		{
+			name:     "monthly",
+			quota:    UserQuota{UserId: "user", QuotaBytes: 100, QuotaPeriod: QuotaPeriodMonthly, QuotaReset: &xtime.Time{Time: now}},
+			valid:    true,
+			resetDue: true,
+			next:     now.AddDate(0, 1, 0),
+		},
+		{
+			name:  "no user",
+			quota: UserQuota{QuotaBytes: 100},
+		},
+		{
+			name:  "negative quota",
+			quota: UserQuota{UserId: "user", QuotaBytes: -1},
+		},
+		{
+			name:  "unknown period",
+			quota: UserQuota{UserId: "user", QuotaBytes: 100, QuotaPeriod: "yearly"},
+		},
+	}
+
+	for _, cc := range cases {
+		err := cc.quota.Validate()
+		if cc.valid {
+			require.NoError(t, err, cc.name)
+		} else {
+			require.Error(t, err, cc.name)
+			continue
+		}
+
+		require.Equal(t, cc.exceeded, cc.quota.Exceeded(), cc.name)
+		require.Equal(t, cc.resetDue, cc.quota.ResetDue(now), cc.name)
+		if cc.resetDue {
+			cc.quota.Reset(now)
+			require.Zero(t, cc.quota.QuotaUsed, cc.name)
+			require.Equal(t, cc.next, cc.quota.QuotaReset.Time, cc.name)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"net"
+	"strings"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+)
+
+// ClientRoutes defines the traffic the client sends through the tunnel:
+// all of it, the private networks only, or a comma-separated list of CIDRs.
+type ClientRoutes string
+
+const (
+	// ClientRoutesFull routes all the traffic through the tunnel
+	ClientRoutesFull ClientRoutes = "full"
+	// ClientRoutesPrivate routes the private networks only, e.g the corporate intranet
+	ClientRoutesPrivate ClientRoutes = "private"
+)
+
+var (
+	fullRoutesIPv4    = []string{"0.0.0.0/0"}
+	fullRoutesIPv6    = []string{"::/0"}
+	privateRoutesIPv4 = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10"}
+	privateRoutesIPv6 = []string{"fc00::/7"}
+)
+
+func (r ClientRoutes) Validate() error {
+	switch r {
+	case ClientRoutesFull, ClientRoutesPrivate:
+		return nil
+	}
+
+	cidrs := r.cidrs()
+	if len(cidrs) == 0 {
+		return xerror.EInvalidField("routes must be full, private or a list of CIDRs", "routes", nil)
+	}
+	for _, cidr := range cidrs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return xerror.EInvalidField("invalid route "+cidr, "routes", err)
+		}
+	}
+	return nil
+}
+
+// AllowedIPs returns the networks the client routes through the tunnel,
+// ipv6 tells whether the client has the IPv6 tunnel address.
+func (r ClientRoutes) AllowedIPs(ipv6 bool) []string {
+	var v4, v6 []string
+	switch r {
+	case ClientRoutesFull, "":
+		v4, v6 = fullRoutesIPv4, fullRoutesIPv6
+	case ClientRoutesPrivate:
+		v4, v6 = privateRoutesIPv4, privateRoutesIPv6
+	default:
+		// the custom routes are returned as is
+		return r.cidrs()
+	}
+
+	allowed := append([]string{}, v4...)
+	if ipv6 {
+		allowed = append(allowed, v6...)
+	}
+	return allowed
+}
+
+func (r ClientRoutes) cidrs() []string {
+	var cidrs []string
+	for _, cidr := range strings.Split(string(r), ",") {
+		if cidr = strings.TrimSpace(cidr); len(cidr) > 0 {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
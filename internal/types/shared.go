@@ -0,0 +1,87 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"time"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/common-lib-go/xtime"
+)
+
+// DefaultSharingTTL is the lifetime of the shared peer link unless another is given
+const DefaultSharingTTL = 24 * time.Hour
+
+// Shared reports whether the peer has been created by the shared link
+func (peer *PeerInfo) Shared() bool {
+	return peer.SharingKey != nil && len(*peer.SharingKey) > 0
+}
+
+// Pending reports whether the shared peer waits for the activation:
+// it has its addresses reserved but no key to be set on the wireguard interface.
+func (peer *PeerInfo) Pending() bool {
+	return peer.WireguardPublicKey == nil && peer.Shared()
+}
+
+// SharingActivated reports whether the shared peer has been activated at least once
+func (peer *PeerInfo) SharingActivated() bool {
+	return peer.SharingActivations != nil && *peer.SharingActivations > 0
+}
+
+// SharingExpires returns the expiration time of the link of the shared peer, nil if the link never expires.
+// The activated peer outlives its link: the expired link only can't be activated anymore.
+func (peer *PeerInfo) SharingExpires() *time.Time {
+	if peer.SharingKeyExpiration == nil {
+		return nil
+	}
+	expires := time.Unix(*peer.SharingKeyExpiration, 0)
+	return &expires
+}
+
+// SharingExpired reports whether the link of the shared peer has expired
+func (peer *PeerInfo) SharingExpired(now time.Time) bool {
+	expires := peer.SharingExpires()
+	return expires != nil && expires.Before(now)
+}
+
+// Share prepares the peer to be activated via the link with the given key,
+// the zero maxActivations allows to activate the link any number of times.
+func (peer *PeerInfo) Share(key string, ttl time.Duration, maxActivations int) {
+	expires := time.Now().Add(ttl).Unix()
+	peer.SharingKey = &key
+	peer.SharingKeyExpiration = &expires
+	peer.SharingActivations = nil
+	peer.SharingMaxActivations = nil
+	if maxActivations > 0 {
+		peer.SharingMaxActivations = &maxActivations
+	}
+	peer.WireguardPublicKey = nil
+}
+
+// Activate sets the key of the device activating the shared peer.
+// Every activation replaces the key of the previously activated device,
+// the link must not be expired for any of them.
+func (peer *PeerInfo) Activate(publicKey string, now time.Time) error {
+	if !peer.Shared() {
+		return xerror.EEntryNotFound("no peer with a given sharing key where found", nil)
+	}
+	if peer.SharingExpired(now) {
+		return xerror.EEntryNotFound("peer has already been expired", nil)
+	}
+
+	activations := 0
+	if peer.SharingActivations != nil {
+		activations = *peer.SharingActivations
+	}
+	if peer.SharingMaxActivations != nil && activations >= *peer.SharingMaxActivations {
+		return xerror.EForbidden("the link has been activated the maximum number of times")
+	}
+
+	activations++
+	peer.SharingActivations = &activations
+	peer.WireguardPublicKey = &publicKey
+	peer.Activated = &xtime.Time{Time: now}
+	return nil
+}
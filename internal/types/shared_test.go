@@ -0,0 +1,65 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerActivate(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		name           string
+		ttl            time.Duration
+		maxActivations int
+		at             []time.Duration // the activation times relative to now
+		activations    int             // the number of the successful ones
+	}{
+		{name: "single use", ttl: time.Hour, maxActivations: 1, at: []time.Duration{0, time.Minute}, activations: 1},
+		{name: "unlimited", ttl: time.Hour, at: []time.Duration{0, time.Minute, 2 * time.Minute}, activations: 3},
+		{name: "limited", ttl: time.Hour, maxActivations: 2, at: []time.Duration{0, time.Minute, 2 * time.Minute}, activations: 2},
+		{name: "expired link", ttl: time.Hour, at: []time.Duration{2 * time.Hour}, activations: 0},
+		{name: "expired after the activation", ttl: time.Hour, at: []time.Duration{0, 30 * time.Minute, 2 * time.Hour}, activations: 2},
+	}
+
+	for _, cc := range cases {
+		peer := &PeerInfo{}
+		peer.Share("key", cc.ttl, cc.maxActivations)
+		require.True(t, peer.Pending(), cc.name)
+		require.False(t, peer.SharingActivated(), cc.name)
+		expires := peer.SharingExpires()
+		require.NotNil(t, expires, cc.name)
+
+		activations := 0
+		var activated time.Time
+		for _, at := range cc.at {
+			if err := peer.Activate("public key", now.Add(at)); err == nil {
+				activations++
+				activated = now.Add(at)
+			}
+		}
+
+		require.Equal(t, cc.activations, activations, cc.name)
+		require.Equal(t, cc.activations > 0, peer.SharingActivated(), cc.name)
+		require.Equal(t, cc.activations == 0, peer.Pending(), cc.name)
+		require.Equal(t, expires, peer.SharingExpires(), "%s: the link must keep its expiration", cc.name)
+		if activations > 0 {
+			require.Equal(t, activated, peer.Activated.Time, "%s: the last activation time", cc.name)
+		} else {
+			require.Nil(t, peer.Activated, cc.name)
+		}
+	}
+}
+
+func TestPeerActivateNotShared(t *testing.T) {
+	peer := &PeerInfo{}
+	require.Error(t, peer.Activate("public key", time.Now()))
+	require.False(t, peer.SharingActivated())
+	require.Nil(t, peer.WireguardPublicKey)
+}
@@ -0,0 +1,58 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"net"
+	"strings"
+
+	"github.com/vpnhouse/common-lib-go/xerror"
+)
+
+// ParseSubnets parses the comma-separated list of networks routed through the peer.
+// The networks must be given by their network addresses and must not overlap.
+func ParseSubnets(s string) ([]net.IPNet, error) {
+	var subnets []net.IPNet
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if len(cidr) == 0 {
+			continue
+		}
+
+		ip, subnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, xerror.EInvalidField("invalid routed subnet "+cidr, "routed_subnets", err)
+		}
+		if !ip.Equal(subnet.IP) {
+			return nil, xerror.EInvalidField("routed subnet "+cidr+" is not a network address, want "+subnet.String(), "routed_subnets", nil)
+		}
+		if ones, _ := subnet.Mask.Size(); ones == 0 {
+			return nil, xerror.EInvalidField("default route can't be routed through a peer", "routed_subnets", nil)
+		}
+
+		for _, other := range subnets {
+			if Overlaps(*subnet, other) {
+				return nil, xerror.EInvalidField("routed subnets "+subnet.String()+" and "+other.String()+" overlap", "routed_subnets", nil)
+			}
+		}
+		subnets = append(subnets, *subnet)
+	}
+	return subnets, nil
+}
+
+// Overlaps reports whether the networks have addresses in common
+func Overlaps(a net.IPNet, b net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Subnets returns the networks routed through the peer, nil if not set.
+// Note: it's caller responsibility to provide fully valid peer
+func (peer *PeerInfo) Subnets() []net.IPNet {
+	if peer.RoutedSubnets == nil {
+		return nil
+	}
+	subnets, _ := ParseSubnets(*peer.RoutedSubnets)
+	return subnets
+}
@@ -0,0 +1,70 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubnets(t *testing.T) {
+	cases := []struct {
+		subnets string
+		want    []string
+		err     string
+	}{
+		{subnets: "", want: nil},
+		{subnets: " , ", want: nil},
+		{subnets: "192.168.10.0/24", want: []string{"192.168.10.0/24"}},
+		{subnets: "192.168.10.0/24, 10.10.0.0/16,fd00:10::/64", want: []string{"192.168.10.0/24", "10.10.0.0/16", "fd00:10::/64"}},
+		{subnets: "192.168.10.1/32", want: []string{"192.168.10.1/32"}},
+		{subnets: "192.168.10.0", err: "invalid routed subnet"},
+		{subnets: "192.168.10.1/24", err: "not a network address"},
+		{subnets: "0.0.0.0/0", err: "default route"},
+		{subnets: "::/0", err: "default route"},
+		{subnets: "10.0.0.0/8, 10.10.0.0/16", err: "overlap"},
+		{subnets: "192.168.10.0/24, 192.168.10.0/24", err: "overlap"},
+	}
+
+	for _, cc := range cases {
+		subnets, err := ParseSubnets(cc.subnets)
+		if len(cc.err) > 0 {
+			require.Error(t, err, "subnets: %q", cc.subnets)
+			require.Contains(t, err.Error(), cc.err, "subnets: %q", cc.subnets)
+			continue
+		}
+
+		require.NoError(t, err, "subnets: %q", cc.subnets)
+		var got []string
+		for _, subnet := range subnets {
+			got = append(got, subnet.String())
+		}
+		require.Equal(t, cc.want, got, "subnets: %q", cc.subnets)
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		overlaps bool
+	}{
+		{"10.0.0.0/8", "10.10.0.0/16", true},
+		{"10.10.0.0/16", "10.0.0.0/8", true},
+		{"10.10.0.0/16", "10.10.0.0/16", true},
+		{"10.10.0.0/16", "10.11.0.0/16", false},
+		{"192.168.10.0/24", "192.168.10.255/32", true},
+		{"192.168.10.0/24", "fd00::/64", false},
+	}
+
+	for _, cc := range cases {
+		_, a, err := net.ParseCIDR(cc.a)
+		require.NoError(t, err)
+		_, b, err := net.ParseCIDR(cc.b)
+		require.NoError(t, err)
+		require.Equal(t, cc.overlaps, Overlaps(*a, *b), "%s and %s", cc.a, cc.b)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import "time"
+
+// TrafficResolution is the size of the traffic history bucket
+type TrafficResolution time.Duration
+
+const (
+	TrafficResolution5m     = TrafficResolution(5 * time.Minute)
+	TrafficResolutionHourly = TrafficResolution(time.Hour)
+	TrafficResolutionDaily  = TrafficResolution(24 * time.Hour)
+)
+
+// TrafficResolutions lists the stored resolutions from the finest one
+var TrafficResolutions = []TrafficResolution{
+	TrafficResolution5m,
+	TrafficResolutionHourly,
+	TrafficResolutionDaily,
+}
+
+// Seconds returns the bucket size in seconds as it's stored
+func (r TrafficResolution) Seconds() int64 {
+	return int64(time.Duration(r) / time.Second)
+}
+
+// TrafficRetention defines how long the history of every resolution is kept
+type TrafficRetention map[TrafficResolution]time.Duration
+
+// ResolutionFor returns the coarsest stored resolution the given step can be built of
+// which still keeps the history of the given age, false if there is none.
+func (retention TrafficRetention) ResolutionFor(step time.Duration, age time.Duration) (TrafficResolution, bool) {
+	var resolution TrafficResolution
+	found := false
+	for _, r := range TrafficResolutions {
+		if step%time.Duration(r) == 0 && age <= retention[r] {
+			resolution = r
+			found = true
+		}
+	}
+	return resolution, found
+}
+
+// TrafficPoint is the traffic of the peer within the time bucket
+type TrafficPoint struct {
+	Time       time.Time
+	Upstream   int64
+	Downstream int64
+}
@@ -0,0 +1,55 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolutionFor(t *testing.T) {
+	day := 24 * time.Hour
+	retention := TrafficRetention{
+		TrafficResolution5m:     2 * day,
+		TrafficResolutionHourly: 30 * day,
+		TrafficResolutionDaily:  365 * day,
+	}
+
+	cases := []struct {
+		step time.Duration
+		age  time.Duration
+		want TrafficResolution
+		ok   bool
+	}{
+		{5 * time.Minute, time.Hour, TrafficResolution5m, true},
+		{15 * time.Minute, day, TrafficResolution5m, true},
+		{90 * time.Minute, day, TrafficResolution5m, true},
+		{time.Hour, day, TrafficResolutionHourly, true},
+		{6 * time.Hour, 7 * day, TrafficResolutionHourly, true},
+		{36 * time.Hour, 7 * day, TrafficResolutionHourly, true},
+		{24 * time.Hour, 7 * day, TrafficResolutionDaily, true},
+		{7 * day, 300 * day, TrafficResolutionDaily, true},
+		// the finer history is gone already
+		{30 * time.Minute, 7 * day, 0, false},
+		{time.Hour, 60 * day, 0, false},
+		{day, 400 * day, 0, false},
+		// not a multiple of any resolution
+		{time.Minute, time.Hour, 0, false},
+	}
+
+	for _, cc := range cases {
+		resolution, ok := retention.ResolutionFor(cc.step, cc.age)
+		require.Equal(t, cc.ok, ok, "step: %s, age: %s", cc.step, cc.age)
+		require.Equal(t, cc.want, resolution, "step: %s, age: %s", cc.step, cc.age)
+	}
+}
+
+func TestTrafficResolutionSeconds(t *testing.T) {
+	require.EqualValues(t, 300, TrafficResolution5m.Seconds())
+	require.EqualValues(t, 3600, TrafficResolutionHourly.Seconds())
+	require.EqualValues(t, 86400, TrafficResolutionDaily.Seconds())
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/vpnhouse/common-lib-go/validator"
 	"github.com/vpnhouse/common-lib-go/xerror"
+	"github.com/vpnhouse/tunnel/internal/ipam6"
 	"github.com/vpnhouse/tunnel/internal/types"
 	"go.uber.org/zap"
 	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
@@ -17,6 +18,15 @@ import (
 
 const ProtoName = "wireguard"
 
+const (
+	// ExistingInterfaceAdopt takes over the interface left by the previous run,
+	// its addresses, listen port and private key are reconfigured in place.
+	ExistingInterfaceAdopt = "adopt"
+	// ExistingInterfaceRecreate removes the interface left by the previous run
+	// and creates the new one.
+	ExistingInterfaceRecreate = "recreate"
+)
+
 type Config struct {
 	Interface  string           `yaml:"interface" valid:"alphanum,required"`
 	ServerIPv4 string           `yaml:"server_ipv4" valid:"ipv4"`
@@ -24,8 +34,19 @@ type Config struct {
 	Subnet     validator.Subnet `yaml:"subnet" valid:"subnet,required"`
 	DNS        []string         `yaml:"dns" valid:"ipv4list"`
 
+	// Optional IPv6 subnet for peers, e.g fd00:235::/64.
+	// Peers get IPv4 addresses only if not specified.
+	SubnetIPv6 string `yaml:"subnet_ipv6,omitempty"`
+
+	// Generate the preshared key for every connecting client.
+	PresharedKeys bool `yaml:"preshared_keys,omitempty"`
+
 	// Listen port for wireguard connections.
 	ListenPort int `yaml:"server_port" valid:"port,required"`
+	// What to do if the interface already exists on startup:
+	// "adopt" (default) or "recreate", see ExistingInterface* constants.
+	ExistingInterface string `yaml:"existing_interface,omitempty"`
+
 	// NAT'ed port to access the Listen one, this one announced to the client
 	// as part of its configuration. If not specified - `ListenPort` is used.
 	// e.g container starts with the -p 3333:3000 option, 3000 here is ListenPort value,
@@ -47,9 +68,24 @@ func (c *Config) OnLoad() error {
 	}
 
 	c.privateKey = (types.WGPrivateKey)(k)
+
+	if _, err := c.IPv6Subnet(); err != nil {
+		return err
+	}
+
+	switch c.ExistingInterface {
+	case "", ExistingInterfaceAdopt, ExistingInterfaceRecreate:
+	default:
+		return xerror.EInvalidField("unknown existing_interface mode, want adopt or recreate", "existing_interface", nil)
+	}
 	return nil
 }
 
+// AdoptExistingInterface reports whether the interface left by the previous run must be taken over.
+func (c Config) AdoptExistingInterface() bool {
+	return c.ExistingInterface != ExistingInterfaceRecreate
+}
+
 // ClientPort  returns the port to announce to a client.
 // See Config.NATedPort for details.
 func (c Config) ClientPort() int {
@@ -66,6 +102,37 @@ func (c Config) ServerAddr() string {
 	return fmt.Sprintf("%s/%d", a.FirstUsable().String(), ones)
 }
 
+// IPv6Subnet returns parsed IPv6 subnet of peers,
+// nil means that IPv6 addressing is disabled.
+func (c Config) IPv6Subnet() (*net.IPNet, error) {
+	if len(c.SubnetIPv6) == 0 {
+		return nil, nil
+	}
+	return ipam6.ParseSubnet(c.SubnetIPv6)
+}
+
+// ServerAddrIPv6 returns IPv6Addr/mask to use as a wireguard interface address,
+// or empty string if IPv6 addressing is disabled.
+func (c Config) ServerAddrIPv6() string {
+	subnet, err := c.IPv6Subnet()
+	if err != nil || subnet == nil {
+		return ""
+	}
+	return ipam6.ServerAddr(subnet)
+}
+
+// Subnets returns the networks the peer addresses are allocated from
+func (c Config) Subnets() []net.IPNet {
+	var subnets []net.IPNet
+	if _, subnet, err := net.ParseCIDR(c.ServerAddr()); err == nil {
+		subnets = append(subnets, *subnet)
+	}
+	if subnet, err := c.IPv6Subnet(); err == nil && subnet != nil {
+		subnets = append(subnets, *subnet)
+	}
+	return subnets
+}
+
 func (c Config) GetPrivateKey() types.WGPrivateKey {
 	return c.privateKey
 }
@@ -85,6 +152,27 @@ func DefaultConfig() Config {
 	}
 }
 
+// PeerAllowedIPs returns the list of addresses the peer is allowed to use on the interface.
+// Note: it's caller responsibility to provide fully valid peer
+func PeerAllowedIPs(info *types.PeerInfo) []net.IPNet {
+	allowedIPs := []net.IPNet{{
+		IP:   info.Ipv4.IP,
+		Mask: net.CIDRMask(32, 32),
+	}}
+
+	if info.Ipv6 != nil && info.Ipv6.IP != nil {
+		allowedIPs = append(allowedIPs, net.IPNet{
+			IP:   info.Ipv6.IP,
+			Mask: net.CIDRMask(128, 128),
+		})
+	}
+
+	// site-to-site peers route the networks behind them
+	allowedIPs = append(allowedIPs, info.Subnets()...)
+
+	return allowedIPs
+}
+
 // getPeerConfig generates wireguard configuration for a peer.
 // Note: it's caller responsibility to provide fully valid peer
 func (wg *Wireguard) getPeerConfig(info *types.PeerInfo, remove bool) (*wgtypes.Config, error) {
@@ -93,15 +181,23 @@ func (wg *Wireguard) getPeerConfig(info *types.PeerInfo, remove bool) (*wgtypes.
 		return nil, xerror.EInvalidArgument("can't parse client public key", err, zap.String("key", *info.WireguardPublicKey))
 	}
 
-	ipv4net := net.IPNet{
-		IP:   info.Ipv4.IP,
-		Mask: net.CIDRMask(32, 32),
+	peer := wgtypes.PeerConfig{
+		PublicKey:         key,
+		Remove:            remove,
+		ReplaceAllowedIPs: !remove,
+		AllowedIPs:        PeerAllowedIPs(info),
 	}
 
-	peer := wgtypes.PeerConfig{
-		PublicKey:  key,
-		Remove:     remove,
-		AllowedIPs: []net.IPNet{ipv4net},
+	if !remove {
+		// the zero key removes the preshared key previously set to the peer
+		var psk wgtypes.Key
+		if info.PresharedKey != nil && len(*info.PresharedKey) > 0 {
+			psk, err = wgtypes.ParseKey(*info.PresharedKey)
+			if err != nil {
+				return nil, xerror.EInvalidArgument("can't parse peer preshared key", err)
+			}
+		}
+		peer.PresharedKey = &psk
 	}
 
 	config := wgtypes.Config{
@@ -5,6 +5,8 @@
 package wireguard
 
 import (
+	"net"
+
 	"github.com/vishvananda/netlink"
 	"github.com/vpnhouse/tunnel/internal/types"
 	"go.uber.org/zap"
@@ -26,16 +28,40 @@ func (w *Wireguard) Shutdown() error {
 
 func (w *Wireguard) Running() bool { return w.running }
 
+func (*Wireguard) Adopted() bool { return false }
+
+func (*Wireguard) KeepLinkOn(keep func() bool) {}
+
 func (*Wireguard) SetPeer(info *types.PeerInfo) error {
 	zap.L().Debug("wg: set peer")
 	return nil
 }
 
+func (*Wireguard) ReplacePeers(infos []*types.PeerInfo) map[int64]error {
+	zap.L().Debug("wg: replace peers", zap.Int("peers", len(infos)))
+	return nil
+}
+
 func (*Wireguard) UnsetPeer(info *types.PeerInfo) error {
 	zap.L().Debug("wg: unset peer")
 	return nil
 }
 
+func (*Wireguard) UnsetPeerKey(publicKey string) error {
+	zap.L().Debug("wg: unset peer key")
+	return nil
+}
+
+func (*Wireguard) SetRoutes(subnets []net.IPNet) error {
+	zap.L().Debug("wg: set routes")
+	return nil
+}
+
+func (*Wireguard) UnsetRoutes(subnets []net.IPNet) error {
+	zap.L().Debug("wg: unset routes")
+	return nil
+}
+
 func (*Wireguard) GetPeers() (map[string]wgtypes.Peer, error) {
 	zap.L().Debug("wg: get peers")
 	return map[string]wgtypes.Peer{}, nil
@@ -5,6 +5,10 @@
 package wireguard
 
 import (
+	"errors"
+	"net"
+	"syscall"
+
 	"github.com/vishvananda/netlink"
 	"github.com/vpnhouse/common-lib-go/xerror"
 	"github.com/vpnhouse/tunnel/internal/types"
@@ -17,7 +21,11 @@ type Wireguard struct {
 	client  *wgctrl.Client
 	config  wgtypes.Config
 	link    *wireguardLink
+	adopted bool
 	running bool
+
+	// keepLink tells whether to keep the interface on shutdown
+	keepLink func() bool
 }
 
 type wireguardLink struct {
@@ -53,10 +61,15 @@ func New(config Config) (*Wireguard, error) {
 		link:   &linkAttrs,
 	}
 
-	if err := netlink.LinkAdd(wg.link); err != nil {
-		// TODO(nikonov): maybe try to takeover the existing interface?
-		//  actual for the host-mode only, in docker we'll always have an empty "machine" on restart.
-		return nil, xerror.ETunnelError("can't add link", err, zap.Any("iface", wg.link.name))
+	adopted, err := wg.takeoverLink(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if !adopted {
+		if err := netlink.LinkAdd(wg.link); err != nil {
+			return nil, xerror.ETunnelError("can't add link", err, zap.Any("iface", wg.link.name))
+		}
 	}
 
 	defer func() {
@@ -66,28 +79,139 @@ func New(config Config) (*Wireguard, error) {
 		}
 	}()
 
-	addr, err := netlink.ParseAddr(config.ServerAddr())
+	addrs, err := interfaceAddrs(config)
 	if err != nil {
-		return nil, xerror.EInvalidArgument("can't parse wireguard subnet", err, zap.String("subnet", string(config.Subnet)))
+		return nil, err
 	}
 
-	if err := netlink.AddrAdd(wg.link, addr); err != nil {
-		return nil, xerror.ETunnelError("can't add address", err, zap.Any("addr", addr))
+	if adopted {
+		if err := wg.reconcileAddrs(addrs); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, addr := range addrs {
+			if err := netlink.AddrAdd(wg.link, addr); err != nil {
+				return nil, xerror.ETunnelError("can't add address", err, zap.Stringer("addr", addr))
+			}
+		}
 	}
 
+	// Note: peers of the adopted interface are kept as is to not break the active sessions,
+	//  the manager restores stored peers and removes unknown ones.
 	if err := wg.client.ConfigureDevice(config.Interface, wg.config); err != nil {
 		return nil, xerror.ETunnelError("can't configure wireguard interface", err, zap.Any("config", wg.config))
 	}
 
 	if err := netlink.LinkSetUp(wg.link); err != nil {
-		return nil, xerror.ETunnelError("can't set link up", err, zap.Any("iface", wg.link.name), zap.Stringer("addr", addr))
+		return nil, xerror.ETunnelError("can't set link up", err, zap.Any("iface", wg.link.name), zap.Stringer("addr", addrs[0]))
 	}
 
+	wg.adopted = adopted
 	wg.running = true
 	return wg, nil
 }
 
+// takeoverLink handles the interface left by the previous run according to the config,
+// returns true if the existing interface must be adopted.
+func (wg *Wireguard) takeoverLink(config Config) (bool, error) {
+	link, err := netlink.LinkByName(wg.link.name)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, xerror.ETunnelError("can't lookup link", err, zap.String("iface", wg.link.name))
+	}
+
+	if link.Type() != wg.link.Type() {
+		return false, xerror.ETunnelError("link exists and it is not a wireguard one", nil,
+			zap.String("iface", wg.link.name), zap.String("type", link.Type()))
+	}
+
+	if config.AdoptExistingInterface() {
+		zap.L().Info("adopting existing wireguard interface", zap.String("iface", wg.link.name))
+		return true, nil
+	}
+
+	zap.L().Info("removing existing wireguard interface", zap.String("iface", wg.link.name))
+	if err := netlink.LinkDel(link); err != nil {
+		return false, xerror.ETunnelError("can't remove existing link", err, zap.String("iface", wg.link.name))
+	}
+	return false, nil
+}
+
+// reconcileAddrs makes the interface have exactly the given addresses,
+// IPv6 link-local addresses assigned by the kernel are kept.
+func (wg *Wireguard) reconcileAddrs(addrs []*netlink.Addr) error {
+	current, err := netlink.AddrList(wg.link, netlink.FAMILY_ALL)
+	if err != nil {
+		return xerror.ETunnelError("can't list interface addresses", err, zap.String("iface", wg.link.name))
+	}
+
+	wanted := make(map[string]struct{}, len(addrs))
+	for _, addr := range addrs {
+		wanted[addr.IPNet.String()] = struct{}{}
+	}
+
+	present := make(map[string]struct{}, len(current))
+	for _, addr := range current {
+		present[addr.IPNet.String()] = struct{}{}
+		if _, ok := wanted[addr.IPNet.String()]; ok || addr.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if err := netlink.AddrDel(wg.link, &addr); err != nil {
+			return xerror.ETunnelError("can't remove stale address", err, zap.Stringer("addr", addr))
+		}
+		zap.L().Info("stale interface address removed", zap.Stringer("addr", addr))
+	}
+
+	for _, addr := range addrs {
+		if _, ok := present[addr.IPNet.String()]; ok {
+			continue
+		}
+		if err := netlink.AddrAdd(wg.link, addr); err != nil {
+			return xerror.ETunnelError("can't add address", err, zap.Stringer("addr", addr))
+		}
+	}
+
+	return nil
+}
+
+// interfaceAddrs returns addresses to assign to the wireguard interface
+func interfaceAddrs(config Config) ([]*netlink.Addr, error) {
+	addr, err := netlink.ParseAddr(config.ServerAddr())
+	if err != nil {
+		return nil, xerror.EInvalidArgument("can't parse wireguard subnet", err, zap.String("subnet", string(config.Subnet)))
+	}
+	addrs := []*netlink.Addr{addr}
+
+	if serverAddrIPv6 := config.ServerAddrIPv6(); len(serverAddrIPv6) > 0 {
+		addr6, err := netlink.ParseAddr(serverAddrIPv6)
+		if err != nil {
+			return nil, xerror.EInvalidArgument("can't parse wireguard ipv6 subnet", err, zap.String("subnet", config.SubnetIPv6))
+		}
+		addrs = append(addrs, addr6)
+	}
+
+	return addrs, nil
+}
+
+// KeepLinkOn makes Shutdown keep the interface with its peers on place when keep returns true,
+// so the next instance adopts it without disconnecting clients.
+func (wg *Wireguard) KeepLinkOn(keep func() bool) {
+	wg.keepLink = keep
+}
+
 func (wg *Wireguard) Shutdown() error {
+	if wg.keepLink != nil && wg.keepLink() {
+		zap.L().Info("keeping wireguard interface for the next run")
+		wg.running = false
+		if err := wg.client.Close(); err != nil {
+			return xerror.ETunnelError("can't close wireguard controller", err)
+		}
+		return nil
+	}
+
 	zap.L().Info("removing wireguard interface")
 	err := netlink.LinkDel(wg.link)
 	if err != nil {
@@ -102,6 +226,12 @@ func (wg *Wireguard) Running() bool {
 	return wg.running
 }
 
+// Adopted reports whether the interface has been taken over from the previous run,
+// so it may have peers and traffic counters already.
+func (wg *Wireguard) Adopted() bool {
+	return wg.adopted
+}
+
 // SetPeer sets peer on wireguard interface
 // Note: it's caller responsibility to provide fully valid peer
 func (wg *Wireguard) SetPeer(info *types.PeerInfo) error {
@@ -120,6 +250,63 @@ func (wg *Wireguard) SetPeer(info *types.PeerInfo) error {
 	return nil
 }
 
+// replacePeersChunk limits the number of peers configured at once,
+// so a broken peer makes fall back to the one-by-one configuration of its chunk only.
+const replacePeersChunk = 1024
+
+// ReplacePeers configures the given peers on the interface in bulk, the rest of peers are removed.
+// Peers of the adopted interface are updated in place instead to keep the active sessions,
+// the unknown ones are left for the reconciliation then.
+// Returns the errors of peers failed to configure by their ids.
+// Note: it's caller responsibility to provide fully valid peers
+func (wg *Wireguard) ReplacePeers(infos []*types.PeerInfo) map[int64]error {
+	failed := make(map[int64]error)
+	peers := make([]*types.PeerInfo, 0, len(infos))
+	configs := make([]wgtypes.PeerConfig, 0, len(infos))
+	for _, info := range infos {
+		config, err := wg.getPeerConfig(info, false)
+		if err != nil {
+			failed[info.ID] = err
+			continue
+		}
+		peers = append(peers, info)
+		configs = append(configs, config.Peers...)
+	}
+
+	start := 0
+	for _, config := range replacePeersConfigs(configs, wg.adopted) {
+		end := start + len(config.Peers)
+		if err := wg.client.ConfigureDevice(wg.link.name, config); err != nil {
+			zap.L().Warn("can't set peers in bulk, setting them one by one",
+				zap.String("iface", wg.link.name), zap.Int("peers", end-start), zap.Error(err))
+			for i := start; i < end; i++ {
+				config := wgtypes.Config{Peers: configs[i : i+1]}
+				if err := wg.client.ConfigureDevice(wg.link.name, config); err != nil {
+					failed[peers[i].ID] = xerror.ETunnelError("can't set peer", err, zap.Int64("id", peers[i].ID))
+				}
+			}
+		}
+		start = end
+	}
+
+	return failed
+}
+
+// replacePeersConfigs splits the peers configuration into the chunks set on the interface in turn,
+// the first chunk replaces the peers of the interface unless it's adopted.
+func replacePeersConfigs(configs []wgtypes.PeerConfig, adopted bool) []wgtypes.Config {
+	chunks := make([]wgtypes.Config, 0, (len(configs)+replacePeersChunk-1)/replacePeersChunk)
+	for start := 0; start < len(configs); start += replacePeersChunk {
+		end := min(start+replacePeersChunk, len(configs))
+		chunks = append(chunks, wgtypes.Config{
+			// the following chunks add up to the first one
+			ReplacePeers: !adopted && start == 0,
+			Peers:        configs[start:end],
+		})
+	}
+	return chunks
+}
+
 // UnsetPeer removes peer from wireguard interface
 // Note: it's caller responsibility to provide fully valid peer
 func (wg *Wireguard) UnsetPeer(info *types.PeerInfo) error {
@@ -138,6 +325,72 @@ func (wg *Wireguard) UnsetPeer(info *types.PeerInfo) error {
 	return nil
 }
 
+// UnsetPeerKey removes peer with the given public key from wireguard interface
+func (wg *Wireguard) UnsetPeerKey(publicKey string) error {
+	zap.L().Debug("unset peer key", zap.String("key", publicKey))
+
+	key, err := wgtypes.ParseKey(publicKey)
+	if err != nil {
+		return xerror.EInvalidArgument("can't parse client public key", err, zap.String("key", publicKey))
+	}
+
+	config := wgtypes.Config{
+		Peers: []wgtypes.PeerConfig{{PublicKey: key, Remove: true}},
+	}
+
+	err = wg.client.ConfigureDevice(wg.link.name, config)
+	if err != nil {
+		return xerror.ETunnelError("can't unset peer", err, zap.String("key", publicKey))
+	}
+
+	return nil
+}
+
+// SetRoutes routes the given networks to the interface,
+// so they are reachable through the peers having them in the allowed IPs.
+func (wg *Wireguard) SetRoutes(subnets []net.IPNet) error {
+	if len(subnets) == 0 {
+		return nil
+	}
+
+	link, err := netlink.LinkByName(wg.link.name)
+	if err != nil {
+		return xerror.ETunnelError("can't lookup link", err, zap.String("iface", wg.link.name))
+	}
+
+	for _, subnet := range subnets {
+		dst := subnet
+		route := &netlink.Route{LinkIndex: link.Attrs().Index, Dst: &dst}
+		if err := netlink.RouteReplace(route); err != nil {
+			return xerror.ETunnelError("can't add route", err, zap.String("iface", wg.link.name), zap.Stringer("subnet", &dst))
+		}
+	}
+
+	return nil
+}
+
+// UnsetRoutes removes the routes of the given networks from the interface
+func (wg *Wireguard) UnsetRoutes(subnets []net.IPNet) error {
+	if len(subnets) == 0 {
+		return nil
+	}
+
+	link, err := netlink.LinkByName(wg.link.name)
+	if err != nil {
+		return xerror.ETunnelError("can't lookup link", err, zap.String("iface", wg.link.name))
+	}
+
+	for _, subnet := range subnets {
+		dst := subnet
+		route := &netlink.Route{LinkIndex: link.Attrs().Index, Dst: &dst}
+		if err := netlink.RouteDel(route); err != nil && !errors.Is(err, syscall.ESRCH) {
+			return xerror.ETunnelError("can't remove route", err, zap.String("iface", wg.link.name), zap.Stringer("subnet", &dst))
+		}
+	}
+
+	return nil
+}
+
 // GetPeers returns peers configured for the underlying device.
 // Map's key is a peer's public key string.
 func (wg *Wireguard) GetPeers() (map[string]*wgtypes.Peer, error) {
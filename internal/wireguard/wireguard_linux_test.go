@@ -0,0 +1,50 @@
+// Copyright 2021 The VPN House Authors. All rights reserved.
+// Use of this source code is governed by a AGPL-style
+// license that can be found in the LICENSE file.
+
+package wireguard
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.zx2c4.com/wireguard/wgctrl/wgtypes"
+)
+
+func TestReplacePeersConfigs(t *testing.T) {
+	cases := []struct {
+		peers   int
+		adopted bool
+		chunks  []int
+	}{
+		{peers: 0, chunks: []int{}},
+		{peers: 1, chunks: []int{1}},
+		{peers: replacePeersChunk, chunks: []int{replacePeersChunk}},
+		{peers: replacePeersChunk + 1, chunks: []int{replacePeersChunk, 1}},
+		{peers: 2*replacePeersChunk + 5, chunks: []int{replacePeersChunk, replacePeersChunk, 5}},
+		{peers: replacePeersChunk + 1, adopted: true, chunks: []int{replacePeersChunk, 1}},
+	}
+
+	for _, cc := range cases {
+		configs := make([]wgtypes.PeerConfig, cc.peers)
+		for i := range configs {
+			key, err := wgtypes.GenerateKey()
+			require.NoError(t, err)
+			configs[i].PublicKey = key
+		}
+
+		chunks := replacePeersConfigs(configs, cc.adopted)
+		require.Len(t, chunks, len(cc.chunks), "peers: %d", cc.peers)
+
+		var got []wgtypes.PeerConfig
+		for i, chunk := range chunks {
+			require.Len(t, chunk.Peers, cc.chunks[i], "peers: %d, chunk: %d", cc.peers, i)
+			// only the first chunk replaces the peers, the rest add up to it
+			require.Equal(t, !cc.adopted && i == 0, chunk.ReplacePeers, "peers: %d, chunk: %d", cc.peers, i)
+			got = append(got, chunk.Peers...)
+		}
+		if cc.peers > 0 {
+			require.Equal(t, configs, got, "peers: %d", cc.peers)
+		}
+	}
+}